@@ -1,12 +1,53 @@
+/*
+Generates a random AES-256 key.
+The key is printed as base64, or written to a key file (see crypto.SaveKeyFile) with -o.
+*/
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
 
 	"github.com/bit-mancer/go-util-helpers/crypto"
 )
 
+var (
+	outputFile string
+	purpose    string
+)
+
+func init() {
+	flag.StringVar(&outputFile, "o", "", "Key file (readable only by the owner); the key's ID is printed. If not provided, the base64-encoded key will be sent to stdout.")
+	flag.StringVar(&purpose, "purpose", "", "Description of what the key is used for, recorded in the key file.")
+}
+
 func main() {
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-o <key-file> [-purpose <purpose>]]\nOptions:\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	flag.Parse()
+
+	if len(flag.Args()) != 0 || (purpose != "" && outputFile == "") {
+		flag.Usage()
+	}
+
 	key := crypto.NewRandomAESKey()
-	fmt.Println(key.ToBase64())
+	defer key.Destroy()
+
+	if outputFile == "" {
+		fmt.Println(key.ToBase64())
+		return
+	}
+
+	if err := crypto.SaveKeyFile(outputFile, crypto.NewKeyFile(key, purpose)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing the key file:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(key.ID())
 }
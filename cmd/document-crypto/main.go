@@ -0,0 +1,129 @@
+/*
+Encrypts the values of a JSON or YAML document (e.g. a config file), leaving its keys readable, and decrypts them
+(see crypto.EncryptDocument). To encrypt a file in place, provide the same file to -i and -o.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bit-mancer/go-util-helpers/cmd/internal/cli"
+	"github.com/bit-mancer/go-util-helpers/crypto"
+)
+
+var (
+	encrypt    bool
+	decrypt    bool
+	base64Key  string
+	keyFile    string
+	paths      cli.StringsFlag
+	formatName string
+	inputFile  string
+	outputFile string
+)
+
+func init() {
+	flag.BoolVar(&encrypt, "e", false, "Encrypt.")
+	flag.BoolVar(&decrypt, "d", false, "Decrypt.")
+	flag.StringVar(&base64Key, "k", "", "Base64-encoded AES-256 key.")
+	flag.StringVar(&keyFile, "kf", "", "Key file (see cmd/aes256-key).")
+	flag.Var(&paths, "p", "Path of the values to encrypt (e.g. database.password or servers[0].token); may be repeated. If not provided, every value is encrypted.")
+	flag.StringVar(&formatName, "f", "", "Document format: json or yaml. If not provided, it is detected from the input file's extension.")
+	flag.StringVar(&inputFile, "i", "", "Input file; if not provided, input will be read from stdin.")
+	flag.StringVar(&outputFile, "o", "", "Output file; if not provided, output will be sent to stdout.")
+}
+
+func documentFormat() (crypto.DocumentFormat, error) {
+
+	name := formatName
+	if name == "" {
+		name = strings.TrimPrefix(filepath.Ext(inputFile), ".")
+	}
+
+	switch strings.ToLower(name) {
+	case "json":
+		return crypto.DocumentJSON, nil
+	case "yaml", "yml":
+		return crypto.DocumentYAML, nil
+	case "":
+		return 0, errors.New("the document format must be provided with -f")
+	default:
+		return 0, fmt.Errorf("unknown document format %q", name)
+	}
+}
+
+func readInput() ([]byte, error) {
+	if inputFile == "" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+
+	return ioutil.ReadFile(inputFile)
+}
+
+func run() error {
+
+	format, err := documentFormat()
+	if err != nil {
+		return err
+	}
+
+	key, err := cli.LoadKey(base64Key, keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading the key: %v", err)
+	}
+	defer key.Destroy()
+
+	input, err := readInput()
+	if err != nil {
+		return err
+	}
+
+	var output []byte
+	if encrypt {
+		if output, err = crypto.EncryptDocument(input, format, key, paths...); err != nil {
+			return fmt.Errorf("error encrypting: %v", err)
+		}
+	} else {
+		if output, err = crypto.DecryptDocument(input, format, key); err != nil {
+			return fmt.Errorf("error decrypting: %v", err)
+		}
+	}
+
+	if outputFile == "" {
+		_, err = os.Stdout.Write(output)
+		return err
+	}
+
+	return ioutil.WriteFile(outputFile, output, 0600)
+}
+
+func main() {
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-e [-p <path>...] | -d] (-k <key> | -kf <key-file>) [-f json|yaml] [-i <input-file>] [-o <output-file>]\nOptions:\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	flag.Parse()
+
+	switch {
+	case encrypt == decrypt:
+		fallthrough
+	case (base64Key == "") == (keyFile == ""):
+		fallthrough
+	case len(paths) > 0 && decrypt, len(flag.Args()) != 0:
+		flag.Usage()
+	}
+
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
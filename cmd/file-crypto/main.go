@@ -1,41 +1,63 @@
 /*
 Simple file encryption/decrypt.
-The file must fit in available memory.
+Files are encrypted as a stream of authenticated chunks, so they do not need to fit in available memory.
+Files encrypted by older versions (without a header) can still be decrypted, but must fit in available memory.
 */
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
+	"github.com/bit-mancer/go-util-helpers/cmd/internal/cli"
 	"github.com/bit-mancer/go-util-helpers/crypto"
+	"golang.org/x/term"
 )
 
 var (
-	encrypt    bool
-	decrypt    bool
-	base64Key  string
-	inputFile  string
-	outputFile string
+	encrypt          bool
+	decrypt          bool
+	base64Key        string
+	usePhrase        bool
+	recipients       cli.StringsFlag
+	recipientKeyFile string
+	cipherName       string
+	compressionName  string
+	aad              string
+	armor            bool
+	inputFile        string
+	outputFile       string
 )
 
 func init() {
 	flag.BoolVar(&encrypt, "e", false, "Encrypt.")
 	flag.BoolVar(&decrypt, "d", false, "Decrypt.")
 	flag.StringVar(&base64Key, "k", "", "Base64-encoded AES-256 key.")
+	flag.BoolVar(&usePhrase, "p", false, "Use a passphrase instead of a key; the passphrase is prompted for, or read from the first line of stdin.")
+	flag.Var(&recipients, "r", "Base64-encoded recipient public key (see cmd/recipient-key) to encrypt to; may be repeated.")
+	flag.StringVar(&recipientKeyFile, "rk", "", "Recipient private key file, to decrypt a file encrypted with -r.")
+	flag.StringVar(&cipherName, "cipher", "", "Cipher to encrypt with when using a key: AES-256-GCM (the default), XChaCha20-Poly1305 or AES-256-GCM-SIV. Decryption detects the cipher.")
+	flag.StringVar(&compressionName, "z", "", "Compress before encrypting when using a key: gzip or zstd. This reveals how well the file compresses; do not use it for files that mix secrets with data an attacker controls. Decryption detects the compression.")
+	flag.StringVar(&aad, "aad", "", "Associated data (e.g. the file's purpose or location); the same value must be provided to decrypt.")
+	flag.BoolVar(&armor, "a", false, "Write (when encrypting) or read (when decrypting) ASCII-armored text instead of binary.")
 	flag.StringVar(&inputFile, "i", "", "Input file; if not provided, input will be read from stdin.")
 	flag.StringVar(&outputFile, "o", "", "Output file; if not provided, output will be sent to stdout.")
 }
 
 var (
-	fileMode os.FileMode = 0644
+	fileMode       os.FileMode = 0644
+	tempOutputFile string
 )
 
-func readInput() ([]byte, error) {
+func openInput() (io.ReadCloser, error) {
 	if inputFile == "" {
-		return ioutil.ReadAll(os.Stdin)
+		return os.Stdin, nil
 	}
 
 	fileInfo, err := os.Stat(inputFile)
@@ -45,69 +67,276 @@ func readInput() ([]byte, error) {
 
 	fileMode = fileInfo.Mode()
 
-	return ioutil.ReadFile(inputFile)
+	return os.Open(inputFile)
 }
 
-func writeOutput(data []byte) error {
-	if outputFile != "" {
-		return ioutil.WriteFile(outputFile, data, fileMode)
+// openOutput returns stdout, or a temporary file in the output file's directory that commitOutput renames to the
+// output file once the output is complete. An existing output file (which may also be the input file) is left
+// untouched until then.
+func openOutput() (io.WriteCloser, error) {
+	if outputFile == "" {
+		return os.Stdout, nil
 	}
 
-	_, err := os.Stdout.Write(data)
+	f, err := ioutil.TempFile(filepath.Dir(outputFile), "."+filepath.Base(outputFile)+".")
+	if err != nil {
+		return nil, err
+	}
+
+	tempOutputFile = f.Name()
+
+	if err := f.Chmod(fileMode.Perm()); err != nil {
+		f.Close()
+		os.Remove(tempOutputFile)
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// commitOutput closes the output, and renames the temporary output file (if any) to the output file.
+func commitOutput(output io.WriteCloser) error {
+
+	if err := output.Close(); err != nil {
+		return err
+	}
+
+	if tempOutputFile == "" {
+		return nil
+	}
+
+	if err := os.Rename(tempOutputFile, outputFile); err != nil {
+		return err
+	}
+
+	tempOutputFile = ""
+	return nil
+}
+
+// fail reports the error and exits; the temporary output file is removed so that a partial result is not left
+// behind, and an existing output file is left as it was.
+func fail(err error, msg ...interface{}) {
+	fmt.Fprintln(os.Stderr, append(msg, err)...)
+
+	if tempOutputFile != "" {
+		os.Remove(tempOutputFile)
+	}
+
+	os.Exit(1)
+}
+
+// credentials are what the input is encrypted or decrypted with: exactly one of a key, a passphrase, recipient public
+// keys (to encrypt) or a recipient key (to decrypt).
+type credentials struct {
+	key          *crypto.AES256Key
+	cipher       crypto.CipherID
+	compression  crypto.Compression
+	passphrase   []byte
+	recipients   []*crypto.RecipientPublicKey
+	recipientKey *crypto.RecipientKey
+}
+
+func newEncryptingWriter(w io.Writer, c *credentials) (io.WriteCloser, error) {
+	switch {
+	case c.passphrase != nil:
+		return crypto.NewPassphraseEncryptingWriter(w, []byte(aad), c.passphrase)
+	case c.recipients != nil:
+		return crypto.NewRecipientsEncryptingWriter(w, []byte(aad), c.recipients...)
+	default:
+		return crypto.NewEncryptingWriterWithOptions(w, c.key, crypto.EncryptOptions{
+			Cipher:         c.cipher,
+			AdditionalData: []byte(aad),
+			Compression:    c.compression,
+		})
+	}
+}
+
+func decryptInput(input *bufio.Reader, output io.Writer, c *credentials) error {
+
+	var r io.Reader
+	var err error
+
+	switch {
+	case c.passphrase != nil:
+		r, err = crypto.NewPassphraseDecryptingReader(input, []byte(aad), c.passphrase)
+	case c.recipientKey != nil:
+		r, err = crypto.NewRecipientDecryptingReader(input, []byte(aad), c.recipientKey)
+	default:
+		magic, _ := input.Peek(4)
+		if !crypto.HasHeader(magic) {
+			return decryptLegacyInput(input, output, c.key)
+		}
+
+		r, err = crypto.NewDecryptingReaderWithAAD(input, []byte(aad), c.key)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(output, r)
+	return err
+}
+
+// loadCredentials loads the key, passphrase or recipient keys selected by the flags.
+func loadCredentials() (*credentials, error) {
+
+	c := &credentials{}
+	var err error
+
+	switch {
+	case usePhrase:
+		if inputFile == "" && !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, errors.New("the input file must be provided with -i when the passphrase is read from stdin")
+		}
+
+		if c.passphrase, err = cli.ReadPassphrase(encrypt); err != nil {
+			return nil, err
+		}
+
+	case len(recipients) > 0:
+		for _, recipient := range recipients {
+			public, err := crypto.NewRecipientPublicKeyFromBase64(recipient)
+			if err != nil {
+				return nil, fmt.Errorf("error loading the recipient public key %q: %v", recipient, err)
+			}
+			c.recipients = append(c.recipients, public)
+		}
+
+	case recipientKeyFile != "":
+		if c.recipientKey, err = crypto.ReadRecipientKeyPEMFile(recipientKeyFile); err != nil {
+			return nil, fmt.Errorf("error loading the recipient private key: %v", err)
+		}
+
+	default:
+		if c.key, err = crypto.NewAESKeyFromBase64(base64Key); err != nil {
+			return nil, fmt.Errorf("error loading the base64-encoded AES-256 key: %v", err)
+		}
+
+		if cipherName != "" {
+			if c.cipher, err = crypto.ParseCipher(cipherName); err != nil {
+				return nil, err
+			}
+		}
+
+		if compressionName != "" {
+			if c.compression, err = crypto.ParseCompression(compressionName); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// decryptLegacyInput decrypts a file produced by an older version: a single headerless ciphertext.
+func decryptLegacyInput(input io.Reader, output io.Writer, key *crypto.AES256Key) error {
+
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := crypto.DecryptWithAAD(data, []byte(aad), key)
+	if err != nil {
+		return err
+	}
+
+	_, err = output.Write(plaintext)
 	return err
 }
 
 func main() {
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [-e | -d] -k <key> [-i <input-file>] [-o <output-file>]\nOptions:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [-e | -d] (-k <key> [-cipher <name>] [-z <compression>] | -p | -r <recipient>... | -rk <recipient-key-file>) [-aad <data>] [-a] [-i <input-file>] [-o <output-file>]\nOptions:\n", os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(2)
 	}
 
 	flag.Parse()
 
+	selected := 0
+	for _, isSet := range []bool{base64Key != "", usePhrase, len(recipients) > 0, recipientKeyFile != ""} {
+		if isSet {
+			selected++
+		}
+	}
+
 	switch {
-	case base64Key == "":
+	case selected != 1:
 		fallthrough
 	case encrypt && decrypt:
 		fallthrough
 	case !encrypt && !decrypt:
+		fallthrough
+	case (cipherName != "" || compressionName != "") && (base64Key == "" || decrypt):
+		fallthrough
+	case len(recipients) > 0 && decrypt, recipientKeyFile != "" && encrypt:
 		flag.Usage()
 	}
 
-	key, err := crypto.NewAESKeyFromBase64(base64Key)
+	c, err := loadCredentials()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error loading the base64-encoded AES-256 key:", err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
-	data, err := readInput()
+	input, err := openInput()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	defer input.Close()
 
-	var renderedBytes []byte
+	output, err := openOutput()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	if encrypt {
-		renderedBytes, err = crypto.Encrypt(data, key)
+		var armored io.WriteCloser
+		var ciphertext io.Writer = output
+		if armor {
+			armored = crypto.NewArmoringWriter(output)
+			ciphertext = armored
+		}
+
+		w, err := newEncryptingWriter(ciphertext, c)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error encrypting:", err)
-			os.Exit(1)
+			fail(err, "Error encrypting:")
+		}
+
+		if _, err := io.Copy(w, input); err != nil {
+			fail(err, "Error encrypting:")
+		}
+
+		if err := w.Close(); err != nil {
+			fail(err, "Error encrypting:")
+		}
+
+		if armored != nil {
+			if err := armored.Close(); err != nil {
+				fail(err, "Error encrypting:")
+			}
 		}
 	} else if decrypt {
-		renderedBytes, err = crypto.Decrypt(data, key)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error decrypting:", err)
-			os.Exit(1)
+		var ciphertext io.Reader = input
+		if armor {
+			if ciphertext, err = crypto.NewDearmoringReader(input); err != nil {
+				fail(err, "Error decrypting:")
+			}
+		}
+
+		if err := decryptInput(bufio.NewReader(ciphertext), output, c); err != nil {
+			fail(err, "Error decrypting:")
 		}
 	} else {
 		panic("no mode specified")
 	}
 
-	if err := writeOutput(renderedBytes); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	if err := commitOutput(output); err != nil {
+		fail(err)
 	}
 }
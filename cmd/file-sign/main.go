@@ -0,0 +1,127 @@
+/*
+Signs files, and verifies file signatures, with a public-key signing key pair (see cmd/signing-key).
+Signatures are written as a single line of base64. The file is hashed as it is read, so it does not need to fit in
+available memory; Ed25519 keys sign the hash with Ed25519ph (RFC 8032).
+*/
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+)
+
+var (
+	sign          bool
+	verify        bool
+	keyFile       string
+	inputFile     string
+	signatureFile string
+)
+
+func init() {
+	flag.BoolVar(&sign, "s", false, "Sign, with a private key.")
+	flag.BoolVar(&verify, "v", false, "Verify, with a public key.")
+	flag.StringVar(&keyFile, "k", "", "PEM-encoded private (-s) or public (-v) key file.")
+	flag.StringVar(&inputFile, "i", "", "Input file; if not provided, input will be read from stdin.")
+	flag.StringVar(&signatureFile, "sig", "", "Signature file; required to verify. If not provided when signing, the signature will be sent to stdout.")
+}
+
+func openInput() (io.ReadCloser, error) {
+	if inputFile == "" {
+		return os.Stdin, nil
+	}
+
+	return os.Open(inputFile)
+}
+
+func signInput(input io.Reader) error {
+
+	key, err := crypto.ReadSigningKeyPEMFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading the private key: %v", err)
+	}
+
+	signature, err := key.SignReader(input)
+	if err != nil {
+		return err
+	}
+
+	line := base64.StdEncoding.EncodeToString(signature) + "\n"
+
+	if signatureFile == "" {
+		_, err = os.Stdout.WriteString(line)
+		return err
+	}
+
+	return ioutil.WriteFile(signatureFile, []byte(line), 0644)
+}
+
+func verifyInput(input io.Reader) error {
+
+	key, err := crypto.ReadVerifyingKeyPEMFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading the public key: %v", err)
+	}
+
+	line, err := ioutil.ReadFile(signatureFile)
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(line)))
+	if err != nil {
+		return fmt.Errorf("malformed signature: %v", err)
+	}
+
+	return key.VerifyReader(input, signature)
+}
+
+func main() {
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-s | -v] -k <key-file> [-i <input-file>] [-sig <signature-file>]\nOptions:\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	flag.Parse()
+
+	switch {
+	case keyFile == "", len(flag.Args()) != 0:
+		fallthrough
+	case sign && verify:
+		fallthrough
+	case !sign && !verify:
+		fallthrough
+	case verify && signatureFile == "":
+		flag.Usage()
+	}
+
+	input, err := openInput()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading the input:", err)
+		os.Exit(1)
+	}
+	defer input.Close()
+
+	if sign {
+		if err := signInput(input); err != nil {
+			fmt.Fprintln(os.Stderr, "Error signing:", err)
+			os.Exit(1)
+		}
+	} else {
+		if err := verifyInput(input); err != nil {
+			fmt.Fprintln(os.Stderr, "Verification failed:", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(os.Stderr, "Signature OK")
+	}
+}
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+)
+
+// StringsFlag is a flag that may be repeated.
+type StringsFlag []string
+
+func (f *StringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *StringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// LoadKey returns the key from the key file if keyFile is set (see cmd/aes256-key), or else the base64-encoded key.
+func LoadKey(base64Key string, keyFile string) (*crypto.AES256Key, error) {
+
+	if keyFile != "" {
+		kf, err := crypto.LoadKeyFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return kf.Key, nil
+	}
+
+	return crypto.NewAESKeyFromBase64(base64Key)
+}
@@ -0,0 +1,124 @@
+/*
+Splits an AES-256 key into share files with Shamir's secret sharing, and recombines shares into the key.
+Each share file holds a single line of base64 (see crypto.KeyShare), and is readable only by the owner.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/bit-mancer/go-util-helpers/cmd/internal/cli"
+	"github.com/bit-mancer/go-util-helpers/crypto"
+)
+
+var (
+	split      bool
+	combine    bool
+	base64Key  string
+	keyFile    string
+	shares     int
+	threshold  int
+	outputFile string
+)
+
+func init() {
+	flag.BoolVar(&split, "split", false, "Split a key into share files, named <output>.1 to <output>.<n>.")
+	flag.BoolVar(&combine, "combine", false, "Combine the share files given as arguments into the key.")
+	flag.StringVar(&base64Key, "k", "", "Base64-encoded AES-256 key to split.")
+	flag.StringVar(&keyFile, "kf", "", "Key file (see cmd/aes256-key) to split.")
+	flag.IntVar(&shares, "n", 5, "Number of shares to split the key into.")
+	flag.IntVar(&threshold, "t", 3, "Number of shares needed to recombine the key.")
+	flag.StringVar(&outputFile, "o", "", "When splitting, the share file prefix (required). When combining, the key file to write; if not provided, the base64-encoded key will be sent to stdout.")
+}
+
+func splitKey() error {
+
+	key, err := cli.LoadKey(base64Key, keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading the key: %v", err)
+	}
+	defer key.Destroy()
+
+	keyShares, err := crypto.Split(key, shares, threshold)
+	if err != nil {
+		return err
+	}
+
+	for _, share := range keyShares {
+		path := fmt.Sprintf("%s.%d", outputFile, share.Index())
+		if err := ioutil.WriteFile(path, []byte(share.ToBase64()+"\n"), 0600); err != nil {
+			return fmt.Errorf("error writing share %d: %v", share.Index(), err)
+		}
+	}
+
+	fmt.Printf("Split key %v into %d shares; any %d recombine it.\n", key.ID(), shares, threshold)
+	return nil
+}
+
+func combineShares(paths []string) error {
+
+	var keyShares []*crypto.KeyShare
+
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		share, err := crypto.NewKeyShareFromBase64(string(contents))
+		if err != nil {
+			return fmt.Errorf("error loading the share %s: %v", path, err)
+		}
+
+		keyShares = append(keyShares, share)
+	}
+
+	key, err := crypto.Combine(keyShares)
+	if err != nil {
+		return err
+	}
+	defer key.Destroy()
+
+	if outputFile == "" {
+		fmt.Println(key.ToBase64())
+		return nil
+	}
+
+	return crypto.SaveKeyFile(outputFile, crypto.NewKeyFile(key, ""))
+}
+
+func main() {
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -split (-k <key> | -kf <key-file>) [-n <shares>] [-t <threshold>] -o <share-file-prefix>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s -combine [-o <key-file>] <share-file>...\nOptions:\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	flag.Parse()
+
+	switch {
+	case split == combine:
+		fallthrough
+	case split && ((base64Key == "") == (keyFile == "") || outputFile == "" || len(flag.Args()) != 0):
+		fallthrough
+	case combine && (base64Key != "" || keyFile != "" || len(flag.Args()) == 0):
+		flag.Usage()
+	}
+
+	var err error
+	if split {
+		err = splitKey()
+	} else {
+		err = combineShares(flag.Args())
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
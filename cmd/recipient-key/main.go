@@ -0,0 +1,57 @@
+/*
+Generates an X25519 recipient key pair, to encrypt files to with cmd/file-crypto -r.
+The public key is printed as base64; the private key is PEM-encoded.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+)
+
+var outputFile string
+
+func init() {
+	flag.StringVar(&outputFile, "o", "", "Private key file (readable only by the owner). If not provided, the PEM-encoded private key will be sent to stdout before the public key.")
+}
+
+func main() {
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-o <private-key-file>]\nOptions:\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	flag.Parse()
+
+	if len(flag.Args()) != 0 {
+		flag.Usage()
+	}
+
+	key, err := crypto.NewRecipientKey()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error generating the key:", err)
+		os.Exit(1)
+	}
+
+	if outputFile != "" {
+		if err := key.WritePEMFile(outputFile); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing the private key:", err)
+			os.Exit(1)
+		}
+	} else {
+		pemBytes, err := key.MarshalPEM()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		os.Stdout.Write(pemBytes)
+	}
+
+	fmt.Println(key.Public().ToBase64())
+}
@@ -0,0 +1,78 @@
+/*
+Generates a public-key signing key pair (see cmd/file-sign).
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+)
+
+var (
+	algorithmName string
+	outputFile    string
+)
+
+func init() {
+	flag.StringVar(&algorithmName, "a", crypto.Ed25519.String(), "Algorithm: Ed25519 or ECDSA-P256.")
+	flag.StringVar(&outputFile, "o", "", "Private key file (readable only by the owner); the public key is written to the same path plus \".pub\". If not provided, both PEM-encoded keys will be sent to stdout.")
+}
+
+func main() {
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-a <algorithm>] [-o <private-key-file>]\nOptions:\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	flag.Parse()
+
+	if len(flag.Args()) != 0 {
+		flag.Usage()
+	}
+
+	algorithm, err := crypto.ParseSigningAlgorithm(algorithmName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	key, err := crypto.NewSigningKey(algorithm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error generating the key:", err)
+		os.Exit(1)
+	}
+
+	if outputFile != "" {
+		if err := key.WritePEMFile(outputFile); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing the private key:", err)
+			os.Exit(1)
+		}
+
+		if err := key.Public().WritePEMFile(outputFile + ".pub"); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing the public key:", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	privatePEM, err := key.MarshalPEM()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	publicPEM, err := key.Public().MarshalPEM()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Stdout.Write(privatePEM)
+	os.Stdout.Write(publicPEM)
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"encoding/base64"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 
+	"github.com/bit-mancer/go-util-helpers/cmd/internal/cli"
 	"github.com/bit-mancer/go-util-helpers/crypto"
 )
 
@@ -12,31 +16,100 @@ var (
 	encrypt   bool
 	decrypt   bool
 	base64Key string
+	usePhrase bool
+	aad       string
+	armor     bool
 )
 
 func init() {
 	flag.BoolVar(&encrypt, "e", false, "Encrypt.")
 	flag.BoolVar(&decrypt, "d", false, "Decrypt.")
 	flag.StringVar(&base64Key, "k", "", "Base64-encoded AES-256 key.")
+	flag.BoolVar(&usePhrase, "p", false, "Use a passphrase instead of a key; the passphrase is prompted for, or read from the first line of stdin.")
+	flag.StringVar(&aad, "aad", "", "Associated data (e.g. a record ID or field name); the same value must be provided to decrypt.")
+	flag.BoolVar(&armor, "a", false, "Output (when encrypting) or accept (when decrypting) ASCII-armored text instead of a base64 line.")
+}
+
+func encryptText(text string, key *crypto.AES256Key, passphrase []byte) (string, error) {
+
+	var ciphertext []byte
+	var err error
+
+	if passphrase == nil {
+		ciphertext, err = crypto.EncryptWithAAD([]byte(text), []byte(aad), key)
+	} else {
+		ciphertext, err = crypto.EncryptWithPassphrase([]byte(text), []byte(aad), passphrase)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if armor {
+		return strings.TrimSuffix(string(crypto.Armor(ciphertext)), "\n"), nil
+	}
+
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func decryptText(text string, key *crypto.AES256Key, passphrase []byte) (string, error) {
+
+	var ciphertext []byte
+	var err error
+
+	if armor {
+		ciphertext, err = crypto.Dearmor([]byte(text))
+	} else {
+		ciphertext, err = base64.StdEncoding.DecodeString(text)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	var plaintext []byte
+	if passphrase == nil {
+		plaintext, err = crypto.DecryptWithAAD(ciphertext, []byte(aad), key)
+	} else {
+		plaintext, err = crypto.DecryptWithPassphrase(ciphertext, []byte(aad), passphrase)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
 }
 
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [-e | -d] -k <key> <text>\nOptions:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [-e | -d] (-k <key> | -p) [-aad <data>] [-a] <text>\n       %s -d -k <key> [-aad <data>] -a < <armored-text>\nOptions:\n", os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(2)
 	}
 
 	flag.Parse()
 
-	if len(flag.Args()) != 1 {
+	// armored text starts with dashes, and so is easier to provide on stdin than as an argument
+	readStdin := len(flag.Args()) == 0 && armor && decrypt && !usePhrase
+
+	if len(flag.Args()) != 1 && !readStdin {
 		flag.Usage()
 	}
 
 	text := flag.Arg(0)
 
+	if readStdin {
+		input, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading stdin:", err)
+			os.Exit(1)
+		}
+		text = string(input)
+	}
+
 	switch {
-	case base64Key == "", text == "":
+	case (base64Key == "") == !usePhrase, text == "":
 		fallthrough
 	case encrypt && decrypt:
 		fallthrough
@@ -44,21 +117,31 @@ func main() {
 		flag.Usage()
 	}
 
-	key, err := crypto.NewAESKeyFromBase64(base64Key)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error loading the base64-encoded AES-256 key:", err)
-		os.Exit(1)
+	var key *crypto.AES256Key
+	var passphrase []byte
+	var err error
+
+	if usePhrase {
+		if passphrase, err = cli.ReadPassphrase(encrypt); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else {
+		if key, err = crypto.NewAESKeyFromBase64(base64Key); err != nil {
+			fmt.Fprintln(os.Stderr, "Error loading the base64-encoded AES-256 key:", err)
+			os.Exit(1)
+		}
 	}
 
 	var renderedText string
 
 	if encrypt {
-		if renderedText, err = crypto.EncryptStringToBase64(text, key); err != nil {
+		if renderedText, err = encryptText(text, key, passphrase); err != nil {
 			fmt.Fprintln(os.Stderr, "Error encrypting:", err)
 			os.Exit(1)
 		}
 	} else if decrypt {
-		if renderedText, err = crypto.DecryptStringFromBase64(text, key); err != nil {
+		if renderedText, err = decryptText(text, key, passphrase); err != nil {
 			fmt.Fprintln(os.Stderr, "Error decrypting:", err)
 			os.Exit(1)
 		}
@@ -0,0 +1,169 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseAESKey loads a key in any of the supported encodings: hex, standard base64, or URL-safe base64 (each with or
+// without padding). Surrounding whitespace is ignored. The encodings cannot be confused, as each encodes a 256-bit
+// key with a different length or alphabet.
+func ParseAESKey(s string) (*AES256Key, error) {
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("zero-value key string")
+	}
+
+	if len(s) == hex.EncodedLen(AES256KeyLengthInBytes) {
+		return NewAESKeyFromHex(s)
+	}
+
+	if strings.ContainsAny(s, "-_") {
+		return NewAESKeyFromBase64URL(s)
+	}
+
+	keyBytes, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, fmt.Errorf("key is not hex or base64-encoded: %v", err)
+	}
+	defer zeroBytes(keyBytes)
+
+	return newAESKeyFromBytes(keyBytes)
+}
+
+// NewAESKeyFromHex loads the hex-encoded string into a new AES256Key. Surrounding whitespace is ignored.
+func NewAESKeyFromHex(hexKey string) (*AES256Key, error) {
+
+	hexKey = strings.TrimSpace(hexKey)
+	if hexKey == "" {
+		return nil, errors.New("zero-value hex string")
+	}
+
+	keyBytes, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(keyBytes)
+
+	return newAESKeyFromBytes(keyBytes)
+}
+
+// ToHex converts the AES key to a hex-encoded string. This reveals the key material; see AES256Key.
+func (key *AES256Key) ToHex() string {
+
+	if key == nil {
+		return ""
+	}
+
+	return hex.EncodeToString(key[:])
+}
+
+// NewAESKeyFromBase64URL loads the URL-safe base64-encoded string (with or without padding) into a new AES256Key.
+// Surrounding whitespace is ignored.
+func NewAESKeyFromBase64URL(base64Key string) (*AES256Key, error) {
+
+	base64Key = strings.TrimRight(strings.TrimSpace(base64Key), "=")
+	if base64Key == "" {
+		return nil, errors.New("zero-value base64 string")
+	}
+
+	keyBytes, err := base64.RawURLEncoding.DecodeString(base64Key)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(keyBytes)
+
+	return newAESKeyFromBytes(keyBytes)
+}
+
+// ToBase64URL converts the AES key to a URL-safe base64-encoded string without padding (as used by JWK). This reveals
+// the key material; see AES256Key.
+func (key *AES256Key) ToBase64URL() string {
+
+	if key == nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(key[:])
+}
+
+// MarshalText implements encoding.TextMarshaler with a redacted value, like String. A struct holding an AES256Key
+// therefore does not round-trip through JSON (or any other text encoding) by design; use MarshalSecretText to
+// serialize the key.
+func (key AES256Key) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// MarshalSecretText returns the key as standard base64, which UnmarshalText accepts; it is the explicit counterpart
+// of MarshalText for code that writes keys, e.g. a config file. This reveals the key material; see AES256Key.
+func (key *AES256Key) MarshalSecretText() ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to marshal nil key")
+	}
+
+	text := make([]byte, base64.StdEncoding.EncodedLen(AES256KeyLengthInBytes))
+	base64.StdEncoding.Encode(text, key[:])
+	return text, nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting any of the encodings ParseAESKey accepts, so that an
+// AES256Key can be a field of a config struct (or of any struct decoded from JSON).
+func (key *AES256Key) UnmarshalText(text []byte) error {
+
+	parsed, err := ParseAESKey(string(text))
+	if err != nil {
+		return err
+	}
+	defer parsed.Destroy()
+
+	*key = *parsed
+	return nil
+}
+
+// jwk is a JSON Web Key (RFC 7517) of the "oct" (symmetric) key type (RFC 7518, section 6.4).
+type jwk struct {
+	KeyType string `json:"kty"`
+	Key     string `json:"k"`
+	KeyID   string `json:"kid,omitempty"`
+	Alg     string `json:"alg,omitempty"`
+}
+
+const jwkKeyTypeOct = "oct"
+
+// ToJWK converts the AES key to a JSON Web Key of type "oct", with the key's ID as its "kid". This reveals the key
+// material; see AES256Key.
+func (key *AES256Key) ToJWK() ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to marshal nil key")
+	}
+
+	return json.Marshal(&jwk{
+		KeyType: jwkKeyTypeOct,
+		Key:     key.ToBase64URL(),
+		KeyID:   key.ID().String(),
+	})
+}
+
+// NewAESKeyFromJWK loads a JSON Web Key of type "oct" (e.g. from ToJWK) into a new AES256Key. The "kid" and "alg"
+// members are not checked.
+func NewAESKeyFromJWK(jwkJSON []byte) (*AES256Key, error) {
+
+	var k jwk
+	if err := json.Unmarshal(jwkJSON, &k); err != nil {
+		return nil, fmt.Errorf("malformed JWK: %v", err)
+	}
+
+	if k.KeyType != jwkKeyTypeOct {
+		return nil, fmt.Errorf("unsupported JWK key type %q", k.KeyType)
+	}
+
+	// JWK requires unpadded base64url, which NewAESKeyFromBase64URL also accepts
+	return NewAESKeyFromBase64URL(k.Key)
+}
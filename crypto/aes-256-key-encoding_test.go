@@ -0,0 +1,159 @@
+package crypto_test
+
+import (
+	"encoding/json"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const fixedKeyHex = "90db5509bfcfbd790ba24d520f81b04e6637780dadab82b1f79d35797145bd19"
+const fixedKeyBase64URL = "kNtVCb_PvXkLok1SD4GwTmY3eA2tq4Kx9501eXFFvRk"
+
+var _ = Describe("AES256Key encodings", func() {
+	It("encodes the key as hex and URL-safe base64", func() {
+		Expect(fixedKey.ToHex()).To(Equal(fixedKeyHex))
+		Expect(fixedKey.ToBase64URL()).To(Equal(fixedKeyBase64URL))
+
+		var nilKey *crypto.AES256Key
+		Expect(nilKey.ToHex()).To(Equal(""))
+		Expect(nilKey.ToBase64URL()).To(Equal(""))
+	})
+
+	It("decodes hex and URL-safe base64", func() {
+		key, err := crypto.NewAESKeyFromHex(fixedKeyHex)
+		Expect(err).To(BeNil())
+		Expect(*key).To(Equal(fixedKey))
+
+		for _, s := range []string{fixedKeyBase64URL, fixedKeyBase64URL + "=", "  " + fixedKeyBase64URL + "\n"} {
+			key, err = crypto.NewAESKeyFromBase64URL(s)
+			Expect(err).To(BeNil(), s)
+			Expect(*key).To(Equal(fixedKey))
+		}
+
+		_, err = crypto.NewAESKeyFromHex(fixedKeyHex[:62])
+		Expect(err).NotTo(BeNil())
+		_, err = crypto.NewAESKeyFromHex("zz" + fixedKeyHex[2:])
+		Expect(err).NotTo(BeNil())
+		_, err = crypto.NewAESKeyFromBase64URL(fixedKeyBase64)
+		Expect(err).NotTo(BeNil())
+		_, err = crypto.NewAESKeyFromBase64URL("")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("ignores surrounding whitespace in base64 keys", func() {
+		key, err := crypto.NewAESKeyFromBase64(fixedKeyBase64 + "\n")
+		Expect(err).To(BeNil())
+		Expect(*key).To(Equal(fixedKey))
+	})
+
+	Describe("ParseAESKey", func() {
+		It("detects the encoding", func() {
+			for _, s := range []string{
+				fixedKeyHex,
+				"0X" + fixedKeyHex[2:] + "\n",
+				fixedKeyBase64,
+				fixedKeyBase64[:43],
+				fixedKeyBase64URL,
+				fixedKeyBase64URL + "=",
+				" " + fixedKeyBase64 + "\r\n",
+			} {
+				key, err := crypto.ParseAESKey(s)
+				if s == "0X"+fixedKeyHex[2:]+"\n" {
+					Expect(err).NotTo(BeNil())
+					continue
+				}
+				Expect(err).To(BeNil(), s)
+				Expect(*key).To(Equal(fixedKey), s)
+			}
+		})
+
+		It("rejects malformed keys", func() {
+			for _, s := range []string{"", " \n", "bad base64 String", fixedKeyHex[:62], fixedKeyBase64[:40]} {
+				key, err := crypto.ParseAESKey(s)
+				Expect(key).To(BeNil())
+				Expect(err).NotTo(BeNil(), s)
+			}
+		})
+	})
+
+	Describe("TextMarshaler and TextUnmarshaler", func() {
+		type config struct {
+			Name string
+			Key  crypto.AES256Key
+		}
+
+		It("decodes keys embedded in JSON", func() {
+			for _, s := range []string{fixedKeyBase64, fixedKeyHex, fixedKeyBase64URL} {
+				var c config
+				Expect(json.Unmarshal([]byte(`{"Name": "test", "Key": "`+s+`"}`), &c)).To(Succeed())
+				Expect(c.Key).To(Equal(fixedKey))
+			}
+
+			var c config
+			Expect(json.Unmarshal([]byte(`{"Key": "not a key"}`), &c)).NotTo(Succeed())
+		})
+
+		It("redacts the key when marshaled", func() {
+			text, err := fixedKey.MarshalText()
+			Expect(err).To(BeNil())
+			Expect(string(text)).To(Equal("REDACTED"))
+
+			// a redacted key cannot be mistaken for a real one
+			var c config
+			b, err := json.Marshal(config{Key: fixedKey})
+			Expect(err).To(BeNil())
+			Expect(json.Unmarshal(b, &c)).NotTo(Succeed())
+		})
+
+		It("round-trips the key through MarshalSecretText", func() {
+			text, err := fixedKey.MarshalSecretText()
+			Expect(err).To(BeNil())
+			Expect(string(text)).To(Equal(fixedKeyBase64))
+
+			var key crypto.AES256Key
+			Expect(key.UnmarshalText(text)).To(Succeed())
+			Expect(key).To(Equal(fixedKey))
+
+			var nilKey *crypto.AES256Key
+			_, err = nilKey.MarshalSecretText()
+			Expect(err).NotTo(BeNil())
+		})
+	})
+
+	Describe("JWK", func() {
+		It("round-trips the key as an oct JWK", func() {
+			jwk, err := fixedKey.ToJWK()
+			Expect(err).To(BeNil())
+			Expect(string(jwk)).To(MatchJSON(`{"kty": "oct", "k": "` + fixedKeyBase64URL + `", "kid": "` + fixedKey.ID().String() + `"}`))
+
+			key, err := crypto.NewAESKeyFromJWK(jwk)
+			Expect(err).To(BeNil())
+			Expect(*key).To(Equal(fixedKey))
+		})
+
+		It("accepts JWKs produced elsewhere", func() {
+			key, err := crypto.NewAESKeyFromJWK([]byte(`{"kty":"oct","alg":"A256GCM","use":"enc","k":"` + fixedKeyBase64URL + `"}`))
+			Expect(err).To(BeNil())
+			Expect(*key).To(Equal(fixedKey))
+		})
+
+		It("rejects other key types and malformed JWKs", func() {
+			for _, s := range []string{
+				``,
+				`{"kty":"RSA","k":"` + fixedKeyBase64URL + `"}`,
+				`{"kty":"oct"}`,
+				`{"kty":"oct","k":"` + fixedKeyBase64URL[:40] + `"}`,
+			} {
+				key, err := crypto.NewAESKeyFromJWK([]byte(s))
+				Expect(key).To(BeNil())
+				Expect(err).NotTo(BeNil(), s)
+			}
+
+			var nilKey *crypto.AES256Key
+			_, err := nilKey.ToJWK()
+			Expect(err).NotTo(BeNil())
+		})
+	})
+})
@@ -3,17 +3,28 @@ package crypto
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/gtank/cryptopasta"
+	"go.uber.org/zap/zapcore"
 )
 
 // AES256KeyLengthInBytes is the length, in bytes, of a 256-bit AES key
 const AES256KeyLengthInBytes = 32
 
-// AES256Key represents a 256-bit AES key
+// AES256Key represents a 256-bit AES key.
+//
+// To keep the key material out of logs, an AES256Key redacts itself when formatted (with any fmt verb), marshaled
+// to JSON or text, or logged with zap; only its ID is shown. ToBase64 (or ToHex, ToBase64URL and ToJWK) is the
+// explicit way to reveal the key, e.g. to store it. A struct holding an AES256Key can be decoded from JSON or text
+// (see UnmarshalText) but is deliberately not encoded back with the key; see MarshalSecretText. Call Destroy once the
+// key is no longer needed.
 type AES256Key [AES256KeyLengthInBytes]byte
 
 var zeroKey = AES256Key{}
@@ -24,9 +35,27 @@ func NewRandomAESKey() *AES256Key {
 	return (*AES256Key)(cryptopasta.NewEncryptionKey())
 }
 
-// NewAESKeyFromBase64 loads the base64-encoded string into the current AES256Key.
+// NewAESKeyFromReader returns a 256-bit AES key read from r. It is meant for tests that need reproducible keys (e.g.
+// with cryptotest.NewDeterministicReader); use NewRandomAESKey for real keys.
+func NewAESKeyFromReader(r io.Reader) (*AES256Key, error) {
+
+	if r == nil {
+		return nil, errors.New("tried to read key from nil reader")
+	}
+
+	key := &AES256Key{}
+	if _, err := io.ReadFull(r, key[:]); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// NewAESKeyFromBase64 loads the base64-encoded string into the current AES256Key. Surrounding whitespace (e.g. a
+// trailing newline from a mounted secret) is ignored; see ParseAESKey for other encodings.
 func NewAESKeyFromBase64(base64Key string) (*AES256Key, error) {
 
+	base64Key = strings.TrimSpace(base64Key)
 	if base64Key == "" {
 		return nil, errors.New("zero-value base64 string")
 	}
@@ -36,6 +65,12 @@ func NewAESKeyFromBase64(base64Key string) (*AES256Key, error) {
 		return nil, err
 	}
 
+	return newAESKeyFromBytes(keyBytes)
+}
+
+// newAESKeyFromBytes copies the key material into a new AES256Key.
+func newAESKeyFromBytes(keyBytes []byte) (*AES256Key, error) {
+
 	if len(keyBytes) != AES256KeyLengthInBytes {
 		return nil, fmt.Errorf("expected key length to be %d, was %d", AES256KeyLengthInBytes, len(keyBytes))
 	}
@@ -45,7 +80,7 @@ func NewAESKeyFromBase64(base64Key string) (*AES256Key, error) {
 	return key, nil
 }
 
-// ToBase64 converts the AES key to a base64-encoded string.
+// ToBase64 converts the AES key to a base64-encoded string. This reveals the key material; see AES256Key.
 func (key *AES256Key) ToBase64() string {
 
 	if key == nil {
@@ -55,8 +90,58 @@ func (key *AES256Key) ToBase64() string {
 	return base64.StdEncoding.EncodeToString(key[:])
 }
 
+// ID returns the key's identifier, which is recorded in the header of every ciphertext produced with the key.
+// The ID is derived from the key with HMAC-SHA256 and does not reveal the key.
+func (key *AES256Key) ID() KeyID {
+
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte("go-util-helpers key id"))
+
+	var id KeyID
+	copy(id[:], mac.Sum(nil))
+	return id
+}
+
 // Equal returns a boolean reporting whether a and b are the same length and contain the same bytes.
 // A nil argument is equivalent to an empty slice.
 func Equal(k1, k2 *AES256Key) bool {
 	return bytes.Equal(k1[:], k2[:])
 }
+
+const redacted = "REDACTED"
+
+// String returns a redacted description of the key that includes its ID, but not the key material.
+func (key AES256Key) String() string {
+	return fmt.Sprintf("AES256Key(%s, id=%v)", redacted, key.ID())
+}
+
+// GoString is like String; it is used by the %#v verb.
+func (key AES256Key) GoString() string {
+	return key.String()
+}
+
+// Format writes the redacted description of the key (see String) for every verb, including %x and %d, which would
+// otherwise print the key's bytes.
+func (key AES256Key) Format(f fmt.State, verb rune) {
+	io.WriteString(f, key.String())
+}
+
+// MarshalJSON returns a redacted JSON string; use ToBase64 to serialize the key.
+func (key AES256Key) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// MarshalLogObject logs the key's ID but not the key material, when logged with zap (e.g. via zap.Any).
+func (key AES256Key) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("id", key.ID().String())
+	enc.AddString("key", redacted)
+	return nil
+}
+
+// Destroy zeroes the key material; the key must not be used afterwards. Note that copies of the key (e.g. made by
+// assigning an AES256Key value) are not affected.
+func (key *AES256Key) Destroy() {
+	if key != nil {
+		zeroBytes(key[:])
+	}
+}
@@ -1,11 +1,18 @@
 package crypto_test
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/bit-mancer/go-util-helpers/crypto"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var _ = Describe("AES256Key", func() {
@@ -71,6 +78,78 @@ var _ = Describe("AES256Key", func() {
 		})
 	})
 
+	Describe("AES256Key.ID", func() {
+		It("is stable for a key and differs between keys", func() {
+			key := fixedKey
+			Expect(key.ID()).To(Equal(fixedKey.ID()))
+			Expect(crypto.NewRandomAESKey().ID()).NotTo(Equal(fixedKey.ID()))
+		})
+
+		It("does not contain the key material", func() {
+			id := fixedKey.ID()
+			Expect(id[:]).NotTo(Equal(fixedKey[:len(id)]))
+		})
+	})
+
+	Describe("redaction", func() {
+		leaks := func(s string) bool {
+			return strings.Contains(s, fixedKeyBase64) ||
+				strings.Contains(strings.ToLower(s), hex.EncodeToString(fixedKey[:4])) ||
+				strings.Contains(s, fmt.Sprint(fixedKey[:4])[1:8])
+		}
+
+		It("redacts the key for every fmt verb", func() {
+			key := fixedKey
+
+			for _, format := range []string{"%v", "%+v", "%#v", "%s", "%x", "%X", "%d", "%q"} {
+				for _, arg := range []interface{}{key, &key, struct{ Key crypto.AES256Key }{key}, []*crypto.AES256Key{&key}} {
+					s := fmt.Sprintf(format, arg)
+					Expect(leaks(s)).To(Equal(false), "%s: %s", format, s)
+				}
+			}
+
+			Expect(key.String()).To(ContainSubstring("REDACTED"))
+			Expect(key.String()).To(ContainSubstring(key.ID().String()))
+		})
+
+		It("redacts the key when marshaled to JSON", func() {
+			key := fixedKey
+
+			b, err := json.Marshal(struct {
+				Key    crypto.AES256Key
+				KeyPtr *crypto.AES256Key
+			}{key, &key})
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(Equal(`{"Key":"REDACTED","KeyPtr":"REDACTED"}`))
+		})
+
+		It("redacts the key when logged with zap", func() {
+			var buf bytes.Buffer
+			core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.DebugLevel)
+			logger := zap.New(core)
+
+			key := fixedKey
+			logger.Info("test", zap.Any("key", key), zap.Any("keyPtr", &key), zap.Object("keyObject", key))
+			Expect(logger.Sync()).To(Succeed())
+
+			Expect(buf.String()).To(ContainSubstring(key.ID().String()))
+			Expect(leaks(buf.String())).To(Equal(false), buf.String())
+		})
+	})
+
+	Describe("AES256Key.Destroy", func() {
+		It("zeroes the key material", func() {
+			key := crypto.NewRandomAESKey()
+			key.Destroy()
+			Expect(*key).To(Equal(crypto.AES256Key{}))
+		})
+
+		It("works on a nil receiver", func() {
+			var nilKey *crypto.AES256Key
+			nilKey.Destroy()
+		})
+	})
+
 	Describe("Equal(k1, k2 *AES256Key)", func() {
 		It("compares the equality of two keys", func() {
 			key1 := crypto.NewRandomAESKey()
@@ -0,0 +1,360 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Armored ciphertexts are text that survives being pasted into an email or a ticket, in the style of OpenPGP's ASCII
+// armor (RFC 4880, section 6.2):
+//
+//	-----BEGIN GO-UTIL-HELPERS CIPHERTEXT-----
+//	Version: 1
+//	Cipher: AES-256-GCM
+//	Key-ID: 1b4f0e9851971998
+//
+//	R1VIQwEBAB... (base64, wrapped at 64 characters)
+//	=x7Pa
+//	-----END GO-UTIL-HELPERS CIPHERTEXT-----
+//
+// The header lines are informational (the ciphertext's own header is authoritative), and are omitted for legacy,
+// headerless ciphertexts. The line starting with "=" is a CRC-24 of the ciphertext, so that truncated or mangled
+// armor is reported as such rather than as a decryption failure.
+
+const (
+	armorBegin      = "-----BEGIN GO-UTIL-HELPERS CIPHERTEXT-----"
+	armorEnd        = "-----END GO-UTIL-HELPERS CIPHERTEXT-----"
+	armorLineLength = 64
+)
+
+// Armor returns the ciphertext (e.g. from Encrypt) in the armored format.
+func Armor(ciphertext []byte) []byte {
+
+	var buf bytes.Buffer
+
+	w := NewArmoringWriter(&buf)
+	w.Write(ciphertext)
+	w.Close()
+
+	return buf.Bytes()
+}
+
+// Dearmor returns the ciphertext from armored data (e.g. from Armor). Text before the BEGIN line and after the END
+// line is ignored.
+func Dearmor(armored []byte) ([]byte, error) {
+
+	r, err := NewDearmoringReader(bytes.NewReader(armored))
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(r)
+}
+
+// IsArmored reports whether the data contains armored data (see Armor).
+func IsArmored(data []byte) bool {
+	return bytes.Contains(data, []byte(armorBegin))
+}
+
+// armorHeaders returns the header lines describing the ciphertext that starts with prefix.
+func armorHeaders(prefix []byte) []string {
+
+	if len(prefix) < headerLength || !HasHeader(prefix) {
+		return nil
+	}
+
+	var id KeyID
+	copy(id[:], prefix[7:headerLength])
+
+	return []string{
+		"Version: " + strconv.Itoa(int(prefix[4])),
+		"Cipher: " + CipherID(prefix[5]).String(),
+		"Key-ID: " + id.String(),
+	}
+}
+
+// NewArmoringWriter returns an io.WriteCloser that writes everything written to it (e.g. by an encrypting writer) to
+// w in the armored format (see Armor). Close must be called to write the checksum and END line; it does not close w.
+func NewArmoringWriter(w io.Writer) io.WriteCloser {
+	return &armoringWriter{w: w, crc: crc24Init}
+}
+
+type armoringWriter struct {
+	w       io.Writer
+	prefix  []byte // buffered until the header lines are known
+	started bool
+	lines   *lineWrapper
+	encoder io.WriteCloser
+	crc     uint32
+	closed  bool
+}
+
+func (aw *armoringWriter) Write(p []byte) (int, error) {
+
+	if aw.closed {
+		return 0, errors.New("write to closed armoring writer")
+	}
+
+	if !aw.started {
+		aw.prefix = append(aw.prefix, p...)
+		if len(aw.prefix) < headerLength {
+			return len(p), nil
+		}
+
+		if err := aw.start(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	aw.crc = crc24Update(aw.crc, p)
+	return aw.encoder.Write(p)
+}
+
+// start writes the BEGIN and header lines, and the buffered prefix.
+func (aw *armoringWriter) start() error {
+
+	aw.started = true
+
+	lines := append([]string{armorBegin}, armorHeaders(aw.prefix)...)
+	if _, err := io.WriteString(aw.w, strings.Join(lines, "\n")+"\n\n"); err != nil {
+		return err
+	}
+
+	aw.lines = &lineWrapper{w: aw.w}
+	aw.encoder = base64.NewEncoder(base64.StdEncoding, aw.lines)
+
+	prefix := aw.prefix
+	aw.prefix = nil
+
+	aw.crc = crc24Update(aw.crc, prefix)
+	_, err := aw.encoder.Write(prefix)
+	return err
+}
+
+func (aw *armoringWriter) Close() error {
+
+	if aw.closed {
+		return nil
+	}
+
+	if !aw.started {
+		if err := aw.start(); err != nil {
+			return err
+		}
+	}
+
+	aw.closed = true
+
+	if err := aw.encoder.Close(); err != nil {
+		return err
+	}
+
+	if aw.lines.column > 0 {
+		if _, err := io.WriteString(aw.w, "\n"); err != nil {
+			return err
+		}
+	}
+
+	crc := []byte{byte(aw.crc >> 16), byte(aw.crc >> 8), byte(aw.crc)}
+	_, err := io.WriteString(aw.w, "="+base64.StdEncoding.EncodeToString(crc)+"\n"+armorEnd+"\n")
+	return err
+}
+
+// lineWrapper writes base64 to w in lines of armorLineLength characters.
+type lineWrapper struct {
+	w      io.Writer
+	column int
+}
+
+func (lw *lineWrapper) Write(p []byte) (int, error) {
+
+	written := 0
+	for len(p) > 0 {
+		n := armorLineLength - lw.column
+		if n > len(p) {
+			n = len(p)
+		}
+
+		if _, err := lw.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+
+		written += n
+		lw.column += n
+		p = p[n:]
+
+		if lw.column == armorLineLength {
+			if _, err := io.WriteString(lw.w, "\n"); err != nil {
+				return written, err
+			}
+			lw.column = 0
+		}
+	}
+
+	return written, nil
+}
+
+// NewDearmoringReader returns an io.Reader that reads the ciphertext from armored data read from r (see Armor and
+// NewArmoringWriter), e.g. for NewDecryptingReader. Text before the BEGIN line is skipped. Reads return an error if
+// the armor is truncated or its checksum does not match.
+func NewDearmoringReader(r io.Reader) (io.Reader, error) {
+
+	ar := &dearmoringReader{r: bufio.NewReader(r), crc: crc24Init}
+
+	for {
+		line, err := ar.readLine()
+		if line == armorBegin {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("no armored data found")
+		}
+	}
+
+	// skip the header lines, up to the blank line
+	for {
+		line, err := ar.readLine()
+		if err != nil {
+			return nil, errors.New("armored data is truncated")
+		}
+
+		if line == "" {
+			break
+		}
+
+		if !strings.Contains(line, ":") {
+			// no header lines or blank line; the body has begun
+			ar.firstLine = line
+			break
+		}
+	}
+
+	return ar, nil
+}
+
+type dearmoringReader struct {
+	r         *bufio.Reader
+	firstLine string
+	encoded   []byte // base64 not yet decoded, less than a quantum
+	decoded   []byte // decoded but not yet read
+	crc       uint32
+	err       error
+}
+
+// readLine returns the next line, without surrounding whitespace.
+func (ar *dearmoringReader) readLine() (string, error) {
+
+	line, err := ar.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+
+	return strings.TrimSpace(line), err
+}
+
+func (ar *dearmoringReader) Read(p []byte) (int, error) {
+
+	for len(ar.decoded) == 0 && ar.err == nil {
+		ar.err = ar.readBodyLine()
+	}
+
+	if len(ar.decoded) > 0 {
+		n := copy(p, ar.decoded)
+		ar.decoded = ar.decoded[n:]
+		return n, nil
+	}
+
+	return 0, ar.err
+}
+
+// readBodyLine decodes the next line of the body, returning io.EOF once the checksum and END line have been read.
+func (ar *dearmoringReader) readBodyLine() error {
+
+	line := ar.firstLine
+	ar.firstLine = ""
+
+	if line == "" {
+		var err error
+		if line, err = ar.readLine(); err != nil {
+			return errors.New("armored data is truncated")
+		}
+	}
+
+	if strings.HasPrefix(line, "=") {
+		return ar.readChecksum(line[1:])
+	}
+
+	if line == armorEnd {
+		return errors.New("armored data has no checksum")
+	}
+
+	ar.encoded = append(ar.encoded, line...)
+
+	n := len(ar.encoded) / 4 * 4
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(n))
+
+	written, err := base64.StdEncoding.Decode(decoded, ar.encoded[:n])
+	if err != nil {
+		return fmt.Errorf("malformed armored data: %v", err)
+	}
+
+	ar.encoded = append(ar.encoded[:0], ar.encoded[n:]...)
+	ar.decoded = decoded[:written]
+	ar.crc = crc24Update(ar.crc, ar.decoded)
+	return nil
+}
+
+func (ar *dearmoringReader) readChecksum(encoded string) error {
+
+	if len(ar.encoded) != 0 {
+		return errors.New("malformed armored data: truncated base64")
+	}
+
+	crc, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(crc) != 3 {
+		return errors.New("malformed armored data checksum")
+	}
+
+	if uint32(crc[0])<<16|uint32(crc[1])<<8|uint32(crc[2]) != ar.crc {
+		return errors.New("armored data checksum mismatch; the data was altered or truncated")
+	}
+
+	for {
+		line, err := ar.readLine()
+		if line == armorEnd {
+			return io.EOF
+		}
+		if line != "" || err != nil {
+			return errors.New("armored data has no END line")
+		}
+	}
+}
+
+// CRC-24 as specified by RFC 4880, section 6.1.
+const (
+	crc24Init = 0xb704ce
+	crc24Poly = 0x1864cfb
+)
+
+func crc24Update(crc uint32, data []byte) uint32 {
+
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+
+	return crc & 0xffffff
+}
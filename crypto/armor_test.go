@@ -0,0 +1,155 @@
+package crypto_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Armor", func() {
+	It("armors ciphertexts with header lines, wrapped base64 and a checksum", func() {
+		ciphertext, err := crypto.Encrypt(bytes.Repeat([]byte("test "), 100), &fixedKey)
+		Expect(err).To(BeNil())
+
+		armored := string(crypto.Armor(ciphertext))
+		lines := strings.Split(strings.TrimSuffix(armored, "\n"), "\n")
+
+		Expect(lines[0]).To(Equal("-----BEGIN GO-UTIL-HELPERS CIPHERTEXT-----"))
+		Expect(lines[1:5]).To(Equal([]string{"Version: 1", "Cipher: AES-256-GCM", "Key-ID: " + fixedKey.ID().String(), ""}))
+		Expect(lines[len(lines)-1]).To(Equal("-----END GO-UTIL-HELPERS CIPHERTEXT-----"))
+		Expect(lines[len(lines)-2]).To(MatchRegexp(`^=[A-Za-z0-9+/]{4}$`))
+
+		for _, line := range lines[5 : len(lines)-2] {
+			Expect(len(line)).To(BeNumerically("<=", 64))
+		}
+		Expect(lines[5]).To(HaveLen(64))
+
+		dearmored, err := crypto.Dearmor([]byte(armored))
+		Expect(err).To(BeNil())
+		Expect(dearmored).To(Equal(ciphertext))
+		Expect(crypto.IsArmored([]byte(armored))).To(Equal(true))
+		Expect(crypto.IsArmored(ciphertext)).To(Equal(false))
+	})
+
+	It("uses the OpenPGP CRC-24", func() {
+		armored := string(crypto.Armor([]byte("123456789")))
+		Expect(armored).To(ContainSubstring("\n=Ic8C\n"))
+	})
+
+	It("round-trips data of every length, including data without a header", func() {
+		for n := 0; n < 200; n++ {
+			data := bytes.Repeat([]byte{byte(n)}, n)
+
+			dearmored, err := crypto.Dearmor(crypto.Armor(data))
+			Expect(err).To(BeNil())
+			Expect(dearmored).To(HaveLen(n))
+			Expect(bytes.Equal(dearmored, data)).To(Equal(true))
+		}
+	})
+
+	It("tolerates surrounding text, CRLF line endings, indentation and rewrapped lines", func() {
+		ciphertext, err := crypto.EncryptWithAAD([]byte("test"), nil, &fixedKey)
+		Expect(err).To(BeNil())
+
+		armored := string(crypto.Armor(bytes.Repeat(ciphertext, 3)))
+		lines := strings.Split(armored, "\n")
+
+		// rewrap the body at 30 characters
+		var body string
+		for _, line := range lines[5 : len(lines)-3] {
+			body += line
+		}
+		var rewrapped []string
+		for len(body) > 30 {
+			rewrapped = append(rewrapped, body[:30])
+			body = body[30:]
+		}
+		rewrapped = append(rewrapped, body)
+
+		mangled := "Hi, here is the secret:\r\n\r\n" +
+			"  " + strings.Join(lines[:5], "\r\n  ") + "\r\n  " +
+			strings.Join(rewrapped, "\r\n  ") + "\r\n  " +
+			strings.Join(lines[len(lines)-3:], "\r\n  ") + "Thanks!\r\n"
+
+		dearmored, err := crypto.Dearmor([]byte(mangled))
+		Expect(err).To(BeNil())
+		Expect(dearmored).To(Equal(bytes.Repeat(ciphertext, 3)))
+	})
+
+	It("accepts armor without header lines", func() {
+		armored := strings.Replace(string(crypto.Armor([]byte("no header"))), "-----\n\n", "-----\n", 1)
+
+		dearmored, err := crypto.Dearmor([]byte(armored))
+		Expect(err).To(BeNil())
+		Expect(dearmored).To(Equal([]byte("no header")))
+	})
+
+	It("detects truncated and altered armor", func() {
+		ciphertext, err := crypto.Encrypt(bytes.Repeat([]byte("test "), 100), &fixedKey)
+		Expect(err).To(BeNil())
+
+		armored := string(crypto.Armor(ciphertext))
+		lines := strings.Split(armored, "\n")
+		checksum := len(lines) - 3
+
+		for _, bad := range []string{
+			"",
+			"not armored",
+			strings.Join(lines[:3], "\n"),
+			// missing body lines
+			strings.Join(append(append([]string{}, lines[:6]...), lines[checksum:]...), "\n"),
+			// a missing END line
+			strings.Join(lines[:checksum+1], "\n"),
+			// a missing checksum
+			strings.Join(append(append([]string{}, lines[:checksum]...), lines[checksum+1:]...), "\n"),
+			// an altered body
+			strings.Replace(armored, lines[6], strings.ToUpper(lines[6]), 1),
+			// an altered checksum
+			strings.Replace(armored, lines[checksum], "=AAAA", 1),
+			strings.Replace(armored, lines[checksum], "=AAAAAA", 1),
+			// malformed base64
+			strings.Replace(armored, lines[6], "!"+lines[6][1:], 1),
+		} {
+			_, err := crypto.Dearmor([]byte(bad))
+			Expect(err).NotTo(BeNil(), bad)
+		}
+	})
+
+	It("armors and dearmors streams", func() {
+		plaintext := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+
+		var armored bytes.Buffer
+		aw := crypto.NewArmoringWriter(&armored)
+
+		w, err := crypto.NewEncryptingWriter(aw, &fixedKey)
+		Expect(err).To(BeNil())
+
+		// write in small pieces, so that the header arrives in parts
+		for i := 0; i < len(plaintext); i += 7 {
+			end := i + 7
+			if end > len(plaintext) {
+				end = len(plaintext)
+			}
+			_, err := w.Write(plaintext[i:end])
+			Expect(err).To(BeNil())
+		}
+		Expect(w.Close()).To(Succeed())
+		Expect(aw.Close()).To(Succeed())
+
+		Expect(armored.String()).To(ContainSubstring("Key-ID: " + fixedKey.ID().String()))
+
+		ar, err := crypto.NewDearmoringReader(&armored)
+		Expect(err).To(BeNil())
+
+		r, err := crypto.NewDecryptingReader(ar, &fixedKey)
+		Expect(err).To(BeNil())
+
+		decrypted, err := ioutil.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(decrypted).To(Equal(plaintext))
+	})
+})
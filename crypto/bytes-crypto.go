@@ -1,27 +1,206 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"errors"
+	"io"
 
 	"github.com/gtank/cryptopasta"
 )
 
 // Encrypt encrypts the plaintext with the provided key and returns the result.
 func Encrypt(plaintext []byte, key *AES256Key) ([]byte, error) {
+	return EncryptWithAAD(plaintext, nil, key)
+}
+
+// Decrypt decrypts the ciphertext with the provided key and returns the result.
+// Legacy ciphertexts without a header (i.e. bare cryptopasta output) are also accepted.
+func Decrypt(ciphertext []byte, key *AES256Key) ([]byte, error) {
+	return DecryptWithAAD(ciphertext, nil, key)
+}
+
+// EncryptWithAAD encrypts the plaintext with the provided key and returns the result. The additional data (e.g. a
+// row ID, tenant or field name) is authenticated but not encrypted or stored: the ciphertext is bound to it, and
+// will only decrypt when the same additional data is provided to DecryptWithAAD.
+func EncryptWithAAD(plaintext []byte, additionalData []byte, key *AES256Key) ([]byte, error) {
+	return EncryptWithOptions(plaintext, key, EncryptOptions{AdditionalData: additionalData})
+}
+
+// EncryptOptions are the options for EncryptWithOptions and NewEncryptingWriterWithOptions; the zero value selects
+// the defaults.
+type EncryptOptions struct {
+	// Cipher is the cipher to encrypt with (DefaultCipher if zero).
+	Cipher CipherID
+	// AdditionalData is authenticated but not encrypted or stored (see EncryptWithAAD).
+	AdditionalData []byte
+	// Compression compresses the plaintext before it is encrypted (not compressed if zero). Compression reveals
+	// information about the plaintext through the ciphertext's length; see Compression before enabling it.
+	Compression Compression
+	// UsageCounter counts the encryption against the key's usage limit; if nil, the registered counter is used (see
+	// RegisterUsageCounter). Streams do not use up the key, and are not counted.
+	UsageCounter *UsageCounter
+	// Rand is the source of the random nonces, stream salts and envelope data keys (crypto/rand if nil). Set it only
+	// in tests that need reproducible ciphertexts (see cryptotest.NewDeterministicReader): a nonce that repeats under
+	// the same key breaks the encryption.
+	Rand io.Reader
+}
+
+// random returns the source of randomness selected by the options.
+func (options EncryptOptions) random() io.Reader {
+
+	if options.Rand == nil {
+		return rand.Reader
+	}
+
+	return options.Rand
+}
+
+// EncryptWithOptions encrypts the plaintext with the provided key and options, and returns the result. The cipher and
+// compression are recorded in the ciphertext, so Decrypt (or DecryptWithAAD) needs no options.
+func EncryptWithOptions(plaintext []byte, key *AES256Key, options EncryptOptions) ([]byte, error) {
 
 	if key == nil {
 		return nil, errors.New("tried to encrypt with nil key")
 	}
 
-	return cryptopasta.Encrypt(plaintext, (*[AES256KeyLengthInBytes]byte)(key))
+	c, err := selectCipher(options.Cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	if c == CipherAES256GCM {
+		if uc := usageCounterFor(options); uc != nil {
+			if err := uc.use(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	h := newHeader(c, 0, key)
+
+	if options.Compression != CompressionNone {
+		if plaintext, err = compress(options.Compression, plaintext); err != nil {
+			return nil, err
+		}
+
+		h.Flags |= FlagCompressed
+		h.Compression = options.Compression
+	}
+
+	return seal(h, key, plaintext, options.AdditionalData, options.random())
 }
 
-// Decrypt decrypts the ciphertext with the provided key and returns the result.
-func Decrypt(ciphertext []byte, key *AES256Key) ([]byte, error) {
+// DecryptWithAAD decrypts the ciphertext with the provided key and returns the result. The additional data must match
+// the additional data provided to EncryptWithAAD.
+// Legacy ciphertexts without a header are only accepted when there is no additional data, as they cannot be bound
+// to any.
+func DecryptWithAAD(ciphertext []byte, additionalData []byte, key *AES256Key) ([]byte, error) {
 
 	if key == nil {
 		return nil, errors.New("tried to decrypt with nil key")
 	}
 
+	if !HasHeader(ciphertext) {
+		return decryptLegacy(ciphertext, additionalData, key)
+	}
+
+	plaintext, err := open(ciphertext, additionalData, resolveWithKey(key))
+	if err != nil {
+		// a legacy ciphertext starts with a random nonce, which will (rarely) look like a header
+		if legacyPlaintext, legacyErr := decryptLegacy(ciphertext, additionalData, key); legacyErr == nil {
+			return legacyPlaintext, nil
+		}
+		return nil, err
+	}
+
+	return plaintext, nil
+}
+
+func decryptLegacy(ciphertext []byte, additionalData []byte, key *AES256Key) ([]byte, error) {
+
+	if len(additionalData) != 0 {
+		return nil, errors.New("legacy ciphertext cannot be bound to additional data")
+	}
+
 	return cryptopasta.Decrypt(ciphertext, (*[AES256KeyLengthInBytes]byte)(key))
 }
+
+func newGCM(key *AES256Key) (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal writes the header, a nonce read from random, and the plaintext sealed with the header's cipher; the header and
+// the caller's additional data are authenticated as the AEAD additional data.
+func seal(h *Header, key *AES256Key, plaintext []byte, additionalData []byte, random io.Reader) ([]byte, error) {
+
+	aead, err := newAEAD(h.Cipher, key)
+	if err != nil {
+		return nil, err
+	}
+
+	rawHeader := h.marshal()
+
+	out := make([]byte, len(rawHeader)+aead.NonceSize(), len(rawHeader)+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(out, rawHeader)
+
+	nonce := out[len(rawHeader):]
+	if _, err := io.ReadFull(random, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(out, nonce, plaintext, aeadAdditionalData(rawHeader, additionalData)), nil
+}
+
+// open reads the header, and opens the sealed plaintext with the key returned by resolveKey.
+func open(ciphertext []byte, additionalData []byte, resolveKey keyResolver) ([]byte, error) {
+
+	h, rawHeader, err := readHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Flags&FlagStream != 0 {
+		return nil, errors.New("ciphertext is an encrypted stream; use NewDecryptingReader")
+	}
+
+	if h.Cipher == CipherAES256SIV {
+		return nil, errors.New("ciphertext is deterministically encrypted; use DecryptDeterministic")
+	}
+
+	key, err := resolveKey(h)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(h.Cipher, key)
+	if err != nil {
+		return nil, err
+	}
+
+	body := ciphertext[len(rawHeader):]
+	if len(body) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("malformed ciphertext")
+	}
+
+	plaintext, err := aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], aeadAdditionalData(rawHeader, additionalData))
+	if err != nil || h.Flags&FlagCompressed == 0 {
+		return plaintext, err
+	}
+
+	return decompress(h.Compression, plaintext)
+}
+
+// aeadAdditionalData concatenates the raw header and the caller's additional data; as the header is self-delimiting,
+// the concatenation is unambiguous.
+func aeadAdditionalData(rawHeader []byte, additionalData []byte) []byte {
+	return append(append(make([]byte, 0, len(rawHeader)+len(additionalData)), rawHeader...), additionalData...)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 
 	"github.com/bit-mancer/go-util-helpers/crypto"
+	"github.com/gtank/cryptopasta"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -41,9 +42,82 @@ var _ = Describe("Decrypt", func() {
 		Expect(err).NotTo(BeNil())
 	})
 
+	It("decrypts legacy ciphertexts that have no header", func() {
+		plaintext := []byte("test")
+		ciphertext, err := cryptopasta.Encrypt(plaintext, (*[32]byte)(&fixedKey))
+		Expect(err).To(BeNil())
+
+		plaintext2, err := crypto.Decrypt(ciphertext, &fixedKey)
+		Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+		Expect(err).To(BeNil())
+	})
+
+	It("rejects ciphertexts encrypted with a different key", func() {
+		ciphertext, err := crypto.Encrypt([]byte("test"), crypto.NewRandomAESKey())
+		Expect(err).To(BeNil())
+
+		plaintext, err := crypto.Decrypt(ciphertext, &fixedKey)
+		Expect(plaintext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("rejects encrypted streams", func() {
+		plaintext, err := crypto.Decrypt(encryptStream([]byte("test"), &fixedKey), &fixedKey)
+		Expect(plaintext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
 	It("requires a valid key", func() {
 		plaintext, err := crypto.Decrypt([]byte("test"), nil)
 		Expect(bytes.Equal(plaintext, []byte(""))).To(Equal(true))
 		Expect(err).NotTo(BeNil())
 	})
 })
+
+var _ = Describe("EncryptWithAAD / DecryptWithAAD", func() {
+	It("binds the ciphertext to the additional data", func() {
+		plaintext := []byte("test")
+		ciphertext, err := crypto.EncryptWithAAD(plaintext, []byte("row 1"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		plaintext2, err := crypto.DecryptWithAAD(ciphertext, []byte("row 1"), &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+
+		plaintext2, err = crypto.DecryptWithAAD(ciphertext, []byte("row 2"), &fixedKey)
+		Expect(plaintext2).To(BeNil())
+		Expect(err).NotTo(BeNil())
+
+		plaintext2, err = crypto.Decrypt(ciphertext, &fixedKey)
+		Expect(plaintext2).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("is equivalent to Encrypt / Decrypt without additional data", func() {
+		ciphertext, err := crypto.Encrypt([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		plaintext, err := crypto.DecryptWithAAD(ciphertext, nil, &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+
+		_, err = crypto.DecryptWithAAD(ciphertext, []byte("row 1"), &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("does not bind legacy ciphertexts to additional data", func() {
+		ciphertext, err := cryptopasta.Encrypt([]byte("test"), (*[32]byte)(&fixedKey))
+		Expect(err).To(BeNil())
+
+		_, err = crypto.DecryptWithAAD(ciphertext, []byte("row 1"), &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires a valid key", func() {
+		_, err := crypto.EncryptWithAAD([]byte("test"), []byte("row 1"), nil)
+		Expect(err).NotTo(BeNil())
+
+		_, err = crypto.DecryptWithAAD([]byte("test"), []byte("row 1"), nil)
+		Expect(err).NotTo(BeNil())
+	})
+})
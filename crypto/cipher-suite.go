@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// DefaultCipher is the cipher used when none is selected (see EncryptOptions).
+const DefaultCipher = CipherAES256GCM
+
+// The randomized ciphers are interchangeable: all of them take an AES256Key, and Decrypt reads the cipher from the
+// ciphertext's header. AES-256-GCM is the default, and what older versions produced; with 96-bit random nonces, a
+// key should not encrypt more than about 2^32 messages. XChaCha20-Poly1305's 192-bit nonces remove that limit, and
+// AES-256-GCM-SIV tolerates a repeated nonce (e.g. from a faulty random source) without a catastrophic loss of
+// security.
+//
+// The non-default ciphers use a subkey derived from the caller's key (see AES256Key.Derive), so that one key is
+// never used directly with more than one algorithm.
+
+// ParseCipher returns the CipherID named by s (e.g. "xchacha20-poly1305"), case-insensitively.
+func ParseCipher(s string) (CipherID, error) {
+
+	for _, c := range []CipherID{CipherAES256GCM, CipherXChaCha20Poly1305, CipherAES256GCMSIV} {
+		if strings.EqualFold(s, c.String()) {
+			return c, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown cipher %q", s)
+}
+
+// selectCipher returns the cipher to encrypt with; the zero value selects DefaultCipher.
+func selectCipher(c CipherID) (CipherID, error) {
+
+	switch c {
+	case 0:
+		return DefaultCipher, nil
+	case CipherAES256GCM, CipherXChaCha20Poly1305, CipherAES256GCMSIV:
+		return c, nil
+	case CipherAES256SIV:
+		return 0, errors.New("AES-256-SIV is deterministic; use EncryptDeterministic")
+	default:
+		return 0, fmt.Errorf("unsupported cipher: %v", c)
+	}
+}
+
+// newAEAD returns the AEAD for the cipher and key.
+func newAEAD(c CipherID, key *AES256Key) (cipher.AEAD, error) {
+
+	switch c {
+	case CipherAES256GCM:
+		return newGCM(key)
+
+	case CipherXChaCha20Poly1305:
+		subkey, err := key.Derive([]byte("go-util-helpers xchacha20-poly1305 key"), nil)
+		if err != nil {
+			return nil, err
+		}
+		defer subkey.Destroy()
+
+		return chacha20poly1305.NewX(subkey[:])
+
+	case CipherAES256GCMSIV:
+		subkey, err := key.Derive([]byte("go-util-helpers aes-gcm-siv key"), nil)
+		if err != nil {
+			return nil, err
+		}
+		defer subkey.Destroy()
+
+		return newGCMSIV(subkey[:])
+
+	default:
+		return nil, fmt.Errorf("unsupported cipher: %v", c)
+	}
+}
@@ -0,0 +1,127 @@
+package crypto_test
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cipher suites", func() {
+	ciphers := []crypto.CipherID{crypto.CipherAES256GCM, crypto.CipherXChaCha20Poly1305, crypto.CipherAES256GCMSIV}
+
+	It("encrypts with the selected cipher, which Decrypt detects", func() {
+		for _, c := range ciphers {
+			ciphertext, err := crypto.EncryptWithOptions([]byte("test"), &fixedKey, crypto.EncryptOptions{Cipher: c})
+			Expect(err).To(BeNil())
+
+			h, err := crypto.ParseHeader(ciphertext)
+			Expect(err).To(BeNil())
+			Expect(h.Cipher).To(Equal(c))
+
+			plaintext, err := crypto.Decrypt(ciphertext, &fixedKey)
+			Expect(err).To(BeNil(), c.String())
+			Expect(string(plaintext)).To(Equal("test"))
+
+			_, err = crypto.Decrypt(ciphertext, crypto.NewRandomAESKey())
+			Expect(err).NotTo(BeNil())
+
+			ciphertext[len(ciphertext)-1] ^= 1
+			_, err = crypto.Decrypt(ciphertext, &fixedKey)
+			Expect(err).NotTo(BeNil(), c.String())
+		}
+	})
+
+	It("uses DefaultCipher when none is selected", func() {
+		ciphertext, err := crypto.EncryptWithOptions([]byte("test"), &fixedKey, crypto.EncryptOptions{})
+		Expect(err).To(BeNil())
+
+		h, err := crypto.ParseHeader(ciphertext)
+		Expect(err).To(BeNil())
+		Expect(h.Cipher).To(Equal(crypto.DefaultCipher))
+	})
+
+	It("binds the ciphertext to the additional data", func() {
+		for _, c := range ciphers {
+			options := crypto.EncryptOptions{Cipher: c, AdditionalData: []byte("row-42")}
+			ciphertext, err := crypto.EncryptWithOptions([]byte("test"), &fixedKey, options)
+			Expect(err).To(BeNil())
+
+			plaintext, err := crypto.DecryptWithAAD(ciphertext, []byte("row-42"), &fixedKey)
+			Expect(err).To(BeNil())
+			Expect(string(plaintext)).To(Equal("test"))
+
+			_, err = crypto.DecryptWithAAD(ciphertext, []byte("row-43"), &fixedKey)
+			Expect(err).NotTo(BeNil(), c.String())
+		}
+	})
+
+	It("encrypts streams with the selected cipher", func() {
+		plaintext := patternedBytes(2*crypto.StreamChunkSize + 10)
+
+		for _, c := range ciphers {
+			var buf bytes.Buffer
+			w, err := crypto.NewEncryptingWriterWithOptions(&buf, &fixedKey, crypto.EncryptOptions{Cipher: c})
+			Expect(err).To(BeNil())
+			_, err = w.Write(plaintext)
+			Expect(err).To(BeNil())
+			Expect(w.Close()).To(Succeed())
+
+			h, err := crypto.ParseHeader(buf.Bytes())
+			Expect(err).To(BeNil())
+			Expect(h.Cipher).To(Equal(c))
+
+			plaintext2, err := decryptStream(buf.Bytes(), &fixedKey)
+			Expect(err).To(BeNil(), c.String())
+			Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+
+			ciphertext := buf.Bytes()
+			ciphertext[len(ciphertext)-1] ^= 1
+			r, err := crypto.NewDecryptingReader(bytes.NewReader(ciphertext), &fixedKey)
+			Expect(err).To(BeNil())
+			_, err = ioutil.ReadAll(r)
+			Expect(err).NotTo(BeNil(), c.String())
+		}
+	})
+
+	It("rejects deterministic and unknown ciphers", func() {
+		for _, c := range []crypto.CipherID{crypto.CipherAES256SIV, 200} {
+			ciphertext, err := crypto.EncryptWithOptions([]byte("test"), &fixedKey, crypto.EncryptOptions{Cipher: c})
+			Expect(ciphertext).To(BeNil())
+			Expect(err).NotTo(BeNil())
+
+			w, err := crypto.NewEncryptingWriterWithOptions(&bytes.Buffer{}, &fixedKey, crypto.EncryptOptions{Cipher: c})
+			Expect(w).To(BeNil())
+			Expect(err).NotTo(BeNil())
+		}
+	})
+
+	It("requires a valid key", func() {
+		ciphertext, err := crypto.EncryptWithOptions([]byte("test"), nil, crypto.EncryptOptions{})
+		Expect(ciphertext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("ParseCipher", func() {
+	It("parses cipher names case-insensitively", func() {
+		for name, expected := range map[string]crypto.CipherID{
+			"AES-256-GCM":        crypto.CipherAES256GCM,
+			"xchacha20-poly1305": crypto.CipherXChaCha20Poly1305,
+			"aes-256-gcm-siv":    crypto.CipherAES256GCMSIV,
+		} {
+			c, err := crypto.ParseCipher(name)
+			Expect(err).To(BeNil())
+			Expect(c).To(Equal(expected))
+		}
+	})
+
+	It("rejects unknown and deterministic ciphers", func() {
+		for _, name := range []string{"", "aes-128-gcm", "aes-256-siv"} {
+			_, err := crypto.ParseCipher(name)
+			Expect(err).NotTo(BeNil(), name)
+		}
+	})
+})
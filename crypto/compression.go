@@ -0,0 +1,181 @@
+package crypto
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression identifies the algorithm that a plaintext is compressed with before it is encrypted (see
+// EncryptOptions). Ciphertext does not compress, so compression must happen before encryption; the algorithm is
+// recorded in the ciphertext's header, and decryption decompresses transparently.
+//
+// Compression leaks information through the length of the ciphertext: how well a plaintext compresses depends on
+// its contents. If an attacker can influence part of a plaintext that also contains a secret (e.g. a reflected
+// request parameter next to a session token) and observe the ciphertext lengths, they can recover the secret a
+// character at a time (as in the CRIME and BREACH attacks). Only compress plaintexts that do not mix secrets with
+// data an attacker can influence, or whose lengths an attacker cannot observe.
+type Compression byte
+
+const (
+	// CompressionNone does not compress.
+	CompressionNone Compression = iota
+	// CompressionGzip compresses with gzip (RFC 1952).
+	CompressionGzip
+	// CompressionZstd compresses with Zstandard (RFC 8878), which is faster, and usually smaller, than gzip.
+	CompressionZstd
+)
+
+// String returns the name of the compression algorithm.
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("unknown compression (%d)", byte(c))
+	}
+}
+
+// ParseCompression returns the Compression named by s (e.g. "zstd"), case-insensitively.
+func ParseCompression(s string) (Compression, error) {
+
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		if strings.EqualFold(s, c.String()) {
+			return c, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown compression %q", s)
+}
+
+func validateCompression(c Compression) error {
+	switch c {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression: %v", c)
+	}
+}
+
+// compress returns the compressed data.
+func compress(c Compression, data []byte) ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	w, err := newCompressingWriter(c, &buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decompress returns the decompressed data.
+func decompress(c Compression, data []byte) ([]byte, error) {
+
+	r, err := newDecompressingReader(c, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(r)
+}
+
+// newCompressingWriter returns a writer that compresses to w; closing it does not close w.
+func newCompressingWriter(c Compression, w io.Writer) (io.WriteCloser, error) {
+
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, fmt.Errorf("unsupported compression: %v", c)
+	}
+}
+
+// newDecompressingReader returns a reader that decompresses r.
+func newDecompressingReader(c Compression, r io.Reader) (io.Reader, error) {
+
+	switch c {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %v", err)
+		}
+		return gr, nil
+
+	case CompressionZstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %v", err)
+		}
+		return &zstdReader{d: d}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported compression: %v", c)
+	}
+}
+
+// zstdReader releases the decoder's resources once the stream has been read.
+type zstdReader struct {
+	d *zstd.Decoder
+}
+
+func (zr *zstdReader) Read(p []byte) (int, error) {
+
+	if zr.d == nil {
+		return 0, io.EOF
+	}
+
+	n, err := zr.d.Read(p)
+	if err == io.EOF {
+		zr.d.Close()
+		zr.d = nil
+	}
+
+	return n, err
+}
+
+// compressingEncryptingWriter compresses everything written to it before it is encrypted.
+type compressingEncryptingWriter struct {
+	io.Writer
+	compressor io.WriteCloser
+	encryptor  io.WriteCloser
+}
+
+func (cw *compressingEncryptingWriter) Close() error {
+
+	if err := cw.compressor.Close(); err != nil {
+		return err
+	}
+
+	return cw.encryptor.Close()
+}
+
+func newCompressingEncryptingWriter(c Compression, encryptor io.WriteCloser) (io.WriteCloser, error) {
+
+	compressor, err := newCompressingWriter(c, encryptor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compressingEncryptingWriter{Writer: compressor, compressor: compressor, encryptor: encryptor}, nil
+}
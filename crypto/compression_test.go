@@ -0,0 +1,141 @@
+package crypto_test
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// compressibleBytes returns JSON-like data that compresses well.
+func compressibleBytes(records int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < records; i++ {
+		fmt.Fprintf(&buf, `{"id": %d, "level": "info", "message": "request handled", "status": 200}`+"\n", i)
+	}
+	return buf.Bytes()
+}
+
+var _ = Describe("Compression", func() {
+	compressions := []crypto.Compression{crypto.CompressionGzip, crypto.CompressionZstd}
+
+	It("compresses before encrypting, and decrypts transparently", func() {
+		plaintext := compressibleBytes(1000)
+
+		for _, c := range compressions {
+			ciphertext, err := crypto.EncryptWithOptions(plaintext, &fixedKey, crypto.EncryptOptions{Compression: c})
+			Expect(err).To(BeNil())
+			Expect(len(ciphertext)).To(BeNumerically("<", len(plaintext)/5), c.String())
+
+			h, err := crypto.ParseHeader(ciphertext)
+			Expect(err).To(BeNil())
+			Expect(h.Flags & crypto.FlagCompressed).To(Equal(crypto.FlagCompressed))
+			Expect(h.Compression).To(Equal(c))
+
+			decrypted, err := crypto.Decrypt(ciphertext, &fixedKey)
+			Expect(err).To(BeNil())
+			Expect(decrypted).To(Equal(plaintext))
+		}
+	})
+
+	It("works with the other options, and with keyrings", func() {
+		keyring := crypto.NewKeyring()
+		_, err := keyring.Add(&fixedKey)
+		Expect(err).To(BeNil())
+
+		ciphertext, err := keyring.EncryptWithOptions([]byte("test"), crypto.EncryptOptions{
+			Cipher:         crypto.CipherXChaCha20Poly1305,
+			AdditionalData: []byte("aad"),
+			Compression:    crypto.CompressionZstd,
+		})
+		Expect(err).To(BeNil())
+
+		decrypted, err := keyring.DecryptWithAAD(ciphertext, []byte("aad"))
+		Expect(err).To(BeNil())
+		Expect(decrypted).To(Equal([]byte("test")))
+
+		_, err = keyring.DecryptWithAAD(ciphertext, []byte("other"))
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("compresses streams", func() {
+		plaintext := compressibleBytes(5000)
+
+		for _, c := range compressions {
+			var buf bytes.Buffer
+			w, err := crypto.NewEncryptingWriterWithOptions(&buf, &fixedKey, crypto.EncryptOptions{Compression: c})
+			Expect(err).To(BeNil())
+
+			for i := 0; i < len(plaintext); i += 1000 {
+				end := i + 1000
+				if end > len(plaintext) {
+					end = len(plaintext)
+				}
+				_, err := w.Write(plaintext[i:end])
+				Expect(err).To(BeNil())
+			}
+			Expect(w.Close()).To(Succeed())
+			Expect(buf.Len()).To(BeNumerically("<", len(plaintext)/5), c.String())
+
+			decrypted, err := decryptStream(buf.Bytes(), &fixedKey)
+			Expect(err).To(BeNil())
+			Expect(decrypted).To(Equal(plaintext))
+		}
+	})
+
+	It("handles empty plaintexts", func() {
+		for _, c := range compressions {
+			ciphertext, err := crypto.EncryptWithOptions(nil, &fixedKey, crypto.EncryptOptions{Compression: c})
+			Expect(err).To(BeNil())
+
+			decrypted, err := crypto.Decrypt(ciphertext, &fixedKey)
+			Expect(err).To(BeNil())
+			Expect(decrypted).To(BeEmpty())
+		}
+	})
+
+	It("authenticates the compression algorithm", func() {
+		ciphertext, err := crypto.EncryptWithOptions([]byte("test"), &fixedKey, crypto.EncryptOptions{Compression: crypto.CompressionGzip})
+		Expect(err).To(BeNil())
+
+		// whitebox: the compression section follows the fixed-length header and its 2-byte length
+		Expect(ciphertext[17]).To(Equal(byte(crypto.CompressionGzip)))
+		ciphertext[17] = byte(crypto.CompressionZstd)
+
+		_, err = crypto.Decrypt(ciphertext, &fixedKey)
+		Expect(err).NotTo(BeNil())
+
+		ciphertext[17] = 0xff
+		_, err = crypto.ParseHeader(ciphertext)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("rejects unsupported algorithms", func() {
+		_, err := crypto.EncryptWithOptions([]byte("test"), &fixedKey, crypto.EncryptOptions{Compression: crypto.Compression(99)})
+		Expect(err).NotTo(BeNil())
+
+		var buf bytes.Buffer
+		_, err = crypto.NewEncryptingWriterWithOptions(&buf, &fixedKey, crypto.EncryptOptions{Compression: crypto.Compression(99)})
+		Expect(err).NotTo(BeNil())
+		Expect(buf.Len()).To(Equal(0))
+	})
+
+	Describe("ParseCompression", func() {
+		It("parses the algorithm names", func() {
+			for _, c := range []crypto.Compression{crypto.CompressionNone, crypto.CompressionGzip, crypto.CompressionZstd} {
+				parsed, err := crypto.ParseCompression(c.String())
+				Expect(err).To(BeNil())
+				Expect(parsed).To(Equal(c))
+			}
+
+			parsed, err := crypto.ParseCompression("ZSTD")
+			Expect(err).To(BeNil())
+			Expect(parsed).To(Equal(crypto.CompressionZstd))
+
+			_, err = crypto.ParseCompression("brotli")
+			Expect(err).NotTo(BeNil())
+		})
+	})
+})
@@ -1,6 +1,9 @@
 package crypto_test
 
 import (
+	"encoding/hex"
+	"strings"
+
 	"github.com/bit-mancer/go-util-helpers/crypto"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -12,6 +15,22 @@ var fixedKey = crypto.AES256Key{144, 219, 85, 9, 191, 207, 189, 121, 11, 162, 77
 
 const fixedKeyBase64 = "kNtVCb/PvXkLok1SD4GwTmY3eA2tq4Kx9501eXFFvRk="
 
+var fixedHMACKey = crypto.HMACKey{
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
+	32, 33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44, 45, 46, 47, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61, 62, 63,
+}
+
+const fixedHMACKeyBase64 = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gISIjJCUmJygpKissLS4vMDEyMzQ1Njc4OTo7PD0+Pw=="
+
+// decodeHex decodes a test vector written as hex, optionally split into groups by spaces.
+func decodeHex(s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
 func TestCrypto(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Crypto Suite")
@@ -0,0 +1,13 @@
+package cryptotest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCryptotest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cryptotest Suite")
+}
@@ -0,0 +1,141 @@
+package cryptotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+)
+
+// FakeKMS is a crypto.FileKMS whose key versions are fixed keys (see FixedKey), so a key wrapped by one FakeKMS can be
+// unwrapped by any other with the same name, e.g. in a later test run. It counts the calls made to it, and can be made
+// to fail (see FailWith), to test error handling. Its key file is kept in a temporary directory; call Close to remove
+// it. A FakeKMS is safe for concurrent use.
+type FakeKMS struct {
+	mu       sync.Mutex
+	kms      *crypto.FileKMS
+	dir      string
+	name     string
+	versions int
+	wraps    int
+	unwraps  int
+	err      error
+}
+
+// fakeKMSFile is the format of a FileKMS key file: key names mapped to base64-encoded key versions, oldest first.
+type fakeKMSFile struct {
+	Keys map[string][]string `json:"keys"`
+}
+
+// NewFakeKMS returns a FakeKMS for the named key, with a single version of the key. NewFakeKMS panics if the key file
+// cannot be created.
+func NewFakeKMS(name string) *FakeKMS {
+
+	dir, err := ioutil.TempDir("", "fake-kms")
+	if err != nil {
+		panic(err)
+	}
+
+	kms := &FakeKMS{dir: dir, name: name}
+	kms.RotateKey()
+
+	if kms.kms, err = crypto.NewFileKMS(kms.path(), name); err != nil {
+		panic(err)
+	}
+
+	return kms
+}
+
+// Close removes the key file; the FakeKMS cannot be used afterwards.
+func (kms *FakeKMS) Close() error {
+	return os.RemoveAll(kms.dir)
+}
+
+// RotateKey adds a new version of the key. Wrapping uses the new version; keys wrapped by older versions can still
+// be unwrapped. RotateKey panics if the key file cannot be written.
+func (kms *FakeKMS) RotateKey() {
+
+	kms.mu.Lock()
+	defer kms.mu.Unlock()
+
+	kms.versions++
+
+	file := fakeKMSFile{Keys: map[string][]string{}}
+	for v := 1; v <= kms.versions; v++ {
+		file.Keys[kms.name] = append(file.Keys[kms.name], FixedKey(fmt.Sprintf("%s/v%d", kms.name, v)).ToBase64())
+	}
+
+	contents, err := json.Marshal(file)
+	if err == nil {
+		err = ioutil.WriteFile(kms.path(), contents, 0600)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// FailWith makes every later call fail with err, until it is called again with nil.
+func (kms *FakeKMS) FailWith(err error) {
+
+	kms.mu.Lock()
+	defer kms.mu.Unlock()
+
+	kms.err = err
+}
+
+// WrapCount returns the number of calls to WrapKey.
+func (kms *FakeKMS) WrapCount() int {
+
+	kms.mu.Lock()
+	defer kms.mu.Unlock()
+
+	return kms.wraps
+}
+
+// UnwrapCount returns the number of calls to UnwrapKey.
+func (kms *FakeKMS) UnwrapCount() int {
+
+	kms.mu.Lock()
+	defer kms.mu.Unlock()
+
+	return kms.unwraps
+}
+
+// WrapKey encrypts the data key with the newest version of the key (see crypto.FileKMS.WrapKey).
+func (kms *FakeKMS) WrapKey(dataKey *crypto.AES256Key) ([]byte, error) {
+
+	kms.mu.Lock()
+	defer kms.mu.Unlock()
+
+	kms.wraps++
+
+	if kms.err != nil {
+		return nil, kms.err
+	}
+
+	return kms.kms.WrapKey(dataKey)
+}
+
+// UnwrapKey decrypts a data key previously wrapped by WrapKey, with whichever version of the key wrapped it (see
+// crypto.FileKMS.UnwrapKey).
+func (kms *FakeKMS) UnwrapKey(wrappedKey []byte) (*crypto.AES256Key, error) {
+
+	kms.mu.Lock()
+	defer kms.mu.Unlock()
+
+	kms.unwraps++
+
+	if kms.err != nil {
+		return nil, kms.err
+	}
+
+	return kms.kms.UnwrapKey(wrappedKey)
+}
+
+func (kms *FakeKMS) path() string {
+	return filepath.Join(kms.dir, "kms.json")
+}
@@ -0,0 +1,94 @@
+package cryptotest_test
+
+import (
+	"errors"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	"github.com/bit-mancer/go-util-helpers/crypto/cryptotest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FakeKMS", func() {
+	It("wraps and unwraps data keys for envelope encryption", func() {
+		kms := cryptotest.NewFakeKMS("backups")
+		defer kms.Close()
+
+		ciphertext, err := crypto.EnvelopeEncrypt([]byte("test"), kms)
+		Expect(err).To(BeNil())
+
+		plaintext, err := crypto.EnvelopeDecrypt(ciphertext, kms)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+
+		Expect(kms.WrapCount()).To(Equal(1))
+		Expect(kms.UnwrapCount()).To(Equal(1))
+	})
+
+	It("unwraps keys wrapped by older versions of the key", func() {
+		kms := cryptotest.NewFakeKMS("backups")
+		defer kms.Close()
+
+		ciphertext, err := crypto.EnvelopeEncrypt([]byte("test"), kms)
+		Expect(err).To(BeNil())
+
+		kms.RotateKey()
+
+		ciphertext2, err := crypto.EnvelopeEncrypt([]byte("test"), kms)
+		Expect(err).To(BeNil())
+
+		for _, c := range [][]byte{ciphertext, ciphertext2} {
+			plaintext, err := crypto.EnvelopeDecrypt(c, kms)
+			Expect(err).To(BeNil())
+			Expect(plaintext).To(Equal([]byte("test")))
+		}
+	})
+
+	It("does not unwrap keys wrapped by another key", func() {
+		backups, exports, backups2 := cryptotest.NewFakeKMS("backups"), cryptotest.NewFakeKMS("exports"), cryptotest.NewFakeKMS("backups")
+		defer backups.Close()
+		defer exports.Close()
+		defer backups2.Close()
+
+		ciphertext, err := crypto.EnvelopeEncrypt([]byte("test"), backups)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.EnvelopeDecrypt(ciphertext, exports)
+		Expect(err).NotTo(BeNil())
+
+		// the same name has the same keys
+		_, err = crypto.EnvelopeDecrypt(ciphertext, backups2)
+		Expect(err).To(BeNil())
+	})
+
+	It("fails once closed", func() {
+		kms := cryptotest.NewFakeKMS("backups")
+		Expect(kms.Close()).To(Succeed())
+
+		_, err := crypto.EnvelopeEncrypt([]byte("test"), kms)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("fails on demand", func() {
+		kms := cryptotest.NewFakeKMS("backups")
+		defer kms.Close()
+
+		ciphertext, err := crypto.EnvelopeEncrypt([]byte("test"), kms)
+		Expect(err).To(BeNil())
+
+		kms.FailWith(errors.New("KMS unavailable"))
+
+		_, err = crypto.EnvelopeEncrypt([]byte("test"), kms)
+		Expect(err).NotTo(BeNil())
+		_, err = crypto.EnvelopeDecrypt(ciphertext, kms)
+		Expect(err).NotTo(BeNil())
+
+		kms.FailWith(nil)
+
+		_, err = crypto.EnvelopeDecrypt(ciphertext, kms)
+		Expect(err).To(BeNil())
+
+		Expect(kms.WrapCount()).To(Equal(2))
+		Expect(kms.UnwrapCount()).To(Equal(2))
+	})
+})
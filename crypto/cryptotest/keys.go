@@ -0,0 +1,33 @@
+package cryptotest
+
+import (
+	"crypto/sha256"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+)
+
+// FixedKey returns the key for the name: the same name returns the same key, on every call and in every process, so
+// tests can share keys with golden files without storing them. The key is the SHA-256 hash of a prefix and the name.
+func FixedKey(name string) *crypto.AES256Key {
+
+	key := crypto.AES256Key(sha256.Sum256([]byte("go-util-helpers cryptotest key: " + name)))
+	return &key
+}
+
+// NewFixedKeyring returns a Keyring holding the fixed key for each name (see FixedKey); the first is the primary key.
+// With no names, the keyring holds the fixed key for "default".
+func NewFixedKeyring(names ...string) *crypto.Keyring {
+
+	if len(names) == 0 {
+		names = []string{"default"}
+	}
+
+	kr := crypto.NewKeyring()
+	for _, name := range names {
+		if _, err := kr.Add(FixedKey(name)); err != nil {
+			panic(err)
+		}
+	}
+
+	return kr
+}
@@ -0,0 +1,43 @@
+package cryptotest_test
+
+import (
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	"github.com/bit-mancer/go-util-helpers/crypto/cryptotest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FixedKey", func() {
+	It("returns the same key for the same name", func() {
+		Expect(*cryptotest.FixedKey("a")).To(Equal(*cryptotest.FixedKey("a")))
+		Expect(*cryptotest.FixedKey("a")).NotTo(Equal(*cryptotest.FixedKey("b")))
+	})
+
+	It("returns the same key in every release, for golden files", func() {
+		Expect(cryptotest.FixedKey("a").ToBase64()).To(Equal("fd6KubFh8J5ATZKhGyzxmWSykQQeY1QORwVapQYqjT4="))
+	})
+})
+
+var _ = Describe("NewFixedKeyring", func() {
+	It("holds the fixed keys, with the first as the primary key", func() {
+		kr := cryptotest.NewFixedKeyring("a", "b")
+
+		Expect(kr.IDs()).To(ConsistOf(cryptotest.FixedKey("a").ID(), cryptotest.FixedKey("b").ID()))
+
+		primary, ok := kr.Primary()
+		Expect(ok).To(Equal(true))
+		Expect(primary).To(Equal(cryptotest.FixedKey("a").ID()))
+
+		ciphertext, err := crypto.Encrypt([]byte("test"), cryptotest.FixedKey("b"))
+		Expect(err).To(BeNil())
+		plaintext, err := kr.Decrypt(ciphertext)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+	})
+
+	It("holds a default key when no names are provided", func() {
+		primary, ok := cryptotest.NewFixedKeyring().Primary()
+		Expect(ok).To(Equal(true))
+		Expect(primary).To(Equal(cryptotest.FixedKey("default").ID()))
+	})
+})
@@ -0,0 +1,54 @@
+// Package cryptotest provides test doubles for the crypto package, so that tests of code that encrypts can be
+// reproducible: a deterministic source of randomness for keys, fixed keys and keyrings, a fake KMS, and a check that
+// ciphertexts are tamper-evident.
+//
+// The crypto package takes nonces, salts and data keys from crypto/rand unless a test passes its own source in
+// crypto.EncryptOptions.Rand: with a deterministic reader, ciphertexts are reproducible and can be compared with golden
+// values. Encrypt, EncryptStringToBase64 and the other functions without options always use crypto/rand, as do key
+// generation and signing. Deterministic encryption (see crypto.EncryptDeterministic) is reproducible by design.
+//
+// Nothing in this package is secure; use it only in tests.
+package cryptotest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"io"
+	"sync"
+)
+
+// NewDeterministicReader returns an io.Reader that produces an endless stream of bytes determined by the seed: the same
+// seed produces the same bytes, on every call and in every process. Pass it explicitly where a test needs reproducible
+// keys or ciphertexts, e.g. to crypto.NewAESKeyFromReader or in crypto.EncryptOptions. The bytes are the AES-256-CTR
+// keystream for the SHA-256 hash of the seed.
+// The reader is safe for concurrent use, but concurrent readers receive the bytes in an unpredictable order.
+func NewDeterministicReader(seed string) io.Reader {
+
+	key := sha256.Sum256([]byte(seed))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return &deterministicReader{stream: cipher.NewCTR(block, make([]byte, aes.BlockSize))}
+}
+
+type deterministicReader struct {
+	mu     sync.Mutex
+	stream cipher.Stream
+}
+
+func (dr *deterministicReader) Read(p []byte) (int, error) {
+
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	for i := range p {
+		p[i] = 0
+	}
+
+	dr.stream.XORKeyStream(p, p)
+	return len(p), nil
+}
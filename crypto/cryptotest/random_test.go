@@ -0,0 +1,132 @@
+package cryptotest_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	"github.com/bit-mancer/go-util-helpers/crypto/cryptotest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func readBytes(r io.Reader, n int) []byte {
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	Expect(err).To(BeNil())
+	return b
+}
+
+var _ = Describe("NewDeterministicReader", func() {
+	It("produces the same bytes for the same seed", func() {
+		Expect(readBytes(cryptotest.NewDeterministicReader("a"), 100)).To(Equal(readBytes(cryptotest.NewDeterministicReader("a"), 100)))
+		Expect(readBytes(cryptotest.NewDeterministicReader("a"), 100)).NotTo(Equal(readBytes(cryptotest.NewDeterministicReader("b"), 100)))
+	})
+
+	It("produces the same bytes however they are read", func() {
+		r := cryptotest.NewDeterministicReader("a")
+		chunked := append(readBytes(r, 7), readBytes(r, 93)...)
+
+		Expect(chunked).To(Equal(readBytes(cryptotest.NewDeterministicReader("a"), 100)))
+	})
+})
+
+var _ = Describe("crypto.NewAESKeyFromReader", func() {
+	It("makes keys reproducible", func() {
+		key, err := crypto.NewAESKeyFromReader(cryptotest.NewDeterministicReader("golden"))
+		Expect(err).To(BeNil())
+
+		key2, err := crypto.NewAESKeyFromReader(cryptotest.NewDeterministicReader("golden"))
+		Expect(err).To(BeNil())
+		Expect(*key2).To(Equal(*key))
+
+		key3, err := crypto.NewAESKeyFromReader(cryptotest.NewDeterministicReader("other"))
+		Expect(err).To(BeNil())
+		Expect(*key3).NotTo(Equal(*key))
+	})
+
+	It("fails when the reader runs out", func() {
+		_, err := crypto.NewAESKeyFromReader(bytes.NewReader(make([]byte, crypto.AES256KeyLengthInBytes-1)))
+		Expect(err).NotTo(BeNil())
+
+		_, err = crypto.NewAESKeyFromReader(nil)
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("crypto.EncryptOptions.Rand", func() {
+	// sealed with FixedKey("golden") and NewDeterministicReader("golden nonce")
+	const goldenHex = "47554843010100005a78a5be8df27e7bf7e77118e9701bf6f925ddef30211dc97c7a697d628f927698eee9eaa2c6f9e8f87ee87ceb29d0423162cd"
+	const goldenBase64 = "R1VIQwEBAABaeKW+jfJ+e/fncRjpcBv2+SXd7zAhHcl8eml9Yo+Sdpju6eqixvno+H7ofOsp0EIxYs0="
+
+	golden, _ := hex.DecodeString(goldenHex)
+
+	It("makes Encrypt's ciphertexts reproducible", func() {
+		options := crypto.EncryptOptions{Rand: cryptotest.NewDeterministicReader("golden nonce")}
+
+		ciphertext, err := crypto.EncryptWithOptions([]byte("golden plaintext"), cryptotest.FixedKey("golden"), options)
+		Expect(err).To(BeNil())
+		Expect(ciphertext).To(Equal(golden))
+
+		plaintext, err := crypto.Decrypt(golden, cryptotest.FixedKey("golden"))
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("golden plaintext")))
+
+		// Encrypt uses crypto/rand, so only the header and length match
+		ciphertext, err = crypto.Encrypt([]byte("golden plaintext"), cryptotest.FixedKey("golden"))
+		Expect(err).To(BeNil())
+		Expect(ciphertext).To(HaveLen(len(golden)))
+		Expect(ciphertext[:12]).To(Equal(golden[:12]))
+		Expect(ciphertext).NotTo(Equal(golden))
+	})
+
+	It("makes EncryptStringToBase64's ciphertexts reproducible", func() {
+		options := crypto.EncryptOptions{Rand: cryptotest.NewDeterministicReader("golden nonce")}
+
+		ciphertext, err := crypto.EncryptStringToBase64WithOptions("golden plaintext", cryptotest.FixedKey("golden"), options)
+		Expect(err).To(BeNil())
+		Expect(ciphertext).To(Equal(goldenBase64))
+
+		plaintext, err := crypto.DecryptStringFromBase64(goldenBase64, cryptotest.FixedKey("golden"))
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal("golden plaintext"))
+
+		ciphertext, err = crypto.EncryptStringToBase64("golden plaintext", cryptotest.FixedKey("golden"))
+		Expect(err).To(BeNil())
+		Expect(ciphertext).To(HaveLen(len(goldenBase64)))
+		Expect(ciphertext).NotTo(Equal(goldenBase64))
+	})
+
+	It("makes streams and envelopes reproducible", func() {
+		encryptStream := func() []byte {
+			var buf bytes.Buffer
+			w, err := crypto.NewEncryptingWriterWithOptions(&buf, cryptotest.FixedKey("golden"), crypto.EncryptOptions{Rand: cryptotest.NewDeterministicReader("golden salt")})
+			Expect(err).To(BeNil())
+			_, err = w.Write([]byte("golden plaintext"))
+			Expect(err).To(BeNil())
+			Expect(w.Close()).To(Succeed())
+			return buf.Bytes()
+		}
+		Expect(encryptStream()).To(Equal(encryptStream()))
+
+		kms := cryptotest.NewFakeKMS("golden")
+		defer kms.Close()
+		encryptEnvelope := func() []byte {
+			ciphertext, err := crypto.EnvelopeEncryptWithOptions([]byte("golden plaintext"), kms, crypto.EncryptOptions{Rand: cryptotest.NewDeterministicReader("golden data key")})
+			Expect(err).To(BeNil())
+			return ciphertext
+		}
+		// the wrapped data key is sealed by the KMS, so only the data key's ID in the header is reproducible
+		ciphertext := encryptEnvelope()
+		h, err := crypto.ParseHeader(ciphertext)
+		Expect(err).To(BeNil())
+		h2, err := crypto.ParseHeader(encryptEnvelope())
+		Expect(err).To(BeNil())
+		Expect(h2.KeyID).To(Equal(h.KeyID))
+
+		plaintext, err := crypto.EnvelopeDecrypt(ciphertext, kms)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("golden plaintext")))
+	})
+})
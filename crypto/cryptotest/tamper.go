@@ -0,0 +1,97 @@
+package cryptotest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// tamperSampleSize is the number of positions checked at each end of a long ciphertext, and between them.
+const tamperSampleSize = 256
+
+// CheckTamperDetection checks that open (e.g. a function calling crypto.Decrypt with the right key) accepts the
+// ciphertext, and rejects every modification of it: each byte altered in turn, truncation to each length, and an
+// extra trailing byte. It returns an error describing the first modification that open accepted, or nil.
+//
+// For long ciphertexts, only a sample of the positions is checked: the first and last 256 bytes (which hold the
+// header and the final tag), and 256 positions spread between them. open is passed a copy of the ciphertext, which it
+// may modify.
+func CheckTamperDetection(ciphertext []byte, open func(ciphertext []byte) error) error {
+
+	tryOpen := func(modified []byte) error {
+		return open(append([]byte{}, modified...))
+	}
+
+	if err := tryOpen(ciphertext); err != nil {
+		return fmt.Errorf("the unmodified ciphertext was rejected: %v", err)
+	}
+
+	modified := append([]byte{}, ciphertext...)
+
+	for _, i := range tamperPositions(len(ciphertext)) {
+		modified[i] ^= 1
+		err := tryOpen(modified)
+		modified[i] ^= 1
+
+		if err == nil {
+			return fmt.Errorf("a ciphertext with byte %d altered was accepted", i)
+		}
+	}
+
+	for _, length := range append(tamperPositions(len(ciphertext)), 0) {
+		if tryOpen(ciphertext[:length]) == nil {
+			return fmt.Errorf("a ciphertext truncated to %d of %d bytes was accepted", length, len(ciphertext))
+		}
+	}
+
+	if tryOpen(append(modified, 0)) == nil {
+		return errors.New("a ciphertext with an extra trailing byte was accepted")
+	}
+
+	return nil
+}
+
+// tamperPositions returns the positions to check in a ciphertext of length n.
+func tamperPositions(n int) []int {
+
+	var positions []int
+
+	if n <= 3*tamperSampleSize {
+		for i := 0; i < n; i++ {
+			positions = append(positions, i)
+		}
+		return positions
+	}
+
+	for i := 0; i < tamperSampleSize; i++ {
+		positions = append(positions, i)
+	}
+
+	middle := n - 2*tamperSampleSize
+	for i := 0; i < tamperSampleSize; i++ {
+		positions = append(positions, tamperSampleSize+i*middle/tamperSampleSize)
+	}
+
+	for i := n - tamperSampleSize; i < n; i++ {
+		positions = append(positions, i)
+	}
+
+	return positions
+}
+
+// StreamOpener returns an open function for CheckTamperDetection that reads an encrypted stream to the end through
+// the reader returned by newReader (e.g. a function calling crypto.NewDecryptingReader with the right key).
+func StreamOpener(newReader func(r io.Reader) (io.Reader, error)) func(ciphertext []byte) error {
+	return func(ciphertext []byte) error {
+
+		r, err := newReader(bytes.NewReader(ciphertext))
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(ioutil.Discard, r)
+		return err
+	}
+}
@@ -0,0 +1,71 @@
+package cryptotest_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	"github.com/bit-mancer/go-util-helpers/crypto/cryptotest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CheckTamperDetection", func() {
+	key := cryptotest.FixedKey("a")
+
+	decrypt := func(ciphertext []byte) error {
+		_, err := crypto.Decrypt(ciphertext, key)
+		return err
+	}
+
+	It("accepts authenticated ciphertexts", func() {
+		for _, size := range []int{0, 10, 1000} {
+			ciphertext, err := crypto.Encrypt(bytes.Repeat([]byte{'a'}, size), key)
+			Expect(err).To(BeNil())
+			Expect(cryptotest.CheckTamperDetection(ciphertext, decrypt)).To(Succeed(), "size %d", size)
+		}
+	})
+
+	It("accepts authenticated streams", func() {
+		var buf bytes.Buffer
+		w, err := crypto.NewEncryptingWriter(&buf, key)
+		Expect(err).To(BeNil())
+		_, err = w.Write(bytes.Repeat([]byte{'a'}, crypto.StreamChunkSize+10))
+		Expect(err).To(BeNil())
+		Expect(w.Close()).To(Succeed())
+
+		open := cryptotest.StreamOpener(func(r io.Reader) (io.Reader, error) {
+			return crypto.NewDecryptingReader(r, key)
+		})
+		Expect(cryptotest.CheckTamperDetection(buf.Bytes(), open)).To(Succeed())
+	})
+
+	It("reports a ciphertext that does not open", func() {
+		ciphertext, err := crypto.Encrypt([]byte("test"), crypto.NewRandomAESKey())
+		Expect(err).To(BeNil())
+
+		Expect(cryptotest.CheckTamperDetection(ciphertext, decrypt)).NotTo(Succeed())
+	})
+
+	It("reports modifications that are accepted", func() {
+		ciphertext, err := crypto.Encrypt([]byte("test"), key)
+		Expect(err).To(BeNil())
+
+		// ignores everything after the header
+		err = cryptotest.CheckTamperDetection(ciphertext, func(c []byte) error {
+			_, err := crypto.ParseHeader(c)
+			return err
+		})
+		Expect(err).NotTo(BeNil())
+
+		// ignores trailing data
+		err = cryptotest.CheckTamperDetection(ciphertext, func(c []byte) error {
+			if len(c) < len(ciphertext) {
+				return errors.New("truncated")
+			}
+			return decrypt(c[:len(ciphertext)])
+		})
+		Expect(err).To(MatchError(ContainSubstring("trailing")))
+	})
+})
@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+)
+
+// The deterministic functions encrypt with AES-SIV (RFC 5297) rather than AES-GCM with a random nonce: the same
+// plaintext and key always produce the same ciphertext. This allows equality lookups on encrypted values (e.g.
+// WHERE email = ?), at the cost of revealing which values are equal. Use them only for fields that must be
+// queried; prefer Encrypt and EncryptStringToBase64 for everything else.
+//
+// The AES-SIV keys are derived from the provided key (see AES256Key.Derive), and the header is authenticated as
+// additional data.
+
+// EncryptDeterministic deterministically encrypts the plaintext with the provided key and returns the result.
+func EncryptDeterministic(plaintext []byte, key *AES256Key) ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to encrypt with nil key")
+	}
+
+	s, err := newDeterministicSIV(key)
+	if err != nil {
+		return nil, err
+	}
+
+	rawHeader := newHeader(CipherAES256SIV, 0, key).marshal()
+	return append(rawHeader, s.seal(plaintext, rawHeader)...), nil
+}
+
+// DecryptDeterministic decrypts the ciphertext (e.g. from a previous call to EncryptDeterministic) with the provided
+// key and returns the result.
+func DecryptDeterministic(ciphertext []byte, key *AES256Key) ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to decrypt with nil key")
+	}
+
+	h, rawHeader, err := readHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Cipher != CipherAES256SIV || h.Flags != 0 {
+		return nil, errors.New("ciphertext is not deterministically encrypted; use Decrypt")
+	}
+
+	if _, err := resolveWithKey(key)(h); err != nil {
+		return nil, err
+	}
+
+	s, err := newDeterministicSIV(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.open(ciphertext[len(rawHeader):], rawHeader)
+}
+
+// EncryptStringToBase64Deterministic deterministically encrypts the plaintext with the provided key and returns the
+// base64-encoded result.
+func EncryptStringToBase64Deterministic(plaintext string, key *AES256Key) (string, error) {
+
+	ciphertext, err := EncryptDeterministic([]byte(plaintext), key)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptStringFromBase64Deterministic decodes the provided base64 string (e.g. from a previous call to
+// EncryptStringToBase64Deterministic), decrypts the result with the provided key, and returns the resulting string.
+func DecryptStringFromBase64Deterministic(base64Ciphertext string, key *AES256Key) (string, error) {
+
+	ciphertext, err := base64.StdEncoding.DecodeString(base64Ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := DecryptDeterministic(ciphertext, key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+func newDeterministicSIV(key *AES256Key) (*siv, error) {
+
+	macKey, err := key.Derive([]byte("go-util-helpers aes-siv cmac key"), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer macKey.Destroy()
+
+	ctrKey, err := key.Derive([]byte("go-util-helpers aes-siv ctr key"), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer ctrKey.Destroy()
+
+	return newSIV(macKey[:], ctrKey[:])
+}
@@ -0,0 +1,125 @@
+package crypto_test
+
+import (
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EncryptDeterministic", func() {
+	It("produces the same ciphertext for the same plaintext and key", func() {
+		ciphertext1, err := crypto.EncryptDeterministic([]byte("alice@example.com"), &fixedKey)
+		Expect(err).To(BeNil())
+		ciphertext2, err := crypto.EncryptDeterministic([]byte("alice@example.com"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		Expect(ciphertext1).To(Equal(ciphertext2))
+		Expect(string(ciphertext1)).NotTo(ContainSubstring("alice"))
+	})
+
+	It("produces different ciphertexts for different plaintexts or keys", func() {
+		ciphertext1, err := crypto.EncryptDeterministic([]byte("alice@example.com"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		ciphertext2, err := crypto.EncryptDeterministic([]byte("bob@example.com"), &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(ciphertext1).NotTo(Equal(ciphertext2))
+
+		ciphertext3, err := crypto.EncryptDeterministic([]byte("alice@example.com"), crypto.NewRandomAESKey())
+		Expect(err).To(BeNil())
+		Expect(ciphertext1).NotTo(Equal(ciphertext3))
+	})
+
+	It("records the cipher in the header", func() {
+		ciphertext, err := crypto.EncryptDeterministic([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		h, err := crypto.ParseHeader(ciphertext)
+		Expect(err).To(BeNil())
+		Expect(h.Cipher).To(Equal(crypto.CipherAES256SIV))
+		Expect(h.KeyID).To(Equal(fixedKey.ID()))
+	})
+
+	It("requires a valid key", func() {
+		ciphertext, err := crypto.EncryptDeterministic([]byte("test"), nil)
+		Expect(ciphertext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("DecryptDeterministic", func() {
+	It("returns plaintext originally encrypted by EncryptDeterministic with the same key", func() {
+		for _, plaintext := range []string{"", "a", "alice@example.com", "a plaintext that spans several AES blocks"} {
+			ciphertext, err := crypto.EncryptDeterministic([]byte(plaintext), &fixedKey)
+			Expect(err).To(BeNil())
+
+			plaintext2, err := crypto.DecryptDeterministic(ciphertext, &fixedKey)
+			Expect(err).To(BeNil())
+			Expect(string(plaintext2)).To(Equal(plaintext))
+		}
+
+		ciphertext, err := crypto.EncryptDeterministic([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		plaintext, err := crypto.DecryptDeterministic(ciphertext, crypto.NewRandomAESKey())
+		Expect(plaintext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("detects tampering", func() {
+		ciphertext, err := crypto.EncryptDeterministic([]byte("alice@example.com"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		for _, i := range []int{6, 20, len(ciphertext) - 1} {
+			tampered := append([]byte{}, ciphertext...)
+			tampered[i] ^= 1
+
+			_, err = crypto.DecryptDeterministic(tampered, &fixedKey)
+			Expect(err).NotTo(BeNil(), "byte %d", i)
+		}
+	})
+
+	It("is not interchangeable with the randomized API", func() {
+		ciphertext, err := crypto.EncryptDeterministic([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.Decrypt(ciphertext, &fixedKey)
+		Expect(err).NotTo(BeNil())
+
+		ciphertext, err = crypto.Encrypt([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.DecryptDeterministic(ciphertext, &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires a valid key", func() {
+		plaintext, err := crypto.DecryptDeterministic([]byte("test"), nil)
+		Expect(plaintext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("EncryptStringToBase64Deterministic / DecryptStringFromBase64Deterministic", func() {
+	It("round-trips a string deterministically", func() {
+		ciphertext1, err := crypto.EncryptStringToBase64Deterministic("alice@example.com", &fixedKey)
+		Expect(err).To(BeNil())
+		ciphertext2, err := crypto.EncryptStringToBase64Deterministic("alice@example.com", &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(ciphertext1).To(Equal(ciphertext2))
+
+		plaintext, err := crypto.DecryptStringFromBase64Deterministic(ciphertext1, &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal("alice@example.com"))
+	})
+
+	It("requires a valid key", func() {
+		ciphertext, err := crypto.EncryptStringToBase64Deterministic("test", nil)
+		Expect(ciphertext).To(Equal(""))
+		Expect(err).NotTo(BeNil())
+
+		plaintext, err := crypto.DecryptStringFromBase64Deterministic(fixedKeyBase64, nil)
+		Expect(plaintext).To(Equal(""))
+		Expect(err).NotTo(BeNil())
+	})
+})
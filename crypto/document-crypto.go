@@ -0,0 +1,596 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DocumentFormat identifies the format of a document encrypted with EncryptDocument.
+type DocumentFormat int
+
+const (
+	// DocumentJSON is a JSON document.
+	DocumentJSON DocumentFormat = iota + 1
+	// DocumentYAML is a YAML document.
+	DocumentYAML
+)
+
+// String returns the name of the format.
+func (f DocumentFormat) String() string {
+	switch f {
+	case DocumentJSON:
+		return "JSON"
+	case DocumentYAML:
+		return "YAML"
+	default:
+		return fmt.Sprintf("unknown document format (%d)", int(f))
+	}
+}
+
+// EncryptDocument and DecryptDocument encrypt the values of a JSON or YAML document (e.g. a config file) in place,
+// leaving its keys and structure readable, so that the encrypted document can be committed and reviewed. Each
+// encrypted value is replaced by a string of the form "ENC[<base64>,type:<type>]", and the document's top-level
+// mapping gains an "_encryption" entry recording the key's ID and a MAC over the whole document, so that any change
+// to it (including to unencrypted values, and to the structure) is detected when it is decrypted.
+//
+// Values are encrypted deterministically (with AES-SIV, under a subkey of the key) and bound to their path and type,
+// so that re-encrypting an unchanged value produces the same ciphertext, and diffs show only the values that
+// changed; a value cannot be moved to another path. This reveals whether values at the same path are equal across
+// versions of the document, but nothing else about them.
+//
+// Paths name values by their mapping keys, joined with ".", and sequence indices, e.g. "database.password" or
+// "servers[0].host". The document must be a mapping at the top level; YAML anchors and aliases are not supported,
+// and YAML comments are kept unencrypted.
+
+const documentMetadataKey = "_encryption"
+
+const documentVersion = 1
+
+const encryptedValuePrefix = "ENC["
+const encryptedValueTypeSeparator = ",type:"
+
+// EncryptDocument encrypts the values of the document at the paths (and every value beneath them), or every value if
+// no paths are provided, and returns the encrypted document in the same format. Each path must name at least one
+// value.
+func EncryptDocument(document []byte, format DocumentFormat, key *AES256Key, paths ...string) ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to encrypt with nil key")
+	}
+
+	doc, root, err := parseDocument(document, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if documentMetadataIndex(root) >= 0 {
+		return nil, errors.New("document is already encrypted")
+	}
+
+	dc, err := newDocumentCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	defer dc.destroy()
+
+	matched := make([]bool, len(paths))
+
+	err = walkDocument(root, "", func(path string, node *yaml.Node) error {
+
+		if !selectDocumentPath(path, paths, matched) {
+			if isEncryptedValue(node) {
+				return fmt.Errorf("unencrypted value at %s looks like an encrypted value", path)
+			}
+			return nil
+		}
+
+		return dc.encryptValue(path, node)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, path := range paths {
+		if !matched[i] {
+			return nil, fmt.Errorf("path %q does not name any value in the document", path)
+		}
+	}
+
+	root.Content = append(root.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: documentMetadataKey},
+		&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"},
+			{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(documentVersion)},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "key_id"},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.ID().String()},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "mac"},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: base64.StdEncoding.EncodeToString(dc.mac(root))},
+		}},
+	)
+
+	return formatDocument(doc, root, format)
+}
+
+// DecryptDocument verifies the MAC of a document encrypted by EncryptDocument, decrypts its values, and returns the
+// original document in the same format.
+func DecryptDocument(document []byte, format DocumentFormat, key *AES256Key) ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to decrypt with nil key")
+	}
+
+	doc, root, err := parseDocument(document, format)
+	if err != nil {
+		return nil, err
+	}
+
+	i := documentMetadataIndex(root)
+	if i < 0 {
+		return nil, errors.New("document is not encrypted")
+	}
+
+	metadata := root.Content[i+1]
+	root.Content = append(root.Content[:i], root.Content[i+2:]...)
+
+	if documentMetadataIndex(root) >= 0 {
+		return nil, errors.New("document has more than one encryption metadata key")
+	}
+
+	mac, err := parseDocumentMetadata(metadata, key)
+	if err != nil {
+		return nil, err
+	}
+
+	dc, err := newDocumentCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	defer dc.destroy()
+
+	if !hmac.Equal(mac, dc.mac(root)) {
+		return nil, errors.New("document MAC mismatch; the document has been modified")
+	}
+
+	err = walkDocument(root, "", func(path string, node *yaml.Node) error {
+
+		if !isEncryptedValue(node) {
+			return nil
+		}
+
+		return dc.decryptValue(path, node)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return formatDocument(doc, root, format)
+}
+
+// documentCipher encrypts the values of a document, and computes its MAC, with subkeys of the key.
+type documentCipher struct {
+	siv    *siv
+	macKey *AES256Key
+}
+
+func newDocumentCipher(key *AES256Key) (*documentCipher, error) {
+
+	valueKey, err := key.Derive([]byte("go-util-helpers document value key"), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer valueKey.Destroy()
+
+	s, err := newDeterministicSIV(valueKey)
+	if err != nil {
+		return nil, err
+	}
+
+	macKey, err := key.Derive([]byte("go-util-helpers document mac key"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &documentCipher{siv: s, macKey: macKey}, nil
+}
+
+func (dc *documentCipher) destroy() {
+	dc.macKey.Destroy()
+}
+
+func (dc *documentCipher) encryptValue(path string, node *yaml.Node) error {
+
+	valueType := node.ShortTag()
+	if strings.HasPrefix(valueType, "!!") {
+		valueType = valueType[2:]
+	}
+
+	ciphertext := dc.siv.seal([]byte(node.Value), []byte(path), []byte(valueType))
+
+	node.Value = encryptedValuePrefix + base64.StdEncoding.EncodeToString(ciphertext) + encryptedValueTypeSeparator + valueType + "]"
+	node.Tag = "!!str"
+	node.Style = 0
+	return nil
+}
+
+func (dc *documentCipher) decryptValue(path string, node *yaml.Node) error {
+
+	encoded := strings.TrimSuffix(strings.TrimPrefix(node.Value, encryptedValuePrefix), "]")
+
+	i := strings.Index(encoded, encryptedValueTypeSeparator)
+	if i < 0 {
+		return fmt.Errorf("malformed encrypted value at %s", path)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded[:i])
+	if err != nil {
+		return fmt.Errorf("malformed encrypted value at %s: %v", path, err)
+	}
+
+	valueType := encoded[i+len(encryptedValueTypeSeparator):]
+
+	plaintext, err := dc.siv.open(ciphertext, []byte(path), []byte(valueType))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt the value at %s: %v", path, err)
+	}
+
+	if !strings.HasPrefix(valueType, "!") {
+		valueType = "!!" + valueType
+	}
+
+	node.Value = string(plaintext)
+	node.Tag = valueType
+	node.Style = 0
+	return nil
+}
+
+// mac returns the MAC of the document, which must not hold its metadata: EncryptDocument computes it before the
+// metadata is added, and DecryptDocument after the metadata is removed.
+func (dc *documentCipher) mac(root *yaml.Node) []byte {
+
+	m := hmac.New(sha256.New, dc.macKey[:])
+	writeCanonicalNode(m, root)
+	return m.Sum(nil)
+}
+
+// writeCanonicalNode writes an unambiguous encoding of the node's structure, tags and values for the MAC.
+func writeCanonicalNode(h hash.Hash, node *yaml.Node) {
+
+	writeString := func(s string) {
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(s)))
+		h.Write(length[:])
+		io.WriteString(h, s)
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		writeString("map")
+		writeString(strconv.Itoa(len(node.Content) / 2))
+		for _, child := range node.Content {
+			writeCanonicalNode(h, child)
+		}
+
+	case yaml.SequenceNode:
+		writeString("seq")
+		writeString(strconv.Itoa(len(node.Content)))
+		for _, child := range node.Content {
+			writeCanonicalNode(h, child)
+		}
+
+	default:
+		writeString("scalar")
+		writeString(node.ShortTag())
+		writeString(node.Value)
+	}
+}
+
+// walkDocument calls fn with the path of each scalar value beneath the node, in document order, skipping the
+// metadata.
+func walkDocument(node *yaml.Node, path string, fn func(path string, node *yaml.Node) error) error {
+
+	if node.Anchor != "" {
+		return fmt.Errorf("YAML anchors are not supported (at %s)", path)
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				return fmt.Errorf("non-scalar mapping keys are not supported (at %s)", path)
+			}
+
+			if path == "" && key.Value == documentMetadataKey {
+				continue
+			}
+
+			childPath := key.Value
+			if path != "" {
+				childPath = path + "." + key.Value
+			}
+
+			if err := walkDocument(node.Content[i+1], childPath, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			if err := walkDocument(child, fmt.Sprintf("%s[%d]", path, i), fn); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case yaml.ScalarNode:
+		return fn(path, node)
+
+	default:
+		return fmt.Errorf("YAML aliases are not supported (at %s)", path)
+	}
+}
+
+// selectDocumentPath reports whether the value's path is, or is beneath, one of the selected paths (or whether no
+// paths are selected), and records which paths matched.
+func selectDocumentPath(path string, paths []string, matched []bool) bool {
+
+	if len(paths) == 0 {
+		return true
+	}
+
+	selected := false
+	for i, p := range paths {
+		if path == p || strings.HasPrefix(path, p+".") || strings.HasPrefix(path, p+"[") {
+			matched[i] = true
+			selected = true
+		}
+	}
+
+	return selected
+}
+
+func isEncryptedValue(node *yaml.Node) bool {
+	return node.ShortTag() == "!!str" && strings.HasPrefix(node.Value, encryptedValuePrefix) && strings.HasSuffix(node.Value, "]")
+}
+
+func documentMetadataIndex(root *yaml.Node) int {
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == documentMetadataKey {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// parseDocumentMetadata checks the metadata against the key and returns the recorded MAC.
+func parseDocumentMetadata(metadata *yaml.Node, key *AES256Key) ([]byte, error) {
+
+	fields := make(map[string]string)
+	if metadata.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(metadata.Content); i += 2 {
+			fields[metadata.Content[i].Value] = metadata.Content[i+1].Value
+		}
+	}
+
+	if fields["version"] != strconv.Itoa(documentVersion) {
+		return nil, fmt.Errorf("unsupported document encryption version %q", fields["version"])
+	}
+
+	if id := key.ID().String(); fields["key_id"] != id {
+		return nil, fmt.Errorf("document was encrypted with key %s, not %s", fields["key_id"], id)
+	}
+
+	mac, err := base64.StdEncoding.DecodeString(fields["mac"])
+	if err != nil || len(mac) != sha256.Size {
+		return nil, errors.New("malformed document MAC")
+	}
+
+	return mac, nil
+}
+
+// parseDocument returns the document's node (for YAML) and its top-level mapping.
+func parseDocument(document []byte, format DocumentFormat) (*yaml.Node, *yaml.Node, error) {
+
+	var doc *yaml.Node
+	var root *yaml.Node
+
+	switch format {
+	case DocumentJSON:
+		var err error
+		if root, err = parseJSONDocument(document); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse the JSON document: %v", err)
+		}
+
+	case DocumentYAML:
+		doc = &yaml.Node{}
+		if err := yaml.Unmarshal(document, doc); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse the YAML document: %v", err)
+		}
+		if doc.Kind == yaml.DocumentNode && len(doc.Content) == 1 {
+			root = doc.Content[0]
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported document format: %v", format)
+	}
+
+	if root == nil || root.Kind != yaml.MappingNode {
+		return nil, nil, errors.New("document must be a mapping at the top level")
+	}
+
+	return doc, root, nil
+}
+
+func formatDocument(doc *yaml.Node, root *yaml.Node, format DocumentFormat) ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	if format == DocumentYAML {
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	if err := writeJSONNode(&buf, root); err != nil {
+		return nil, err
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	indented.WriteByte('\n')
+
+	return indented.Bytes(), nil
+}
+
+// parseJSONDocument parses the JSON document into YAML nodes, preserving the order of object members.
+func parseJSONDocument(document []byte) (*yaml.Node, error) {
+
+	d := json.NewDecoder(bytes.NewReader(document))
+	d.UseNumber()
+
+	node, err := readJSONNode(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the document")
+	}
+
+	return node, nil
+}
+
+func readJSONNode(d *json.Decoder) (*yaml.Node, error) {
+
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if t == '[' {
+			node = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		}
+
+		for d.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := d.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+
+			child, err := readJSONNode(d)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+
+		// the closing delimiter
+		if _, err := d.Token(); err != nil {
+			return nil, err
+		}
+
+		return node, nil
+
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t}, nil
+
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(t.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: t.String()}, nil
+
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(t)}, nil
+
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+}
+
+func writeJSONNode(buf *bytes.Buffer, node *yaml.Node) error {
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, node.Content[i].Value)
+			buf.WriteByte(':')
+			if err := writeJSONNode(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, child := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONNode(buf, child); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!int", "!!float", "!!bool", "!!null":
+			buf.WriteString(node.Value)
+		default:
+			writeJSONString(buf, node.Value)
+		}
+
+	default:
+		return errors.New("unsupported node in a JSON document")
+	}
+
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+
+	// unlike json.Marshal, leave <, > and & unescaped, as they are common in config values (e.g. URLs)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+
+	// Encode appends a newline
+	buf.Truncate(buf.Len() - 1)
+}
@@ -0,0 +1,200 @@
+package crypto_test
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const yamlDocument = `# service configuration
+name: billing
+port: 8080
+debug: false
+ratio: 0.5
+version: "2"
+database:
+  host: db.internal
+  password: hunter2 # rotated quarterly
+  options: null
+servers:
+  - host: a.internal
+    token: abc
+  - host: b.internal
+    token: def
+`
+
+const jsonDocument = `{
+  "name": "billing",
+  "port": 8080,
+  "url": "https://example.com/?a=1&b=<2>",
+  "debug": false,
+  "ratio": 1.5e3,
+  "database": {
+    "password": "hunter2",
+    "options": null
+  },
+  "servers": [
+    "a.internal",
+    "b.internal"
+  ],
+  "empty": {}
+}
+`
+
+var _ = Describe("Document encryption", func() {
+	It("round-trips YAML documents, keeping keys and comments readable", func() {
+		encrypted, err := crypto.EncryptDocument([]byte(yamlDocument), crypto.DocumentYAML, &fixedKey)
+		Expect(err).To(BeNil())
+
+		s := string(encrypted)
+		Expect(s).To(ContainSubstring("# service configuration"))
+		Expect(s).To(ContainSubstring("password: ENC["))
+		Expect(s).To(ContainSubstring("# rotated quarterly"))
+		Expect(s).To(ContainSubstring("_encryption:"))
+		Expect(s).To(ContainSubstring("key_id: " + fixedKey.ID().String()))
+		for _, value := range []string{"billing", "8080", "hunter2", "db.internal", "abc"} {
+			Expect(s).NotTo(ContainSubstring(value))
+		}
+
+		decrypted, err := crypto.DecryptDocument(encrypted, crypto.DocumentYAML, &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(string(decrypted)).To(Equal(yamlDocument))
+	})
+
+	It("round-trips JSON documents, preserving order and types", func() {
+		encrypted, err := crypto.EncryptDocument([]byte(jsonDocument), crypto.DocumentJSON, &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(string(encrypted)).NotTo(ContainSubstring("hunter2"))
+		Expect(string(encrypted)).To(ContainSubstring(`"empty": {}`))
+
+		var parsed map[string]interface{}
+		Expect(json.Unmarshal(encrypted, &parsed)).To(Succeed())
+		Expect(parsed["port"]).To(HavePrefix("ENC["))
+		Expect(parsed["_encryption"]).To(HaveKeyWithValue("key_id", fixedKey.ID().String()))
+
+		decrypted, err := crypto.DecryptDocument(encrypted, crypto.DocumentJSON, &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(string(decrypted)).To(Equal(jsonDocument))
+	})
+
+	It("encrypts only the selected paths", func() {
+		encrypted, err := crypto.EncryptDocument([]byte(yamlDocument), crypto.DocumentYAML, &fixedKey,
+			"database.password", "servers[1]")
+		Expect(err).To(BeNil())
+
+		s := string(encrypted)
+		Expect(s).To(ContainSubstring("name: billing"))
+		Expect(s).To(ContainSubstring("host: db.internal"))
+		Expect(s).To(ContainSubstring("token: abc"))
+		Expect(s).NotTo(ContainSubstring("hunter2"))
+		Expect(s).NotTo(ContainSubstring("host: b.internal"))
+		Expect(s).NotTo(ContainSubstring("def"))
+
+		decrypted, err := crypto.DecryptDocument(encrypted, crypto.DocumentYAML, &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(string(decrypted)).To(Equal(yamlDocument))
+
+		_, err = crypto.EncryptDocument([]byte(yamlDocument), crypto.DocumentYAML, &fixedKey, "database.pasword")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("produces the same ciphertext for unchanged values", func() {
+		encrypted1, err := crypto.EncryptDocument([]byte(yamlDocument), crypto.DocumentYAML, &fixedKey)
+		Expect(err).To(BeNil())
+
+		changed := strings.Replace(yamlDocument, "hunter2", "hunter3", 1)
+		encrypted2, err := crypto.EncryptDocument([]byte(changed), crypto.DocumentYAML, &fixedKey)
+		Expect(err).To(BeNil())
+
+		lines1 := strings.Split(string(encrypted1), "\n")
+		lines2 := strings.Split(string(encrypted2), "\n")
+		Expect(lines2).To(HaveLen(len(lines1)))
+
+		var differing []string
+		for i := range lines1 {
+			if lines1[i] != lines2[i] {
+				differing = append(differing, strings.TrimSpace(strings.SplitN(lines1[i], ":", 2)[0]))
+			}
+		}
+		Expect(differing).To(Equal([]string{"password", "mac"}))
+	})
+
+	It("detects tampering", func() {
+		encrypted, err := crypto.EncryptDocument([]byte(yamlDocument), crypto.DocumentYAML, &fixedKey, "database.password")
+		Expect(err).To(BeNil())
+		s := string(encrypted)
+
+		lines := strings.Split(s, "\n")
+		var passwordLine string
+		for _, line := range lines {
+			if strings.Contains(line, "password:") {
+				passwordLine = line
+			}
+		}
+
+		for _, tampered := range []string{
+			// an unencrypted value
+			strings.Replace(s, "host: db.internal", "host: evil.internal", 1),
+			// a key
+			strings.Replace(s, "debug:", "debugging:", 1),
+			// an added value
+			strings.Replace(s, "ratio: 0.5", "ratio: 0.5\nextra: 1", 1),
+			// a removed value
+			strings.Replace(s, "debug: false\n", "", 1),
+			// a type
+			strings.Replace(s, `version: "2"`, "version: 2", 1),
+			// an encrypted value moved to another path
+			strings.Replace(strings.Replace(s, passwordLine+"\n", "", 1), "  host: db.internal",
+				"  host: db.internal\n  pass: "+strings.SplitN(passwordLine, ": ", 2)[1], 1),
+			// a second metadata key, before or after the real one
+			"_encryption: injected\n" + s,
+			s + "_encryption: injected\n",
+		} {
+			Expect(tampered).NotTo(Equal(s))
+			_, err := crypto.DecryptDocument([]byte(tampered), crypto.DocumentYAML, &fixedKey)
+			Expect(err).NotTo(BeNil(), tampered)
+		}
+	})
+
+	It("requires the key that encrypted the document", func() {
+		encrypted, err := crypto.EncryptDocument([]byte(jsonDocument), crypto.DocumentJSON, &fixedKey)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.DecryptDocument(encrypted, crypto.DocumentJSON, crypto.NewRandomAESKey())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("rejects documents it cannot process", func() {
+		encrypted, err := crypto.EncryptDocument([]byte(jsonDocument), crypto.DocumentJSON, &fixedKey)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.EncryptDocument(encrypted, crypto.DocumentJSON, &fixedKey)
+		Expect(err).NotTo(BeNil())
+
+		_, err = crypto.DecryptDocument([]byte(jsonDocument), crypto.DocumentJSON, &fixedKey)
+		Expect(err).NotTo(BeNil())
+
+		for _, doc := range []string{`[1, 2]`, `"string"`, `{"a": 1`, `{"a": 1} {}`, ``} {
+			_, err := crypto.EncryptDocument([]byte(doc), crypto.DocumentJSON, &fixedKey)
+			Expect(err).NotTo(BeNil(), doc)
+		}
+
+		for _, doc := range []string{"- 1\n- 2\n", "a: &x 1\nb: *x\n", "a: [1\n"} {
+			_, err := crypto.EncryptDocument([]byte(doc), crypto.DocumentYAML, &fixedKey)
+			Expect(err).NotTo(BeNil(), doc)
+		}
+
+		// an unencrypted value would be mistaken for an encrypted one
+		_, err = crypto.EncryptDocument([]byte("a: ENC[abc,type:str]\nb: 1\n"), crypto.DocumentYAML, &fixedKey, "b")
+		Expect(err).NotTo(BeNil())
+
+		_, err = crypto.EncryptDocument([]byte(jsonDocument), crypto.DocumentFormat(99), &fixedKey)
+		Expect(err).NotTo(BeNil())
+
+		_, err = crypto.EncryptDocument([]byte(jsonDocument), crypto.DocumentJSON, nil)
+		Expect(err).NotTo(BeNil())
+	})
+})
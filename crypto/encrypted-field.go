@@ -0,0 +1,252 @@
+package crypto
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// EncryptedString and EncryptedBytes are plaintext in memory and ciphertext at rest: as struct fields, they are
+// encrypted when written to a database (driver.Valuer) or marshaled to JSON, and decrypted when scanned from a
+// database (sql.Scanner) or unmarshaled from JSON. They encrypt with the primary key of the keyring registered with
+// RegisterFieldKeyring (or RegisterFieldKey), and decrypt with whichever of its keys produced the ciphertext, so the
+// keys can be rotated.
+//
+// EncryptedString is stored as base64-encoded text, as produced by EncryptStringToBase64 (so existing columns
+// encrypted that way can be read, provided the key is in the keyring); EncryptedBytes is stored as binary, and a nil
+// EncryptedBytes as NULL. In JSON, both are base64-encoded strings. Each value is encrypted with a random nonce, so
+// encrypted columns cannot be compared or indexed (see EncryptDeterministic).
+
+var fieldKeyring struct {
+	sync.RWMutex
+	keyring *Keyring
+}
+
+// RegisterFieldKeyring sets the keyring that EncryptedString and EncryptedBytes values are encrypted and decrypted
+// with; nil unregisters it. The keyring is used directly, so keys later added to or rotated in it take effect.
+func RegisterFieldKeyring(kr *Keyring) {
+
+	fieldKeyring.Lock()
+	defer fieldKeyring.Unlock()
+
+	fieldKeyring.keyring = kr
+}
+
+// RegisterFieldKey registers a keyring holding only the key (see RegisterFieldKeyring).
+func RegisterFieldKey(key *AES256Key) error {
+
+	if key == nil {
+		return errors.New("tried to register nil key")
+	}
+
+	kr := NewKeyring()
+	if _, err := kr.Add(key); err != nil {
+		return err
+	}
+
+	RegisterFieldKeyring(kr)
+	return nil
+}
+
+func registeredFieldKeyring() (*Keyring, error) {
+
+	fieldKeyring.RLock()
+	defer fieldKeyring.RUnlock()
+
+	if fieldKeyring.keyring == nil {
+		return nil, errors.New("no keyring is registered for encrypted fields; see RegisterFieldKeyring")
+	}
+
+	return fieldKeyring.keyring, nil
+}
+
+// EncryptedString is a string that is encrypted at rest (see RegisterFieldKeyring).
+type EncryptedString string
+
+// Value implements driver.Valuer, encrypting the string to base64-encoded text.
+func (s EncryptedString) Value() (driver.Value, error) {
+
+	kr, err := registeredFieldKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	return kr.EncryptStringToBase64(string(s))
+}
+
+// Scan implements sql.Scanner, decrypting base64-encoded text produced by Value. NULL scans as the empty string.
+func (s *EncryptedString) Scan(src interface{}) error {
+
+	var base64Ciphertext string
+
+	switch src := src.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case string:
+		base64Ciphertext = src
+	case []byte:
+		base64Ciphertext = string(src)
+	default:
+		return fmt.Errorf("cannot scan %T into an EncryptedString", src)
+	}
+
+	kr, err := registeredFieldKeyring()
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := kr.DecryptStringFromBase64(base64Ciphertext)
+	if err != nil {
+		return err
+	}
+
+	*s = EncryptedString(plaintext)
+	return nil
+}
+
+// MarshalJSON encrypts the string to a base64-encoded JSON string.
+func (s EncryptedString) MarshalJSON() ([]byte, error) {
+	return marshalEncryptedField([]byte(s))
+}
+
+// UnmarshalJSON decrypts a base64-encoded JSON string produced by MarshalJSON. null is ignored.
+func (s *EncryptedString) UnmarshalJSON(data []byte) error {
+
+	plaintext, err := unmarshalEncryptedField(data)
+	if err != nil || plaintext == nil {
+		return err
+	}
+
+	*s = EncryptedString(plaintext)
+	return nil
+}
+
+// EncryptedBytes is a byte slice that is encrypted at rest (see RegisterFieldKeyring).
+type EncryptedBytes []byte
+
+// Value implements driver.Valuer, encrypting the bytes to binary; nil is stored as NULL.
+func (b EncryptedBytes) Value() (driver.Value, error) {
+
+	if b == nil {
+		return nil, nil
+	}
+
+	kr, err := registeredFieldKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	return kr.Encrypt(b)
+}
+
+// Scan implements sql.Scanner, decrypting binary produced by Value. NULL scans as nil.
+func (b *EncryptedBytes) Scan(src interface{}) error {
+
+	var ciphertext []byte
+
+	switch src := src.(type) {
+	case nil:
+		*b = nil
+		return nil
+	case string:
+		ciphertext = []byte(src)
+	case []byte:
+		ciphertext = src
+	default:
+		return fmt.Errorf("cannot scan %T into EncryptedBytes", src)
+	}
+
+	kr, err := registeredFieldKeyring()
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := kr.Decrypt(ciphertext)
+	if err != nil {
+		return err
+	}
+
+	// an empty value is not NULL
+	if plaintext == nil {
+		plaintext = []byte{}
+	}
+
+	*b = plaintext
+	return nil
+}
+
+// MarshalJSON encrypts the bytes to a base64-encoded JSON string; nil is marshaled as null.
+func (b EncryptedBytes) MarshalJSON() ([]byte, error) {
+
+	if b == nil {
+		return []byte("null"), nil
+	}
+
+	return marshalEncryptedField(b)
+}
+
+// UnmarshalJSON decrypts a base64-encoded JSON string produced by MarshalJSON. null is ignored.
+func (b *EncryptedBytes) UnmarshalJSON(data []byte) error {
+
+	plaintext, err := unmarshalEncryptedField(data)
+	if err != nil || plaintext == nil {
+		return err
+	}
+
+	*b = plaintext
+	return nil
+}
+
+func marshalEncryptedField(plaintext []byte) ([]byte, error) {
+
+	kr, err := registeredFieldKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := kr.Encrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(base64.StdEncoding.EncodeToString(ciphertext))
+}
+
+// unmarshalEncryptedField returns the decrypted plaintext, or nil for null.
+func unmarshalEncryptedField(data []byte) ([]byte, error) {
+
+	var base64Ciphertext *string
+	if err := json.Unmarshal(data, &base64Ciphertext); err != nil {
+		return nil, err
+	}
+
+	if base64Ciphertext == nil {
+		return nil, nil
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(*base64Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	kr, err := registeredFieldKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := kr.Decrypt(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	// an empty plaintext is not null
+	if plaintext == nil {
+		plaintext = []byte{}
+	}
+
+	return plaintext, nil
+}
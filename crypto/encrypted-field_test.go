@@ -0,0 +1,207 @@
+package crypto_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// the encrypted field types must be usable as struct fields with database/sql
+var (
+	_ sql.Scanner   = (*crypto.EncryptedString)(nil)
+	_ driver.Valuer = crypto.EncryptedString("")
+	_ sql.Scanner   = (*crypto.EncryptedBytes)(nil)
+	_ driver.Valuer = crypto.EncryptedBytes(nil)
+)
+
+type customer struct {
+	Name  string                 `json:"name"`
+	Email crypto.EncryptedString `json:"email"`
+	Notes crypto.EncryptedBytes  `json:"notes"`
+}
+
+var _ = Describe("Encrypted fields", func() {
+	var keyring *crypto.Keyring
+
+	BeforeEach(func() {
+		keyring = crypto.NewKeyring()
+		_, err := keyring.Add(&fixedKey)
+		Expect(err).To(BeNil())
+		crypto.RegisterFieldKeyring(keyring)
+	})
+
+	AfterEach(func() {
+		crypto.RegisterFieldKeyring(nil)
+	})
+
+	Describe("EncryptedString", func() {
+		It("encrypts to base64-encoded text and scans it back", func() {
+			value, err := crypto.EncryptedString("alice@example.com").Value()
+			Expect(err).To(BeNil())
+			Expect(value).To(BeAssignableToTypeOf(""))
+			Expect(value).NotTo(ContainSubstring("alice"))
+
+			plaintext, err := crypto.DecryptStringFromBase64(value.(string), &fixedKey)
+			Expect(err).To(BeNil())
+			Expect(plaintext).To(Equal("alice@example.com"))
+
+			for _, src := range []interface{}{value, []byte(value.(string))} {
+				var s crypto.EncryptedString
+				Expect(s.Scan(src)).To(Succeed())
+				Expect(s).To(Equal(crypto.EncryptedString("alice@example.com")))
+			}
+		})
+
+		It("scans values encrypted with EncryptStringToBase64", func() {
+			base64Ciphertext, err := crypto.EncryptStringToBase64("alice@example.com", &fixedKey)
+			Expect(err).To(BeNil())
+
+			var s crypto.EncryptedString
+			Expect(s.Scan(base64Ciphertext)).To(Succeed())
+			Expect(string(s)).To(Equal("alice@example.com"))
+		})
+
+		It("scans NULL as the empty string", func() {
+			s := crypto.EncryptedString("old")
+			Expect(s.Scan(nil)).To(Succeed())
+			Expect(s).To(Equal(crypto.EncryptedString("")))
+		})
+
+		It("rejects values it cannot decrypt", func() {
+			var s crypto.EncryptedString
+			Expect(s.Scan("not base64!")).NotTo(Succeed())
+			Expect(s.Scan(base64.StdEncoding.EncodeToString([]byte("not a ciphertext")))).NotTo(Succeed())
+			Expect(s.Scan(int64(1))).NotTo(Succeed())
+
+			other, err := crypto.EncryptStringToBase64("test", crypto.NewRandomAESKey())
+			Expect(err).To(BeNil())
+			Expect(s.Scan(other)).NotTo(Succeed())
+		})
+	})
+
+	Describe("EncryptedBytes", func() {
+		It("encrypts to binary and scans it back", func() {
+			value, err := crypto.EncryptedBytes("secret notes").Value()
+			Expect(err).To(BeNil())
+			Expect(value).To(BeAssignableToTypeOf([]byte{}))
+
+			plaintext, err := crypto.Decrypt(value.([]byte), &fixedKey)
+			Expect(err).To(BeNil())
+			Expect(plaintext).To(Equal([]byte("secret notes")))
+
+			var b crypto.EncryptedBytes
+			Expect(b.Scan(value)).To(Succeed())
+			Expect(b).To(Equal(crypto.EncryptedBytes("secret notes")))
+		})
+
+		It("stores nil as NULL, and distinguishes it from empty", func() {
+			value, err := crypto.EncryptedBytes(nil).Value()
+			Expect(err).To(BeNil())
+			Expect(value).To(BeNil())
+
+			b := crypto.EncryptedBytes("old")
+			Expect(b.Scan(nil)).To(Succeed())
+			Expect(b).To(BeNil())
+
+			value, err = crypto.EncryptedBytes{}.Value()
+			Expect(err).To(BeNil())
+			Expect(value).NotTo(BeNil())
+
+			Expect(b.Scan(value)).To(Succeed())
+			Expect(b).NotTo(BeNil())
+			Expect(b).To(BeEmpty())
+		})
+
+		It("rejects values it cannot decrypt", func() {
+			var b crypto.EncryptedBytes
+			Expect(b.Scan([]byte("not a ciphertext"))).NotTo(Succeed())
+			Expect(b.Scan(3.14)).NotTo(Succeed())
+		})
+	})
+
+	Describe("JSON", func() {
+		It("encrypts fields when marshaling and decrypts them when unmarshaling", func() {
+			c := customer{Name: "Alice", Email: "alice@example.com", Notes: crypto.EncryptedBytes("VIP")}
+
+			data, err := json.Marshal(&c)
+			Expect(err).To(BeNil())
+			Expect(string(data)).To(ContainSubstring(`"name":"Alice"`))
+			Expect(string(data)).NotTo(ContainSubstring("alice@example.com"))
+			Expect(string(data)).NotTo(ContainSubstring("VIP"))
+
+			var c2 customer
+			Expect(json.Unmarshal(data, &c2)).To(Succeed())
+			Expect(c2).To(Equal(c))
+		})
+
+		It("marshals nil bytes as null", func() {
+			data, err := json.Marshal(&customer{Name: "Bob"})
+			Expect(err).To(BeNil())
+			Expect(string(data)).To(ContainSubstring(`"notes":null`))
+
+			var c customer
+			Expect(json.Unmarshal(data, &c)).To(Succeed())
+			Expect(c.Email).To(Equal(crypto.EncryptedString("")))
+			Expect(c.Notes).To(BeNil())
+		})
+
+		It("rejects values it cannot decrypt", func() {
+			var c customer
+			Expect(json.Unmarshal([]byte(`{"email": "not base64!"}`), &c)).NotTo(Succeed())
+			Expect(json.Unmarshal([]byte(`{"email": 1}`), &c)).NotTo(Succeed())
+			Expect(json.Unmarshal([]byte(`{"notes": "bm90IGEgY2lwaGVydGV4dA=="}`), &c)).NotTo(Succeed())
+		})
+	})
+
+	It("decrypts with older keys after the keyring is rotated", func() {
+		value, err := crypto.EncryptedString("alice@example.com").Value()
+		Expect(err).To(BeNil())
+
+		_, err = keyring.Rotate()
+		Expect(err).To(BeNil())
+
+		newValue, err := crypto.EncryptedString("alice@example.com").Value()
+		Expect(err).To(BeNil())
+
+		_, err = crypto.DecryptStringFromBase64(newValue.(string), &fixedKey)
+		Expect(err).NotTo(BeNil())
+
+		for _, v := range []driver.Value{value, newValue} {
+			var s crypto.EncryptedString
+			Expect(s.Scan(v)).To(Succeed())
+			Expect(string(s)).To(Equal("alice@example.com"))
+		}
+	})
+
+	It("can be registered with a single key", func() {
+		key := crypto.NewRandomAESKey()
+		Expect(crypto.RegisterFieldKey(key)).To(Succeed())
+
+		value, err := crypto.EncryptedString("test").Value()
+		Expect(err).To(BeNil())
+
+		plaintext, err := crypto.DecryptStringFromBase64(value.(string), key)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal("test"))
+
+		Expect(crypto.RegisterFieldKey(nil)).NotTo(Succeed())
+	})
+
+	It("requires a registered keyring", func() {
+		crypto.RegisterFieldKeyring(nil)
+
+		_, err := crypto.EncryptedString("test").Value()
+		Expect(err).NotTo(BeNil())
+
+		_, err = json.Marshal(crypto.EncryptedBytes("test"))
+		Expect(err).NotTo(BeNil())
+
+		var s crypto.EncryptedString
+		Expect(s.Scan("AAAA")).NotTo(Succeed())
+	})
+})
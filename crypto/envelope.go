@@ -0,0 +1,209 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeyEncryptionKeyProvider wraps and unwraps data keys with a key-encryption key (KEK) that it manages, e.g. a key
+// held in a cloud KMS.
+type KeyEncryptionKeyProvider interface {
+	// WrapKey encrypts the data key with the KEK.
+	WrapKey(dataKey *AES256Key) ([]byte, error)
+	// UnwrapKey decrypts a data key previously wrapped by WrapKey.
+	UnwrapKey(wrappedKey []byte) (*AES256Key, error)
+}
+
+// EnvelopeEncrypt encrypts the plaintext with a new, random data key, wraps the data key with the provider's
+// key-encryption key, and returns the result; the wrapped data key is stored in the ciphertext's header.
+func EnvelopeEncrypt(plaintext []byte, kek KeyEncryptionKeyProvider) ([]byte, error) {
+	return EnvelopeEncryptWithAAD(plaintext, nil, kek)
+}
+
+// EnvelopeDecrypt unwraps the data key stored in the ciphertext (e.g. from a previous call to EnvelopeEncrypt) with
+// the provider's key-encryption key, decrypts the ciphertext with the data key, and returns the result.
+func EnvelopeDecrypt(ciphertext []byte, kek KeyEncryptionKeyProvider) ([]byte, error) {
+	return EnvelopeDecryptWithAAD(ciphertext, nil, kek)
+}
+
+// EnvelopeEncryptWithAAD is like EnvelopeEncrypt, but binds the ciphertext to the additional data (see
+// EncryptWithAAD).
+func EnvelopeEncryptWithAAD(plaintext []byte, additionalData []byte, kek KeyEncryptionKeyProvider) ([]byte, error) {
+	return EnvelopeEncryptWithOptions(plaintext, kek, EncryptOptions{AdditionalData: additionalData})
+}
+
+// EnvelopeEncryptWithOptions is like EnvelopeEncrypt, but encrypts with the provided options (see
+// EncryptWithOptions). Envelope ciphertexts are always AES-256-GCM and cannot be compressed; the data key is used
+// once, so it is not counted by a usage counter.
+func EnvelopeEncryptWithOptions(plaintext []byte, kek KeyEncryptionKeyProvider, options EncryptOptions) ([]byte, error) {
+
+	h, dataKey, err := newEnvelopeHeader(0, kek, options)
+	if err != nil {
+		return nil, err
+	}
+	defer dataKey.Destroy()
+
+	return seal(h, dataKey, plaintext, options.AdditionalData, options.random())
+}
+
+// EnvelopeDecryptWithAAD is like EnvelopeDecrypt, but the additional data must match the additional data provided to
+// EnvelopeEncryptWithAAD.
+func EnvelopeDecryptWithAAD(ciphertext []byte, additionalData []byte, kek KeyEncryptionKeyProvider) ([]byte, error) {
+
+	if kek == nil {
+		return nil, errors.New("tried to decrypt with nil key-encryption key provider")
+	}
+
+	resolveKey, done := resolveWithKEK(kek)
+	defer done()
+
+	return open(ciphertext, additionalData, resolveKey)
+}
+
+// NewEnvelopeEncryptingWriter is like NewEncryptingWriterWithAAD, but encrypts with a new, random data key that is
+// wrapped with the provider's key-encryption key and stored in the stream's header. Use NewEnvelopeDecryptingReader
+// to decrypt the result.
+func NewEnvelopeEncryptingWriter(w io.Writer, additionalData []byte, kek KeyEncryptionKeyProvider) (io.WriteCloser, error) {
+	return NewEnvelopeEncryptingWriterWithOptions(w, kek, EncryptOptions{AdditionalData: additionalData})
+}
+
+// NewEnvelopeEncryptingWriterWithOptions is like NewEnvelopeEncryptingWriter, but encrypts with the provided options
+// (see EnvelopeEncryptWithOptions).
+func NewEnvelopeEncryptingWriterWithOptions(w io.Writer, kek KeyEncryptionKeyProvider, options EncryptOptions) (io.WriteCloser, error) {
+
+	h, dataKey, err := newEnvelopeHeader(FlagStream, kek, options)
+	if err != nil {
+		return nil, err
+	}
+	defer dataKey.Destroy()
+
+	return newEncryptingWriter(w, h, dataKey, options.AdditionalData, options.random())
+}
+
+// NewEnvelopeDecryptingReader is like NewDecryptingReaderWithAAD, but decrypts with the data key stored in the
+// stream's header, unwrapped with the provider's key-encryption key.
+func NewEnvelopeDecryptingReader(r io.Reader, additionalData []byte, kek KeyEncryptionKeyProvider) (io.Reader, error) {
+
+	if kek == nil {
+		return nil, errors.New("tried to decrypt with nil key-encryption key provider")
+	}
+
+	resolveKey, done := resolveWithKEK(kek)
+	defer done()
+
+	return newDecryptingReader(r, additionalData, resolveKey)
+}
+
+// newEnvelopeHeader generates a new data key from the options' source of randomness, and returns it along with a
+// header that records it, wrapped with the provider's key-encryption key.
+func newEnvelopeHeader(flags byte, kek KeyEncryptionKeyProvider, options EncryptOptions) (*Header, *AES256Key, error) {
+
+	if kek == nil {
+		return nil, nil, errors.New("tried to encrypt with nil key-encryption key provider")
+	}
+
+	if options.Cipher != 0 && options.Cipher != CipherAES256GCM {
+		return nil, nil, errors.New("envelope encryption only supports AES-256-GCM")
+	}
+
+	if options.Compression != CompressionNone {
+		return nil, nil, errors.New("envelope encryption does not support compression")
+	}
+
+	dataKey, err := NewAESKeyFromReader(options.random())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wrappedKey, err := kek.WrapKey(dataKey)
+	if err != nil {
+		dataKey.Destroy()
+		return nil, nil, fmt.Errorf("failed to wrap the data key: %v", err)
+	}
+
+	if len(wrappedKey) > maxSectionLength {
+		dataKey.Destroy()
+		return nil, nil, fmt.Errorf("wrapped data key is too long (%d bytes)", len(wrappedKey))
+	}
+
+	h := newHeader(CipherAES256GCM, flags|FlagEnvelope, dataKey)
+	h.WrappedKey = wrappedKey
+
+	return h, dataKey, nil
+}
+
+// resolveWithKEK returns a keyResolver that unwraps the data key with the provider's key-encryption key; done zeroes
+// the unwrapped data key once it is no longer needed.
+func resolveWithKEK(kek KeyEncryptionKeyProvider) (resolveKey keyResolver, done func()) {
+
+	var dataKey *AES256Key
+
+	resolveKey = func(h *Header) (*AES256Key, error) {
+
+		if h.Flags&FlagEnvelope == 0 {
+			return nil, errors.New("ciphertext is not envelope-encrypted; use Decrypt")
+		}
+
+		var err error
+		if dataKey, err = kek.UnwrapKey(h.WrappedKey); err != nil {
+			return nil, fmt.Errorf("failed to unwrap the data key: %v", err)
+		}
+
+		if h.KeyID != dataKey.ID() {
+			return nil, errors.New("unwrapped data key does not match the ciphertext")
+		}
+
+		return dataKey, nil
+	}
+
+	done = func() {
+		dataKey.Destroy()
+	}
+
+	return resolveKey, done
+}
+
+// LocalKEKProvider is a KeyEncryptionKeyProvider backed by an AES256Key held in memory.
+type LocalKEKProvider struct {
+	kek *AES256Key
+}
+
+// NewLocalKEKProvider returns a LocalKEKProvider that wraps data keys with the provided key.
+func NewLocalKEKProvider(kek *AES256Key) (*LocalKEKProvider, error) {
+
+	if kek == nil {
+		return nil, errors.New("tried to create a key-encryption key provider with nil key")
+	}
+
+	kekCopy := *kek
+	return &LocalKEKProvider{kek: &kekCopy}, nil
+}
+
+// WrapKey encrypts the data key with the key-encryption key.
+func (p *LocalKEKProvider) WrapKey(dataKey *AES256Key) ([]byte, error) {
+
+	if dataKey == nil {
+		return nil, errors.New("tried to wrap nil key")
+	}
+
+	return Encrypt(dataKey[:], p.kek)
+}
+
+// UnwrapKey decrypts a data key previously wrapped by WrapKey.
+func (p *LocalKEKProvider) UnwrapKey(wrappedKey []byte) (*AES256Key, error) {
+
+	keyBytes, err := Decrypt(wrappedKey, p.kek)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(keyBytes)
+
+	return newAESKeyFromBytes(keyBytes)
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,235 @@
+package crypto_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type failingKEKProvider struct{}
+
+func (failingKEKProvider) WrapKey(dataKey *crypto.AES256Key) ([]byte, error) {
+	return nil, errors.New("unavailable")
+}
+
+func (failingKEKProvider) UnwrapKey(wrappedKey []byte) (*crypto.AES256Key, error) {
+	return nil, errors.New("unavailable")
+}
+
+var _ = Describe("EnvelopeEncrypt", func() {
+	var kek *crypto.LocalKEKProvider
+
+	BeforeEach(func() {
+		var err error
+		kek, err = crypto.NewLocalKEKProvider(&fixedKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("stores the wrapped data key in the header", func() {
+		ciphertext, err := crypto.EnvelopeEncrypt([]byte("test"), kek)
+		Expect(err).To(BeNil())
+
+		h, err := crypto.ParseHeader(ciphertext)
+		Expect(err).To(BeNil())
+		Expect(h.Flags & crypto.FlagEnvelope).To(Equal(crypto.FlagEnvelope))
+		Expect(h.WrappedKey).NotTo(BeEmpty())
+
+		dataKey, err := kek.UnwrapKey(h.WrappedKey)
+		Expect(err).To(BeNil())
+		Expect(h.KeyID).To(Equal(dataKey.ID()))
+	})
+
+	It("uses a new data key for every call", func() {
+		ciphertext1, err := crypto.EnvelopeEncrypt([]byte("test"), kek)
+		Expect(err).To(BeNil())
+		ciphertext2, err := crypto.EnvelopeEncrypt([]byte("test"), kek)
+		Expect(err).To(BeNil())
+
+		h1, err := crypto.ParseHeader(ciphertext1)
+		Expect(err).To(BeNil())
+		h2, err := crypto.ParseHeader(ciphertext2)
+		Expect(err).To(BeNil())
+		Expect(h1.KeyID).NotTo(Equal(h2.KeyID))
+	})
+
+	It("requires a provider that can wrap the key", func() {
+		ciphertext, err := crypto.EnvelopeEncrypt([]byte("test"), nil)
+		Expect(ciphertext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+
+		ciphertext, err = crypto.EnvelopeEncrypt([]byte("test"), failingKEKProvider{})
+		Expect(ciphertext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("EnvelopeDecrypt", func() {
+	var kek *crypto.LocalKEKProvider
+
+	BeforeEach(func() {
+		var err error
+		kek, err = crypto.NewLocalKEKProvider(&fixedKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("returns plaintext originally encrypted by EnvelopeEncrypt with the same key-encryption key", func() {
+		ciphertext, err := crypto.EnvelopeEncrypt([]byte("test"), kek)
+		Expect(err).To(BeNil())
+
+		plaintext, err := crypto.EnvelopeDecrypt(ciphertext, kek)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+
+		otherKEK, err := crypto.NewLocalKEKProvider(crypto.NewRandomAESKey())
+		Expect(err).To(BeNil())
+
+		plaintext, err = crypto.EnvelopeDecrypt(ciphertext, otherKEK)
+		Expect(plaintext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("detects a substituted wrapped key", func() {
+		ciphertext1, err := crypto.EnvelopeEncrypt([]byte("test"), kek)
+		Expect(err).To(BeNil())
+		ciphertext2, err := crypto.EnvelopeEncrypt([]byte("test"), kek)
+		Expect(err).To(BeNil())
+
+		h2, err := crypto.ParseHeader(ciphertext2)
+		Expect(err).To(BeNil())
+
+		// whitebox: the wrapped key follows the 15-byte fixed header and its 2-byte length
+		spliced := append([]byte{}, ciphertext1...)
+		copy(spliced[17:], h2.WrappedKey)
+
+		_, err = crypto.EnvelopeDecrypt(spliced, kek)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("is not interchangeable with Decrypt", func() {
+		ciphertext, err := crypto.EnvelopeEncrypt([]byte("test"), kek)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.Decrypt(ciphertext, &fixedKey)
+		Expect(err).NotTo(BeNil())
+
+		ciphertext, err = crypto.Encrypt([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.EnvelopeDecrypt(ciphertext, kek)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires a provider that can unwrap the key", func() {
+		ciphertext, err := crypto.EnvelopeEncrypt([]byte("test"), kek)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.EnvelopeDecrypt(ciphertext, nil)
+		Expect(err).NotTo(BeNil())
+
+		_, err = crypto.EnvelopeDecrypt(ciphertext, failingKEKProvider{})
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Envelope additional data and streams", func() {
+	var kek *crypto.LocalKEKProvider
+
+	BeforeEach(func() {
+		var err error
+		kek, err = crypto.NewLocalKEKProvider(&fixedKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("binds the ciphertext to the additional data", func() {
+		ciphertext, err := crypto.EnvelopeEncryptWithAAD([]byte("test"), []byte("row-42"), kek)
+		Expect(err).To(BeNil())
+
+		plaintext, err := crypto.EnvelopeDecryptWithAAD(ciphertext, []byte("row-42"), kek)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+
+		_, err = crypto.EnvelopeDecryptWithAAD(ciphertext, []byte("row-43"), kek)
+		Expect(err).NotTo(BeNil())
+
+		_, err = crypto.EnvelopeDecrypt(ciphertext, kek)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("round-trips streams", func() {
+		plaintext := patternedBytes(crypto.StreamChunkSize + 1)
+
+		var buf bytes.Buffer
+		w, err := crypto.NewEnvelopeEncryptingWriter(&buf, []byte("backup-42"), kek)
+		Expect(err).To(BeNil())
+		_, err = w.Write(plaintext)
+		Expect(err).To(BeNil())
+		Expect(w.Close()).To(Succeed())
+
+		r, err := crypto.NewEnvelopeDecryptingReader(bytes.NewReader(buf.Bytes()), []byte("backup-42"), kek)
+		Expect(err).To(BeNil())
+		plaintext2, err := ioutil.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+
+		_, err = crypto.NewEnvelopeDecryptingReader(bytes.NewReader(buf.Bytes()), nil, failingKEKProvider{})
+		Expect(err).NotTo(BeNil())
+
+		_, err = decryptStream(buf.Bytes(), &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("rejects options envelopes do not support", func() {
+		for _, options := range []crypto.EncryptOptions{
+			{Cipher: crypto.CipherXChaCha20Poly1305},
+			{Compression: crypto.CompressionGzip},
+		} {
+			_, err := crypto.EnvelopeEncryptWithOptions([]byte("test"), kek, options)
+			Expect(err).NotTo(BeNil())
+
+			_, err = crypto.NewEnvelopeEncryptingWriterWithOptions(&bytes.Buffer{}, kek, options)
+			Expect(err).NotTo(BeNil())
+		}
+
+		ciphertext, err := crypto.EnvelopeEncryptWithOptions([]byte("test"), kek, crypto.EncryptOptions{Cipher: crypto.CipherAES256GCM})
+		Expect(err).To(BeNil())
+		plaintext, err := crypto.EnvelopeDecrypt(ciphertext, kek)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+	})
+
+	It("requires a provider", func() {
+		w, err := crypto.NewEnvelopeEncryptingWriter(&bytes.Buffer{}, nil, nil)
+		Expect(w).To(BeNil())
+		Expect(err).NotTo(BeNil())
+
+		r, err := crypto.NewEnvelopeDecryptingReader(&bytes.Buffer{}, nil, nil)
+		Expect(r).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("LocalKEKProvider", func() {
+	It("requires a valid key", func() {
+		kek, err := crypto.NewLocalKEKProvider(nil)
+		Expect(kek).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("wraps and unwraps data keys", func() {
+		kek, err := crypto.NewLocalKEKProvider(&fixedKey)
+		Expect(err).To(BeNil())
+
+		dataKey := crypto.NewRandomAESKey()
+		wrappedKey, err := kek.WrapKey(dataKey)
+		Expect(err).To(BeNil())
+		Expect(wrappedKey).NotTo(ContainSubstring(string(dataKey[:])))
+
+		unwrappedKey, err := kek.UnwrapKey(wrappedKey)
+		Expect(err).To(BeNil())
+		Expect(crypto.Equal(unwrappedKey, dataKey)).To(Equal(true))
+	})
+})
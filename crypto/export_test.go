@@ -0,0 +1,45 @@
+package crypto
+
+import "crypto/aes"
+
+// Exports of unexported code for the tests in package crypto_test.
+
+var NewGCMSIV = newGCMSIV
+
+const GCMSIVNonceSize = gcmSIVNonceSize
+
+// Polyval returns POLYVAL(H, X_1, ..., X_n) of the message (RFC 8452).
+func Polyval(h [aes.BlockSize]byte, message []byte) [aes.BlockSize]byte {
+
+	p := newPolyval(h)
+	p.update(message)
+	return p.sum()
+}
+
+// SIV is an AES-SIV cipher (RFC 5297).
+type SIV struct {
+	s *siv
+}
+
+func NewSIV(macKey, ctrKey []byte) (*SIV, error) {
+
+	s, err := newSIV(macKey, ctrKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SIV{s: s}, nil
+}
+
+func (s *SIV) Seal(plaintext []byte, additionalData ...[]byte) []byte {
+	return s.s.seal(plaintext, additionalData...)
+}
+
+func (s *SIV) Open(ciphertext []byte, additionalData ...[]byte) ([]byte, error) {
+	return s.s.open(ciphertext, additionalData...)
+}
+
+// CMAC returns the AES-CMAC (RFC 4493) of the message with the SIV's CMAC key.
+func (s *SIV) CMAC(message []byte) [aes.BlockSize]byte {
+	return s.s.cmac(message)
+}
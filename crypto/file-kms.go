@@ -0,0 +1,189 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// FileKMS is a KeyEncryptionKeyProvider that mimics a cloud KMS with a local JSON file of named, versioned keys, so
+// that envelope encryption can be exercised without network access. Like a cloud KMS, the file is read on every
+// call, wrapping uses the newest version of the key, and a wrapped key can only be unwrapped through the key that
+// wrapped it.
+// FileKMS is intended for tests and local development: the keys are stored unprotected.
+type FileKMS struct {
+	mu      sync.Mutex
+	path    string
+	keyName string
+}
+
+type fileKMSData struct {
+	// Keys maps key names to base64-encoded key versions, oldest first.
+	Keys map[string][]string `json:"keys"`
+}
+
+// NewFileKMS returns a FileKMS for the named key in the file at path. The file and the key are created if they do
+// not already exist.
+func NewFileKMS(path, keyName string) (*FileKMS, error) {
+
+	if keyName == "" {
+		return nil, errors.New("zero-value key name")
+	}
+
+	kms := &FileKMS{path: path, keyName: keyName}
+
+	kms.mu.Lock()
+	defer kms.mu.Unlock()
+
+	data, err := kms.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data.Keys[keyName]) == 0 {
+		data.Keys[keyName] = []string{NewRandomAESKey().ToBase64()}
+		if err := kms.save(data); err != nil {
+			return nil, err
+		}
+	}
+
+	return kms, nil
+}
+
+// RotateKey adds a new version of the key. Wrapping uses the new version; keys wrapped by older versions can still
+// be unwrapped.
+func (kms *FileKMS) RotateKey() error {
+
+	kms.mu.Lock()
+	defer kms.mu.Unlock()
+
+	data, err := kms.load()
+	if err != nil {
+		return err
+	}
+
+	data.Keys[kms.keyName] = append(data.Keys[kms.keyName], NewRandomAESKey().ToBase64())
+	return kms.save(data)
+}
+
+// WrapKey encrypts the data key with the newest version of the key.
+func (kms *FileKMS) WrapKey(dataKey *AES256Key) ([]byte, error) {
+
+	if dataKey == nil {
+		return nil, errors.New("tried to wrap nil key")
+	}
+
+	keyring, err := kms.keyring()
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := keyring.Encrypt(dataKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// like a cloud KMS ciphertext, the wrapped key names the key that produced it
+	return append(appendSection(nil, []byte(kms.keyName)), ciphertext...), nil
+}
+
+// UnwrapKey decrypts a data key previously wrapped by WrapKey, with whichever version of the key wrapped it.
+func (kms *FileKMS) UnwrapKey(wrappedKey []byte) (*AES256Key, error) {
+
+	r := bytes.NewReader(wrappedKey)
+
+	keyName, _, err := readSection(r, nil)
+	if err != nil {
+		return nil, errors.New("malformed wrapped key")
+	}
+
+	if string(keyName) != kms.keyName {
+		return nil, fmt.Errorf("key was wrapped by KMS key %q, not %q", keyName, kms.keyName)
+	}
+
+	keyring, err := kms.keyring()
+	if err != nil {
+		return nil, err
+	}
+
+	keyBytes, err := keyring.Decrypt(wrappedKey[len(wrappedKey)-r.Len():])
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(keyBytes)
+
+	return newAESKeyFromBytes(keyBytes)
+}
+
+// keyring returns a Keyring holding every version of the key, with the newest as the primary key.
+func (kms *FileKMS) keyring() (*Keyring, error) {
+
+	kms.mu.Lock()
+	defer kms.mu.Unlock()
+
+	data, err := kms.load()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := data.Keys[kms.keyName]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("KMS key %q does not exist", kms.keyName)
+	}
+
+	keyring := NewKeyring()
+
+	for i, base64Key := range versions {
+		key, err := NewAESKeyFromBase64(base64Key)
+		if err != nil {
+			return nil, fmt.Errorf("version %d of KMS key %q is invalid: %v", i+1, kms.keyName, err)
+		}
+
+		id, err := keyring.Add(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := keyring.SetPrimary(id); err != nil {
+			return nil, err
+		}
+	}
+
+	return keyring, nil
+}
+
+func (kms *FileKMS) load() (*fileKMSData, error) {
+
+	data := &fileKMSData{}
+
+	contents, err := ioutil.ReadFile(kms.path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(contents, data); err != nil {
+			return nil, fmt.Errorf("failed to parse KMS file %s: %v", kms.path, err)
+		}
+	}
+
+	if data.Keys == nil {
+		data.Keys = make(map[string][]string)
+	}
+
+	return data, nil
+}
+
+func (kms *FileKMS) save(data *fileKMSData) error {
+
+	contents, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(kms.path, contents, 0600)
+}
@@ -0,0 +1,98 @@
+package crypto_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileKMS", func() {
+	var dir string
+	var path string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "file-kms")
+		Expect(err).To(BeNil())
+		path = filepath.Join(dir, "kms.json")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("creates the file and the key", func() {
+		_, err := crypto.NewFileKMS(path, "projects/test/keys/master")
+		Expect(err).To(BeNil())
+
+		info, err := os.Stat(path)
+		Expect(err).To(BeNil())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("requires a key name", func() {
+		kms, err := crypto.NewFileKMS(path, "")
+		Expect(kms).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("can be used for envelope encryption across instances", func() {
+		kms, err := crypto.NewFileKMS(path, "master")
+		Expect(err).To(BeNil())
+
+		ciphertext, err := crypto.EnvelopeEncrypt([]byte("test"), kms)
+		Expect(err).To(BeNil())
+
+		kms2, err := crypto.NewFileKMS(path, "master")
+		Expect(err).To(BeNil())
+
+		plaintext, err := crypto.EnvelopeDecrypt(ciphertext, kms2)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+	})
+
+	It("only unwraps keys through the key that wrapped them", func() {
+		kms, err := crypto.NewFileKMS(path, "master")
+		Expect(err).To(BeNil())
+
+		other, err := crypto.NewFileKMS(path, "other")
+		Expect(err).To(BeNil())
+
+		wrappedKey, err := kms.WrapKey(&fixedKey)
+		Expect(err).To(BeNil())
+
+		_, err = other.UnwrapKey(wrappedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("unwraps keys wrapped by older versions after rotation", func() {
+		kms, err := crypto.NewFileKMS(path, "master")
+		Expect(err).To(BeNil())
+
+		oldWrappedKey, err := kms.WrapKey(&fixedKey)
+		Expect(err).To(BeNil())
+
+		Expect(kms.RotateKey()).To(Succeed())
+
+		newWrappedKey, err := kms.WrapKey(&fixedKey)
+		Expect(err).To(BeNil())
+
+		for _, wrappedKey := range [][]byte{oldWrappedKey, newWrappedKey} {
+			key, err := kms.UnwrapKey(wrappedKey)
+			Expect(err).To(BeNil())
+			Expect(crypto.Equal(key, &fixedKey)).To(Equal(true))
+		}
+	})
+
+	It("rejects malformed wrapped keys", func() {
+		kms, err := crypto.NewFileKMS(path, "master")
+		Expect(err).To(BeNil())
+
+		_, err = kms.UnwrapKey([]byte{0})
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,242 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+const gcmSIVNonceSize = 12
+const gcmSIVTagSize = 16
+
+// gcmSIV implements AES-GCM-SIV (RFC 8452): a nonce-misuse resistant AEAD. Repeating a nonce only reveals whether
+// the same message was encrypted twice under it, rather than breaking confidentiality and authenticity as with GCM.
+type gcmSIV struct {
+	block     cipher.Block
+	keyLength int
+}
+
+// newGCMSIV returns an AES-GCM-SIV cipher.AEAD for the provided key (16 or 32 bytes).
+func newGCMSIV(key []byte) (cipher.AEAD, error) {
+
+	if len(key) != 16 && len(key) != 32 {
+		return nil, errors.New("AES-GCM-SIV requires a 128 or 256-bit key")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcmSIV{block: block, keyLength: len(key)}, nil
+}
+
+func (g *gcmSIV) NonceSize() int {
+	return gcmSIVNonceSize
+}
+
+func (g *gcmSIV) Overhead() int {
+	return gcmSIVTagSize
+}
+
+func (g *gcmSIV) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+
+	if len(nonce) != gcmSIVNonceSize {
+		panic("crypto: incorrect nonce length given to AES-GCM-SIV")
+	}
+
+	authKey, encBlock := g.deriveKeys(nonce)
+	tag := g.tag(authKey, encBlock, nonce, plaintext, additionalData)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+gcmSIVTagSize)
+	gcmSIVCTR(encBlock, tag, out[:len(plaintext)], plaintext)
+	copy(out[len(plaintext):], tag[:])
+
+	return ret
+}
+
+func (g *gcmSIV) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+
+	if len(nonce) != gcmSIVNonceSize {
+		panic("crypto: incorrect nonce length given to AES-GCM-SIV")
+	}
+
+	if len(ciphertext) < gcmSIVTagSize {
+		return nil, errors.New("message authentication failed")
+	}
+
+	var tag [aes.BlockSize]byte
+	copy(tag[:], ciphertext[len(ciphertext)-gcmSIVTagSize:])
+	ciphertext = ciphertext[:len(ciphertext)-gcmSIVTagSize]
+
+	authKey, encBlock := g.deriveKeys(nonce)
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	gcmSIVCTR(encBlock, tag, out, ciphertext)
+
+	expected := g.tag(authKey, encBlock, nonce, out, additionalData)
+	if subtle.ConstantTimeCompare(expected[:], tag[:]) != 1 {
+		zeroBytes(out)
+		return nil, errors.New("message authentication failed")
+	}
+
+	return ret, nil
+}
+
+// deriveKeys derives the per-nonce message authentication key and message encryption key.
+func (g *gcmSIV) deriveKeys(nonce []byte) ([aes.BlockSize]byte, cipher.Block) {
+
+	var authKey [aes.BlockSize]byte
+	encKey := make([]byte, 0, 32)
+
+	var in, out [aes.BlockSize]byte
+	copy(in[4:], nonce)
+
+	for i := 0; i < 2+g.keyLength/8; i++ {
+		binary.LittleEndian.PutUint32(in[:4], uint32(i))
+		g.block.Encrypt(out[:], in[:])
+
+		if i < 2 {
+			copy(authKey[i*8:], out[:8])
+		} else {
+			encKey = append(encKey, out[:8]...)
+		}
+	}
+
+	// the key length is always valid
+	encBlock, _ := aes.NewCipher(encKey)
+	zeroBytes(encKey)
+
+	return authKey, encBlock
+}
+
+func (g *gcmSIV) tag(authKey [aes.BlockSize]byte, encBlock cipher.Block, nonce, plaintext, additionalData []byte) [aes.BlockSize]byte {
+
+	var lengths [aes.BlockSize]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)
+
+	p := newPolyval(authKey)
+	p.update(additionalData)
+	p.update(plaintext)
+	p.update(lengths[:])
+	s := p.sum()
+
+	for i := range nonce {
+		s[i] ^= nonce[i]
+	}
+	s[15] &= 0x7f
+
+	encBlock.Encrypt(s[:], s[:])
+	return s
+}
+
+// gcmSIVCTR XORs src with the key stream of the tag-derived counter; the counter is the first 32 bits, little-endian.
+func gcmSIVCTR(encBlock cipher.Block, tag [aes.BlockSize]byte, dst, src []byte) {
+
+	counter := tag
+	counter[15] |= 0x80
+
+	var keyStream [aes.BlockSize]byte
+
+	for len(src) > 0 {
+		encBlock.Encrypt(keyStream[:], counter[:])
+		binary.LittleEndian.PutUint32(counter[:4], binary.LittleEndian.Uint32(counter[:4])+1)
+
+		n := len(src)
+		if n > aes.BlockSize {
+			n = aes.BlockSize
+		}
+
+		subtle.XORBytes(dst[:n], src[:n], keyStream[:n])
+		dst = dst[n:]
+		src = src[n:]
+	}
+}
+
+// polyval computes POLYVAL (RFC 8452), via its relationship to GHASH: POLYVAL(H, X_1, ..., X_n) =
+// ByteReverse(GHASH(mulX_GHASH(ByteReverse(H)), ByteReverse(X_1), ..., ByteReverse(X_n))).
+type polyval struct {
+	hHi, hLo uint64
+	yHi, yLo uint64
+}
+
+func newPolyval(h [aes.BlockSize]byte) *polyval {
+
+	hHi, hLo := byteReverse(h[:])
+
+	// mulX_GHASH
+	carry := hLo & 1
+	hLo = hLo>>1 | hHi<<63
+	hHi = hHi>>1 ^ (0xe1<<56)&-carry
+
+	return &polyval{hHi: hHi, hLo: hLo}
+}
+
+// update absorbs the message, zero-padded to a multiple of the block size.
+func (p *polyval) update(message []byte) {
+
+	for len(message) > 0 {
+		var block [aes.BlockSize]byte
+		n := copy(block[:], message)
+		message = message[n:]
+
+		xHi, xLo := byteReverse(block[:])
+		p.yHi, p.yLo = ghashMultiply(p.yHi^xHi, p.yLo^xLo, p.hHi, p.hLo)
+	}
+}
+
+func (p *polyval) sum() [aes.BlockSize]byte {
+
+	var out [aes.BlockSize]byte
+	binary.LittleEndian.PutUint64(out[:8], p.yLo)
+	binary.LittleEndian.PutUint64(out[8:], p.yHi)
+	return out
+}
+
+// byteReverse returns the block, byte-reversed, as a big-endian 128-bit value.
+func byteReverse(b []byte) (hi, lo uint64) {
+	return binary.LittleEndian.Uint64(b[8:]), binary.LittleEndian.Uint64(b[:8])
+}
+
+// ghashMultiply multiplies x and y in GF(2^128) with GHASH's bit order (NIST SP 800-38D, algorithm 1), in constant
+// time.
+func ghashMultiply(xHi, xLo, yHi, yLo uint64) (uint64, uint64) {
+
+	var zHi, zLo uint64
+	vHi, vLo := yHi, yLo
+
+	for i := 0; i < 128; i++ {
+		var bit uint64
+		if i < 64 {
+			bit = xHi >> (63 - i) & 1
+		} else {
+			bit = xLo >> (127 - i) & 1
+		}
+
+		zHi ^= vHi & -bit
+		zLo ^= vLo & -bit
+
+		carry := vLo & 1
+		vLo = vLo>>1 | vHi<<63
+		vHi = vHi>>1 ^ (0xe1<<56)&-carry
+	}
+
+	return zHi, zLo
+}
+
+// sliceForAppend extends dst by n bytes, returning the whole slice and the extension.
+func sliceForAppend(dst []byte, n int) (whole, tail []byte) {
+
+	total := len(dst) + n
+	if cap(dst) >= total {
+		whole = dst[:total]
+	} else {
+		whole = make([]byte, total)
+		copy(whole, dst)
+	}
+
+	return whole, whole[len(dst):]
+}
@@ -0,0 +1,97 @@
+package crypto_test
+
+import (
+	"encoding/hex"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("gcmSIV", func() {
+	// RFC 8452, Appendix A
+	It("computes POLYVAL", func() {
+		var h [16]byte
+		copy(h[:], decodeHex("25629347589242761d31f826ba4b757b"))
+
+		sum := crypto.Polyval(h, decodeHex("4f4f95668c83dfb6401762bb2d01a262 d1a24ddd2721d006bbe45f20d3c9f362"))
+		Expect(hex.EncodeToString(sum[:])).To(Equal("f7a3b47b846119fae5b7866cf5e5b77e"))
+	})
+
+	// RFC 8452, Appendix C.1 (AES-128-GCM-SIV) and C.2 (AES-256-GCM-SIV), all with the nonce 03000000...
+	const key128 = "01000000000000000000000000000000"
+	const key256 = "01000000000000000000000000000000 00000000000000000000000000000000"
+
+	vectors := []struct {
+		key, plaintext, additionalData, expected string
+	}{
+		{key128, "", "", "dc20e2d83f25705bb49e439eca56de25"},
+		{key128, "0100000000000000", "", "b5d839330ac7b786578782fff6013b815b287c22493a364c"},
+		{key128, "0200000000000000", "01", "1e6daba35669f4273b0a1a2560969cdf790d99759abd1508"},
+		{key128, "020000000000000000000000", "01", "296c7889fd99f41917f4462008299c5102745aaa3a0c469fad9e075a"},
+		{key128, "02000000000000000000000000000000", "01", "e2b0c5da79a901c1745f700525cb335b8f8936ec039e4e4bb97ebd8c4457441f"},
+		{key128, "02000000000000000000000000000000 03000000000000000000000000000000", "01",
+			"620048ef3c1e73e57e02bb8562c416a319e73e4caac8e96a1ecb2933145a1d71 e6af6a7f87287da059a71684ed3498e1"},
+		{key128, "02000000000000000000000000000000 03000000000000000000000000000000 04000000000000000000000000000000", "01",
+			"50c8303ea93925d64090d07bd109dfd9515a5a33431019c17d93465999a8b005 3201d723120a8562b838cdff25bf9d1e 6a8cc3865f76897c2e4b245cf31c51f2"},
+		{key128, "02000000000000000000000000000000 03000000000000000000000000000000 04000000000000000000000000000000 05000000000000000000000000000000", "01",
+			"2f5c64059db55ee0fb847ed513003746aca4e61c711b5de2e7a77ffd02da42fe ec601910d3467bb8b36ebbaebce5fba30d36c95f48a3e7980f0e7ac299332a80 cdc46ae475563de037001ef84ae21744"},
+		{key128, "02000000", "010000000000000000000000", "a8fe3e8707eb1f84fb28f8cb73de8e99e2f48a14"},
+		{key128, "03000000000000000000000000000000 0400", "01000000000000000000000000000000 0200",
+			"753b6e3b21f5c1b59bbbf34f1c36f29ab983feed66c60f7a032f7cefc98397b4 5913"},
+		{key128, "03000000000000000000000000000000 04000000", "01000000000000000000000000000000 0200",
+			"6bb0fecf5ded9b77f902c7d5da236a4391dd029724afc9805e976f451e6d87f6 fe106514"},
+		{key256, "", "", "07f5f4169bbf55a8400cd47ea6fd400f"},
+		{key256, "0100000000000000", "", "c2ef328e5c71c83b843122130f7364b761e0b97427e3df28"},
+		{key256, "0200000000000000", "01", "1de22967237a813291213f267e3b452f02d01ae33e4ec854"},
+		{key256, "020000000000000000000000", "01", "163d6f9cc1b346cd453a2e4cc1a4a19ae800941ccdc57cc8413c277f"},
+		{key256, "02000000000000000000000000000000", "01", "c91545823cc24f17dbb0e9e807d5ec17b292d28ff61189e8e49f3875ef91aff7"},
+		{key256, "02000000000000000000000000000000 03000000000000000000000000000000", "01",
+			"07dad364bfc2b9da89116d7bef6daaaf6f255510aa654f920ac81b94e8bad365 aea1bad12702e1965604374aab96dbbc"},
+		{key256, "02000000000000000000000000000000 03000000000000000000000000000000 04000000000000000000000000000000", "01",
+			"c67a1f0f567a5198aa1fcc8e3f21314336f7f51ca8b1af61feac35a86416fa47 fbca3b5f749cdf564527f2314f42fe25 03332742b228c647173616cfd44c54eb"},
+		{key256, "02000000000000000000000000000000 03000000000000000000000000000000 04000000000000000000000000000000 05000000000000000000000000000000", "01",
+			"67fd45e126bfb9a79930c43aad2d36967d3f0e4d217c1e551f59727870beefc9 8cb933a8fce9de887b1e40799988db1fc3f91880ed405b2dd298318858467c89 5bde0285037c5de81e5b570a049b62a0"},
+		{key256, "02000000", "010000000000000000000000", "22b3f4cd1835e517741dfddccfa07fa4661b74cf"},
+		{key256, "03000000000000000000000000000000 0400", "01000000000000000000000000000000 0200",
+			"c79dda228c3c33480c6d8c6c481056fca016f30a8abc27f2f8446ece82b500b7 08c3"},
+		{key256, "03000000000000000000000000000000 04000000", "01000000000000000000000000000000 0200",
+			"43dd0163cdb48f9fe3212bf61b201976067f342bb879ad976d8242acc188ab59 cabfe307"},
+	}
+
+	It("matches the RFC 8452 test vectors", func() {
+		nonce := decodeHex("030000000000000000000000")
+
+		for _, v := range vectors {
+			aead, err := crypto.NewGCMSIV(decodeHex(v.key))
+			Expect(err).To(BeNil())
+
+			ciphertext := aead.Seal(nil, nonce, decodeHex(v.plaintext), decodeHex(v.additionalData))
+			Expect(ciphertext).To(Equal(decodeHex(v.expected)), v.plaintext)
+
+			plaintext, err := aead.Open(nil, nonce, ciphertext, decodeHex(v.additionalData))
+			Expect(err).To(BeNil())
+			Expect(plaintext).To(Equal(decodeHex(v.plaintext)))
+
+			_, err = aead.Open(nil, nonce, ciphertext, append(decodeHex(v.additionalData), 0))
+			Expect(err).NotTo(BeNil())
+		}
+	})
+
+	It("authenticates the ciphertext and additional data", func() {
+		aead, err := crypto.NewGCMSIV(make([]byte, 32))
+		Expect(err).To(BeNil())
+
+		nonce := make([]byte, crypto.GCMSIVNonceSize)
+		plaintext := []byte("a plaintext that spans several AES blocks")
+
+		ciphertext := aead.Seal(nil, nonce, plaintext, []byte("aad"))
+
+		_, err = aead.Open(nil, nonce, ciphertext, []byte("aae"))
+		Expect(err).NotTo(BeNil())
+
+		ciphertext[3] ^= 1
+		_, err = aead.Open(nil, nonce, ciphertext, []byte("aad"))
+		Expect(err).NotTo(BeNil())
+	})
+})
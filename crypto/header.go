@@ -0,0 +1,267 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Every ciphertext produced by this package starts with a header:
+//
+//	offset  size  field
+//	0       4     magic ("GUHC")
+//	4       1     format version
+//	5       1     cipher ID
+//	6       1     flags
+//	7       8     key ID
+//
+// Flags may add sections after the fixed fields:
+//
+//	FlagEnvelope    2 (big-endian length) + length  wrapped data key
+//	FlagPassphrase  2 (big-endian length) + length  KDF parameters (see KDFParams.String)
+//
+// The header is authenticated along with the ciphertext, so it cannot be altered without failing decryption.
+// Ciphertexts without the magic are treated as legacy (headerless) cryptopasta output.
+
+// FormatVersion is the version of the ciphertext format produced by this package.
+const FormatVersion = 1
+
+// KeyIDLengthInBytes is the length, in bytes, of a KeyID
+const KeyIDLengthInBytes = 8
+
+const headerMagic = "GUHC"
+const headerLength = len(headerMagic) + 3 + KeyIDLengthInBytes
+
+// KeyID identifies a key without revealing it (see AES256Key.ID).
+type KeyID [KeyIDLengthInBytes]byte
+
+// String returns the hex-encoded key ID.
+func (id KeyID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// CipherID identifies the cipher that produced a ciphertext.
+type CipherID byte
+
+const (
+	// CipherAES256GCM is AES-256 in Galois/Counter Mode.
+	CipherAES256GCM CipherID = 1
+	// CipherAES256SIV is deterministic AES-SIV (RFC 5297) with AES-256 (see EncryptDeterministic).
+	CipherAES256SIV CipherID = 2
+	// CipherXChaCha20Poly1305 is XChaCha20-Poly1305, with 192-bit random nonces.
+	CipherXChaCha20Poly1305 CipherID = 3
+	// CipherAES256GCMSIV is AES-256-GCM-SIV (RFC 8452), which is nonce-misuse resistant.
+	CipherAES256GCMSIV CipherID = 4
+)
+
+// String returns the name of the cipher.
+func (c CipherID) String() string {
+	switch c {
+	case CipherAES256GCM:
+		return "AES-256-GCM"
+	case CipherAES256SIV:
+		return "AES-256-SIV"
+	case CipherXChaCha20Poly1305:
+		return "XChaCha20-Poly1305"
+	case CipherAES256GCMSIV:
+		return "AES-256-GCM-SIV"
+	default:
+		return fmt.Sprintf("unknown cipher (%d)", byte(c))
+	}
+}
+
+const (
+	// FlagStream marks a ciphertext produced by NewEncryptingWriter.
+	FlagStream byte = 1 << iota
+	// FlagEnvelope marks a ciphertext produced by EnvelopeEncrypt; the header carries the wrapped data key.
+	FlagEnvelope
+	// FlagPassphrase marks a ciphertext encrypted with a passphrase; the header carries the KDF parameters.
+	FlagPassphrase
+	// FlagCompressed marks a ciphertext whose plaintext was compressed; the header carries the algorithm.
+	FlagCompressed
+)
+
+const knownFlags = FlagStream | FlagEnvelope | FlagPassphrase | FlagCompressed
+
+// maxSectionLength is the maximum length of a length-prefixed header section
+const maxSectionLength = 0xffff
+
+// Header describes a ciphertext produced by this package.
+type Header struct {
+	Version byte
+	Cipher  CipherID
+	Flags   byte
+	KeyID   KeyID
+
+	// WrappedKey is the wrapped data key of an envelope-encrypted ciphertext (see FlagEnvelope).
+	WrappedKey []byte
+
+	// KDFParams are the parameters that derive the key from a passphrase (see FlagPassphrase).
+	KDFParams string
+
+	// Compression is the algorithm the plaintext was compressed with (see FlagCompressed).
+	Compression Compression
+}
+
+func newHeader(cipher CipherID, flags byte, key *AES256Key) *Header {
+	return &Header{
+		Version: FormatVersion,
+		Cipher:  cipher,
+		Flags:   flags,
+		KeyID:   key.ID(),
+	}
+}
+
+// HasHeader reports whether the data begins with a header (i.e. was not produced by a legacy, headerless version of
+// this package).
+func HasHeader(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(headerMagic))
+}
+
+// ParseHeader parses the header at the start of the ciphertext.
+func ParseHeader(ciphertext []byte) (*Header, error) {
+	h, _, err := readHeader(bytes.NewReader(ciphertext))
+	return h, err
+}
+
+func (h *Header) marshal() []byte {
+	b := make([]byte, 0, headerLength)
+	b = append(b, headerMagic...)
+	b = append(b, h.Version, byte(h.Cipher), h.Flags)
+	b = append(b, h.KeyID[:]...)
+
+	if h.Flags&FlagEnvelope != 0 {
+		b = appendSection(b, h.WrappedKey)
+	}
+
+	if h.Flags&FlagPassphrase != 0 {
+		b = appendSection(b, []byte(h.KDFParams))
+	}
+
+	if h.Flags&FlagCompressed != 0 {
+		b = appendSection(b, []byte{byte(h.Compression)})
+	}
+
+	return b
+}
+
+func appendSection(b []byte, section []byte) []byte {
+	var length [2]byte
+	binary.BigEndian.PutUint16(length[:], uint16(len(section)))
+	b = append(b, length[:]...)
+	return append(b, section...)
+}
+
+// readSection reads a length-prefixed header section, appending its raw bytes to raw.
+func readSection(r io.Reader, raw []byte) (section []byte, newRaw []byte, err error) {
+
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, nil, errors.New("ciphertext is too short to contain a header")
+	}
+
+	section = make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, section); err != nil {
+		return nil, nil, errors.New("ciphertext is too short to contain a header")
+	}
+
+	newRaw = append(append(raw, length[:]...), section...)
+	return section, newRaw, nil
+}
+
+// readHeader reads and validates a header, returning it along with its raw bytes.
+func readHeader(r io.Reader) (*Header, []byte, error) {
+
+	raw := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil, errors.New("ciphertext is too short to contain a header")
+		}
+		return nil, nil, err
+	}
+
+	if !HasHeader(raw) {
+		return nil, nil, errors.New("ciphertext does not start with a header")
+	}
+
+	h := &Header{
+		Version: raw[4],
+		Cipher:  CipherID(raw[5]),
+		Flags:   raw[6],
+	}
+	copy(h.KeyID[:], raw[7:])
+
+	if h.Version != FormatVersion {
+		return nil, nil, fmt.Errorf("unsupported ciphertext format version %d", h.Version)
+	}
+
+	switch h.Cipher {
+	case CipherAES256GCM, CipherAES256SIV, CipherXChaCha20Poly1305, CipherAES256GCMSIV:
+	default:
+		return nil, nil, fmt.Errorf("unsupported cipher: %v", h.Cipher)
+	}
+
+	if h.Flags&^knownFlags != 0 {
+		return nil, nil, fmt.Errorf("unsupported ciphertext flags: %#x", h.Flags)
+	}
+
+	var err error
+
+	if h.Flags&FlagEnvelope != 0 {
+		if h.WrappedKey, raw, err = readSection(r, raw); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if h.Flags&FlagPassphrase != 0 {
+		var kdfParams []byte
+		if kdfParams, raw, err = readSection(r, raw); err != nil {
+			return nil, nil, err
+		}
+		h.KDFParams = string(kdfParams)
+	}
+
+	if h.Flags&FlagCompressed != 0 {
+		var compression []byte
+		if compression, raw, err = readSection(r, raw); err != nil {
+			return nil, nil, err
+		}
+
+		if len(compression) != 1 || compression[0] == byte(CompressionNone) {
+			return nil, nil, errors.New("malformed compression header")
+		}
+
+		h.Compression = Compression(compression[0])
+		if err := validateCompression(h.Compression); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return h, raw, nil
+}
+
+// keyResolver returns the key to decrypt the ciphertext described by the header.
+type keyResolver func(h *Header) (*AES256Key, error)
+
+// resolveWithKey returns a keyResolver for the provided key, which rejects ciphertexts produced by other keys.
+func resolveWithKey(key *AES256Key) keyResolver {
+	return func(h *Header) (*AES256Key, error) {
+
+		if h.Flags&FlagEnvelope != 0 {
+			return nil, errors.New("ciphertext is envelope-encrypted; use EnvelopeDecrypt")
+		}
+
+		if h.Flags&FlagPassphrase != 0 {
+			return nil, errors.New("ciphertext is passphrase-encrypted; use DecryptWithPassphrase")
+		}
+
+		if h.KeyID != key.ID() {
+			return nil, fmt.Errorf("ciphertext was encrypted with a different key (key ID %v)", h.KeyID)
+		}
+
+		return key, nil
+	}
+}
@@ -0,0 +1,87 @@
+package crypto_test
+
+import (
+	"bytes"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	"github.com/gtank/cryptopasta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Header", func() {
+	It("is written at the start of every ciphertext", func() {
+		ciphertext, err := crypto.Encrypt([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(crypto.HasHeader(ciphertext)).To(Equal(true))
+
+		h, err := crypto.ParseHeader(ciphertext)
+		Expect(err).To(BeNil())
+		Expect(h.Version).To(Equal(byte(crypto.FormatVersion)))
+		Expect(h.Cipher).To(Equal(crypto.CipherAES256GCM))
+		Expect(h.Flags).To(Equal(byte(0)))
+		Expect(h.KeyID).To(Equal(fixedKey.ID()))
+	})
+
+	It("marks encrypted streams", func() {
+		h, err := crypto.ParseHeader(encryptStream([]byte("test"), &fixedKey))
+		Expect(err).To(BeNil())
+		Expect(h.Flags & crypto.FlagStream).To(Equal(crypto.FlagStream))
+		Expect(h.KeyID).To(Equal(fixedKey.ID()))
+	})
+
+	It("is not present in legacy ciphertexts", func() {
+		ciphertext, err := cryptopasta.Encrypt([]byte("test"), (*[32]byte)(&fixedKey))
+		Expect(err).To(BeNil())
+
+		// whitebox: a legacy ciphertext starts with a random nonce, which could collide with the magic
+		if bytes.HasPrefix(ciphertext, []byte("GUHC")) {
+			Skip("legacy nonce collided with the header magic")
+		}
+
+		Expect(crypto.HasHeader(ciphertext)).To(Equal(false))
+
+		_, err = crypto.ParseHeader(ciphertext)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("is authenticated", func() {
+		ciphertext, err := crypto.Encrypt([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		// whitebox: the flags byte
+		ciphertext[6] = crypto.FlagStream
+		_, err = crypto.Decrypt(ciphertext, &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("rejects unsupported versions and ciphers", func() {
+		ciphertext, err := crypto.Encrypt([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		// whitebox: the version and cipher bytes
+		badVersion := append([]byte{}, ciphertext...)
+		badVersion[4] = crypto.FormatVersion + 1
+		_, err = crypto.ParseHeader(badVersion)
+		Expect(err).NotTo(BeNil())
+
+		badCipher := append([]byte{}, ciphertext...)
+		badCipher[5] = 0xff
+		_, err = crypto.ParseHeader(badCipher)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires the whole header", func() {
+		ciphertext, err := crypto.Encrypt([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.ParseHeader(ciphertext[:10])
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("KeyID", func() {
+	It("has a hex string representation", func() {
+		Expect(fixedKey.ID().String()).To(MatchRegexp("^[0-9a-f]{16}$"))
+	})
+})
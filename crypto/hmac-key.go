@@ -0,0 +1,108 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// HMACKeyLengthInBytes is the length, in bytes, of an HMAC key; 512 bits is sufficient for both HMAC-SHA-256 and
+// HMAC-SHA-512.
+const HMACKeyLengthInBytes = 64
+
+// HMACKey represents a key for message authentication (see Sign). It is distinct from AES256Key so that the same key
+// material is never used for both encryption and authentication.
+//
+// Like an AES256Key, an HMACKey redacts itself when formatted (with any fmt verb), marshaled to JSON or text, or
+// logged with zap; ToBase64 is the explicit way to reveal the key. Call Destroy once the key is no longer needed.
+type HMACKey [HMACKeyLengthInBytes]byte
+
+// NewRandomHMACKey returns a new, cryptographically generated HMAC key.
+// NewRandomHMACKey will panic if the source of randomness fails.
+func NewRandomHMACKey() *HMACKey {
+
+	key := &HMACKey{}
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		panic(err)
+	}
+
+	return key
+}
+
+// NewHMACKeyFromBase64 loads the base64-encoded string into a new HMACKey. Surrounding whitespace (e.g. a trailing
+// newline from a mounted secret) is ignored.
+func NewHMACKeyFromBase64(base64Key string) (*HMACKey, error) {
+
+	base64Key = strings.TrimSpace(base64Key)
+	if base64Key == "" {
+		return nil, errors.New("zero-value base64 string")
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(base64Key)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(keyBytes)
+
+	if len(keyBytes) != HMACKeyLengthInBytes {
+		return nil, fmt.Errorf("expected key length to be %d, was %d", HMACKeyLengthInBytes, len(keyBytes))
+	}
+
+	key := &HMACKey{}
+	copy(key[:], keyBytes)
+	return key, nil
+}
+
+// ToBase64 converts the HMAC key to a base64-encoded string.
+func (key *HMACKey) ToBase64() string {
+
+	if key == nil {
+		return ""
+	}
+
+	return base64.StdEncoding.EncodeToString(key[:])
+}
+
+// Destroy zeroes the key material; the key must not be used afterwards. Note that copies of the key (e.g. made by
+// assigning an HMACKey value) are not affected.
+func (key *HMACKey) Destroy() {
+	if key != nil {
+		zeroBytes(key[:])
+	}
+}
+
+// String returns a redacted description of the key.
+func (key HMACKey) String() string {
+	return "HMACKey(" + redacted + ")"
+}
+
+// GoString is like String; it is used by the %#v verb.
+func (key HMACKey) GoString() string {
+	return key.String()
+}
+
+// Format writes the redacted description of the key (see String) for every verb.
+func (key HMACKey) Format(f fmt.State, verb rune) {
+	io.WriteString(f, key.String())
+}
+
+// MarshalJSON returns a redacted JSON string; use ToBase64 to serialize the key.
+func (key HMACKey) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// MarshalText implements encoding.TextMarshaler with a redacted value, like String.
+func (key HMACKey) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// MarshalLogObject logs a redacted value instead of the key material, when logged with zap (e.g. via zap.Any).
+func (key HMACKey) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("key", redacted)
+	return nil
+}
@@ -0,0 +1,136 @@
+package crypto_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var _ = Describe("HMACKey", func() {
+	It("has a factory function that creates a new, random key", func() {
+		key1 := crypto.NewRandomHMACKey()
+		key2 := crypto.NewRandomHMACKey()
+
+		Expect(key1).NotTo(Equal(key2))
+		Expect(key1).NotTo(Equal(&crypto.HMACKey{}))
+	})
+
+	Describe("NewHMACKeyFromBase64", func() {
+		It("creates a new HMACKey from a base64 string", func() {
+			key, err := crypto.NewHMACKeyFromBase64(fixedHMACKeyBase64)
+			Expect(err).To(BeNil())
+			Expect(key[:]).To(Equal(fixedHMACKey[:]))
+		})
+
+		It("ignores surrounding whitespace", func() {
+			key, err := crypto.NewHMACKeyFromBase64(" " + fixedHMACKeyBase64 + "\n")
+			Expect(err).To(BeNil())
+			Expect(key[:]).To(Equal(fixedHMACKey[:]))
+
+			key, err = crypto.NewHMACKeyFromBase64(" \n")
+			Expect(err).NotTo(BeNil())
+			Expect(key).To(BeNil())
+		})
+
+		It("requires a valid base64 string", func() {
+			key, err := crypto.NewHMACKeyFromBase64("")
+			Expect(err).NotTo(BeNil())
+			Expect(key).To(BeNil())
+
+			key, err = crypto.NewHMACKeyFromBase64("bad base64 String")
+			Expect(err).NotTo(BeNil())
+			Expect(key).To(BeNil())
+		})
+
+		It("requires a valid key-length", func() {
+			key, err := crypto.NewHMACKeyFromBase64(base64.StdEncoding.EncodeToString(fixedKey[:]))
+			Expect(err).NotTo(BeNil())
+			Expect(key).To(BeNil())
+		})
+	})
+
+	Describe("HMACKey.ToBase64", func() {
+		It("encodes the key to a base64 string that can be decoded", func() {
+			Expect(fixedHMACKey.ToBase64()).To(Equal(fixedHMACKeyBase64))
+
+			key, err := crypto.NewHMACKeyFromBase64(fixedHMACKey.ToBase64())
+			Expect(err).To(BeNil())
+			Expect(*key).To(Equal(fixedHMACKey))
+		})
+
+		It("returns an empty string for a nil key", func() {
+			var key *crypto.HMACKey
+			Expect(key.ToBase64()).To(Equal(""))
+		})
+	})
+	Describe("HMACKey.Destroy", func() {
+		It("zeroes the key material", func() {
+			key := crypto.NewRandomHMACKey()
+			key.Destroy()
+			Expect(*key).To(Equal(crypto.HMACKey{}))
+		})
+
+		It("works on a nil receiver", func() {
+			var nilKey *crypto.HMACKey
+			nilKey.Destroy()
+		})
+	})
+
+	Describe("redaction", func() {
+		leaks := func(s string) bool {
+			return strings.Contains(s, fixedHMACKeyBase64) ||
+				strings.Contains(strings.ToLower(s), hex.EncodeToString(fixedHMACKey[:4])) ||
+				strings.Contains(s, fmt.Sprint(fixedHMACKey[:4])[1:8])
+		}
+
+		It("redacts the key for every fmt verb", func() {
+			key := fixedHMACKey
+
+			for _, format := range []string{"%v", "%+v", "%#v", "%s", "%x", "%X", "%d", "%q"} {
+				for _, arg := range []interface{}{key, &key, struct{ Key crypto.HMACKey }{key}, []*crypto.HMACKey{&key}} {
+					s := fmt.Sprintf(format, arg)
+					Expect(leaks(s)).To(Equal(false), "%s: %s", format, s)
+				}
+			}
+
+			Expect(key.String()).To(ContainSubstring("REDACTED"))
+		})
+
+		It("redacts the key when marshaled", func() {
+			key := fixedHMACKey
+
+			b, err := json.Marshal(struct {
+				Key    crypto.HMACKey
+				KeyPtr *crypto.HMACKey
+			}{key, &key})
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(Equal(`{"Key":"REDACTED","KeyPtr":"REDACTED"}`))
+
+			text, err := key.MarshalText()
+			Expect(err).To(BeNil())
+			Expect(string(text)).To(Equal("REDACTED"))
+		})
+
+		It("redacts the key when logged with zap", func() {
+			var buf bytes.Buffer
+			core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.DebugLevel)
+			logger := zap.New(core)
+
+			key := fixedHMACKey
+			logger.Info("test", zap.Any("key", key), zap.Any("keyPtr", &key), zap.Object("keyObject", key))
+			Expect(logger.Sync()).To(Succeed())
+
+			Expect(buf.String()).To(ContainSubstring("REDACTED"))
+			Expect(leaks(buf.String())).To(Equal(false), buf.String())
+		})
+	})
+})
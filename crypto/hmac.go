@@ -0,0 +1,116 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// HMACAlgorithm identifies the hash function used by Sign and Verify.
+type HMACAlgorithm int
+
+const (
+	// HMACSHA256 is HMAC-SHA-256, which produces 32-byte MACs.
+	HMACSHA256 HMACAlgorithm = iota
+	// HMACSHA512 is HMAC-SHA-512, which produces 64-byte MACs.
+	HMACSHA512
+)
+
+// String returns the name of the algorithm.
+func (a HMACAlgorithm) String() string {
+	switch a {
+	case HMACSHA256:
+		return "HMAC-SHA-256"
+	case HMACSHA512:
+		return "HMAC-SHA-512"
+	default:
+		return fmt.Sprintf("unknown HMAC algorithm (%d)", int(a))
+	}
+}
+
+func (a HMACAlgorithm) hash() (func() hash.Hash, error) {
+	switch a {
+	case HMACSHA256:
+		return sha256.New, nil
+	case HMACSHA512:
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported HMAC algorithm: %v", a)
+	}
+}
+
+// Sign returns the HMAC-SHA-256 of the message with the provided key. Sign provides integrity and authenticity, not
+// confidentiality: use it for e.g. webhook payloads, cache keys or signed URLs, where the message is not secret.
+func Sign(message []byte, key *HMACKey) ([]byte, error) {
+	return SignWithAlgorithm(HMACSHA256, message, key)
+}
+
+// Verify checks, in constant time, that the MAC (e.g. from a previous call to Sign) is the HMAC-SHA-256 of the
+// message with the provided key, and returns an error if it is not.
+func Verify(message []byte, mac []byte, key *HMACKey) error {
+	return VerifyWithAlgorithm(HMACSHA256, message, mac, key)
+}
+
+// SignWithAlgorithm is like Sign, but uses the provided algorithm.
+func SignWithAlgorithm(algorithm HMACAlgorithm, message []byte, key *HMACKey) ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to sign with nil key")
+	}
+
+	h, err := algorithm.hash()
+	if err != nil {
+		return nil, err
+	}
+
+	m := hmac.New(h, key[:])
+	m.Write(message)
+	return m.Sum(nil), nil
+}
+
+// VerifyWithAlgorithm is like Verify, but uses the provided algorithm, which must match the one the MAC was produced
+// with.
+func VerifyWithAlgorithm(algorithm HMACAlgorithm, message []byte, mac []byte, key *HMACKey) error {
+
+	if key == nil {
+		return errors.New("tried to verify with nil key")
+	}
+
+	expected, err := SignWithAlgorithm(algorithm, message, key)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(mac, expected) {
+		return errors.New("message authentication failed")
+	}
+
+	return nil
+}
+
+// SignStringToBase64 returns the base64-encoded HMAC-SHA-256 of the message with the provided key.
+func SignStringToBase64(message string, key *HMACKey) (string, error) {
+
+	mac, err := Sign([]byte(message), key)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(mac), nil
+}
+
+// VerifyStringFromBase64 decodes the provided base64 MAC (e.g. from a previous call to SignStringToBase64), and
+// checks it as Verify does.
+func VerifyStringFromBase64(message string, base64MAC string, key *HMACKey) error {
+
+	mac, err := base64.StdEncoding.DecodeString(base64MAC)
+	if err != nil {
+		return err
+	}
+
+	return Verify([]byte(message), mac, key)
+}
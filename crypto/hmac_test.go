@@ -0,0 +1,90 @@
+package crypto_test
+
+import (
+	"encoding/hex"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sign", func() {
+	message := []byte("hello webhook")
+
+	It("computes HMAC-SHA-256", func() {
+		mac, err := crypto.Sign(message, &fixedHMACKey)
+		Expect(err).To(BeNil())
+		Expect(hex.EncodeToString(mac)).To(Equal("1eeb9b7cb6920e49c5bd43f38fbf1f44f202ae0e532c681d86ee987edceffd68"))
+	})
+
+	It("computes HMAC-SHA-512", func() {
+		mac, err := crypto.SignWithAlgorithm(crypto.HMACSHA512, message, &fixedHMACKey)
+		Expect(err).To(BeNil())
+		Expect(hex.EncodeToString(mac)).To(Equal("78095dfece41d9863b936ef03d27a7ff91d289d55d381863c29615e901cea5b4" +
+			"236af4dd169545e08078d53e9cea8a2f0bccbe3004a31a01d56de7fe2bab9e00"))
+	})
+
+	It("rejects unknown algorithms", func() {
+		mac, err := crypto.SignWithAlgorithm(crypto.HMACAlgorithm(99), message, &fixedHMACKey)
+		Expect(mac).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires a valid key", func() {
+		mac, err := crypto.Sign(message, nil)
+		Expect(mac).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Verify", func() {
+	message := []byte("hello webhook")
+
+	It("accepts a MAC produced by Sign with the same key", func() {
+		for _, algorithm := range []crypto.HMACAlgorithm{crypto.HMACSHA256, crypto.HMACSHA512} {
+			mac, err := crypto.SignWithAlgorithm(algorithm, message, &fixedHMACKey)
+			Expect(err).To(BeNil())
+			Expect(crypto.VerifyWithAlgorithm(algorithm, message, mac, &fixedHMACKey)).To(Succeed())
+		}
+
+		mac, err := crypto.Sign(message, &fixedHMACKey)
+		Expect(err).To(BeNil())
+		Expect(crypto.Verify(message, mac, &fixedHMACKey)).To(Succeed())
+	})
+
+	It("rejects a modified message, MAC, key or algorithm", func() {
+		mac, err := crypto.Sign(message, &fixedHMACKey)
+		Expect(err).To(BeNil())
+
+		Expect(crypto.Verify([]byte("hello webhooK"), mac, &fixedHMACKey)).NotTo(Succeed())
+		Expect(crypto.Verify(message, mac[:len(mac)-1], &fixedHMACKey)).NotTo(Succeed())
+		Expect(crypto.Verify(message, nil, &fixedHMACKey)).NotTo(Succeed())
+		Expect(crypto.Verify(message, mac, crypto.NewRandomHMACKey())).NotTo(Succeed())
+		Expect(crypto.VerifyWithAlgorithm(crypto.HMACSHA512, message, mac, &fixedHMACKey)).NotTo(Succeed())
+
+		mac[0] ^= 1
+		Expect(crypto.Verify(message, mac, &fixedHMACKey)).NotTo(Succeed())
+	})
+
+	It("requires a valid key", func() {
+		Expect(crypto.Verify(message, []byte("mac"), nil)).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("SignStringToBase64 / VerifyStringFromBase64", func() {
+	It("signs a string and verifies the base64-encoded MAC", func() {
+		mac, err := crypto.SignStringToBase64("hello webhook", &fixedHMACKey)
+		Expect(err).To(BeNil())
+		Expect(mac).To(Equal("HuubfLaSDknFvUPzj78fRPICrg5TLGgdhu6Yftzv/Wg="))
+
+		Expect(crypto.VerifyStringFromBase64("hello webhook", mac, &fixedHMACKey)).To(Succeed())
+		Expect(crypto.VerifyStringFromBase64("hello webhooK", mac, &fixedHMACKey)).NotTo(Succeed())
+		Expect(crypto.VerifyStringFromBase64("hello webhook", "bad base64 String", &fixedHMACKey)).NotTo(Succeed())
+	})
+
+	It("requires a valid key", func() {
+		mac, err := crypto.SignStringToBase64("test", nil)
+		Expect(mac).To(Equal(""))
+		Expect(err).NotTo(BeNil())
+	})
+})
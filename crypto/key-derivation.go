@@ -0,0 +1,34 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Derive returns a subkey derived from the key with HKDF-SHA256 (RFC 5869), so that a single master key can provide
+// distinct keys per purpose and per tenant without storing them. The same key, info and salt always derive the same
+// subkey; knowing a subkey reveals nothing about the master key or any other subkey.
+//
+// The info provides domain separation and should uniquely describe what the subkey is for, from the most to the
+// least general component, e.g. "billing/invoice-pdf" or "billing/invoice-pdf/tenant-42". Components should not
+// contain the separator, so that distinct paths never collide. Info values beginning with "go-util-helpers" are
+// reserved for this package.
+//
+// The salt is optional (it may be nil). As the master key is already uniformly random, a salt is only needed to
+// derive a fresh family of subkeys from the same info, e.g. per rotation period.
+func (key *AES256Key) Derive(info, salt []byte) (*AES256Key, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to derive from nil key")
+	}
+
+	subkey := &AES256Key{}
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key[:], salt, info), subkey[:]); err != nil {
+		return nil, err
+	}
+
+	return subkey, nil
+}
@@ -0,0 +1,61 @@
+package crypto_test
+
+import (
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AES256Key.Derive", func() {
+	// HKDF-SHA256 test vectors for fixedKey (computed independently of this package)
+	vectors := []struct {
+		info   string
+		salt   []byte
+		subkey string
+	}{
+		{"billing/invoice-pdf", nil, "c7mrfE9cJ4hyemgRPCHmcl65oRAUprYM9fMQ3Qei+fA="},
+		{"billing/invoice-pdf/tenant-42", nil, "DslHZee8rqfPHMy0Yi1ZZcTVQLJeMF3XpcP+A7v2Bgs="},
+		{"billing/invoice-pdf", []byte("2024-rotation"), "rPyAuqDkwkTaGcBT93lCrw3lHN+iGOAsE2hzujOl/I8="},
+	}
+
+	It("matches the HKDF-SHA256 test vectors", func() {
+		for _, vector := range vectors {
+			subkey, err := fixedKey.Derive([]byte(vector.info), vector.salt)
+			Expect(err).To(BeNil())
+			Expect(subkey.ToBase64()).To(Equal(vector.subkey), vector.info)
+		}
+	})
+
+	It("derives distinct keys per info and salt", func() {
+		seen := map[string]bool{fixedKey.ToBase64(): true}
+
+		for _, vector := range vectors {
+			subkey, err := fixedKey.Derive([]byte(vector.info), vector.salt)
+			Expect(err).To(BeNil())
+			Expect(seen).NotTo(HaveKey(subkey.ToBase64()))
+			seen[subkey.ToBase64()] = true
+		}
+	})
+
+	It("derives keys that can be used for encryption", func() {
+		subkey, err := fixedKey.Derive([]byte("billing/invoice-pdf"), nil)
+		Expect(err).To(BeNil())
+
+		ciphertext, err := crypto.Encrypt([]byte("test"), subkey)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.Decrypt(ciphertext, &fixedKey)
+		Expect(err).NotTo(BeNil())
+
+		plaintext, err := crypto.Decrypt(ciphertext, subkey)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+	})
+
+	It("requires a valid key", func() {
+		var nilKey *crypto.AES256Key
+		subkey, err := nilKey.Derive([]byte("billing"), nil)
+		Expect(subkey).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
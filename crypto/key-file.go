@@ -0,0 +1,183 @@
+package crypto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"time"
+)
+
+// KeyFileAlgorithm is the algorithm recorded in key files for an AES256Key.
+const KeyFileAlgorithm = "AES-256"
+
+const keyFileVersion = 1
+
+// KeyFile is an AES256Key stored in a file with its metadata (see SaveKeyFile and LoadKeyFile). Key files are JSON,
+// e.g.:
+//
+//	{
+//	  "version": 1,
+//	  "id": "1b4f0e9851971998",
+//	  "created": "2026-01-02T15:04:05Z",
+//	  "purpose": "user sessions",
+//	  "algorithm": "AES-256",
+//	  "key": "<base64-encoded key>"
+//	}
+//
+// The key is stored unprotected, so key files are only readable by their owner.
+type KeyFile struct {
+	// Key is the key material.
+	Key *AES256Key
+
+	// Created is when the key was created.
+	Created time.Time
+
+	// Purpose is a free-form description of what the key is used for.
+	Purpose string
+}
+
+// keyFileData is the JSON representation of a KeyFile; AES256Key redacts itself when marshaled, so the key is
+// encoded explicitly.
+type keyFileData struct {
+	Version   int       `json:"version"`
+	ID        string    `json:"id"`
+	Created   time.Time `json:"created"`
+	Purpose   string    `json:"purpose,omitempty"`
+	Algorithm string    `json:"algorithm"`
+	Key       string    `json:"key"`
+}
+
+// NewKeyFile returns a KeyFile for the key, created now.
+func NewKeyFile(key *AES256Key, purpose string) *KeyFile {
+	return &KeyFile{
+		Key:     key,
+		Created: time.Now().UTC().Truncate(time.Second),
+		Purpose: purpose,
+	}
+}
+
+// ID returns the key's ID.
+func (kf *KeyFile) ID() KeyID {
+	return kf.Key.ID()
+}
+
+// SaveKeyFile writes the key file to path, readable only by the owner. An existing file is replaced, and its
+// permissions are restricted.
+func SaveKeyFile(path string, kf *KeyFile) error {
+
+	if kf == nil || kf.Key == nil {
+		return errors.New("tried to save nil key")
+	}
+
+	contents, err := json.MarshalIndent(&keyFileData{
+		Version:   keyFileVersion,
+		ID:        kf.Key.ID().String(),
+		Created:   kf.Created,
+		Purpose:   kf.Purpose,
+		Algorithm: KeyFileAlgorithm,
+		Key:       kf.Key.ToBase64(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	contents = append(contents, '\n')
+	defer zeroBytes(contents)
+
+	return writePrivateFile(path, contents)
+}
+
+// writePrivateFile writes the contents to the file, which is created or replaced with permissions that make it
+// readable only by the owner.
+func writePrivateFile(path string, contents []byte) error {
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	// the permissions of an existing file are not changed by OpenFile
+	if err := f.Chmod(0600); err != nil && runtime.GOOS != "windows" {
+		f.Close()
+		return err
+	}
+
+	if _, err := f.Write(contents); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// LoadKeyFile reads a key file written by SaveKeyFile. It refuses to load a file that is readable or writable by the
+// group or others (except on Windows, which does not have Unix permissions), and verifies that the recorded ID
+// matches the key.
+func LoadKeyFile(path string) (*KeyFile, error) {
+
+	// the permissions are checked on the open file, so that the file cannot be replaced between the check and the read
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := checkKeyFilePermissions(f); err != nil {
+		return nil, err
+	}
+
+	contents, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(contents)
+
+	var data keyFileData
+	if err := json.Unmarshal(contents, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse key file %s: %v", path, err)
+	}
+
+	if data.Version != keyFileVersion {
+		return nil, fmt.Errorf("unsupported key file version: %d", data.Version)
+	}
+
+	if data.Algorithm != KeyFileAlgorithm {
+		return nil, fmt.Errorf("unsupported key file algorithm %q", data.Algorithm)
+	}
+
+	key, err := NewAESKeyFromBase64(data.Key)
+	if err != nil {
+		return nil, fmt.Errorf("key file %s has an invalid key: %v", path, err)
+	}
+
+	if key.ID().String() != data.ID {
+		key.Destroy()
+		return nil, fmt.Errorf("key file %s is corrupt: the key does not match its ID %s", path, data.ID)
+	}
+
+	return &KeyFile{
+		Key:     key,
+		Created: data.Created,
+		Purpose: data.Purpose,
+	}, nil
+}
+
+func checkKeyFilePermissions(f *os.File) error {
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("key file %s is accessible by other users (permissions %#o); it should be 0600", f.Name(), perm)
+	}
+
+	return nil
+}
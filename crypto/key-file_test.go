@@ -0,0 +1,110 @@
+package crypto_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KeyFile", func() {
+	var dir string
+	var path string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "key-file")
+		Expect(err).To(BeNil())
+		path = filepath.Join(dir, "key.json")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("round-trips the key and its metadata", func() {
+		key := fixedKey
+		kf := crypto.NewKeyFile(&key, "user sessions")
+		Expect(kf.Created).To(BeTemporally("~", time.Now(), time.Minute))
+		Expect(kf.ID()).To(Equal(fixedKey.ID()))
+
+		Expect(crypto.SaveKeyFile(path, kf)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).To(BeNil())
+		Expect(string(contents)).To(ContainSubstring(`"id": "` + fixedKey.ID().String() + `"`))
+		Expect(string(contents)).To(ContainSubstring(`"algorithm": "AES-256"`))
+		Expect(string(contents)).To(ContainSubstring(`"key": "` + fixedKeyBase64 + `"`))
+
+		loaded, err := crypto.LoadKeyFile(path)
+		Expect(err).To(BeNil())
+		Expect(*loaded.Key).To(Equal(fixedKey))
+		Expect(loaded.Purpose).To(Equal("user sessions"))
+		Expect(loaded.Created.Equal(kf.Created)).To(Equal(true))
+	})
+
+	It("writes files readable only by the owner", func() {
+		if runtime.GOOS == "windows" {
+			Skip("Windows does not have Unix permissions")
+		}
+
+		Expect(ioutil.WriteFile(path, []byte("old"), 0644)).To(Succeed())
+		Expect(crypto.SaveKeyFile(path, crypto.NewKeyFile(&fixedKey, ""))).To(Succeed())
+
+		info, err := os.Stat(path)
+		Expect(err).To(BeNil())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("refuses to load files accessible by other users", func() {
+		if runtime.GOOS == "windows" {
+			Skip("Windows does not have Unix permissions")
+		}
+
+		Expect(crypto.SaveKeyFile(path, crypto.NewKeyFile(&fixedKey, ""))).To(Succeed())
+
+		for _, perm := range []os.FileMode{0640, 0604, 0620} {
+			Expect(os.Chmod(path, perm)).To(Succeed())
+			kf, err := crypto.LoadKeyFile(path)
+			Expect(kf).To(BeNil())
+			Expect(err).NotTo(BeNil())
+		}
+
+		Expect(os.Chmod(path, 0400)).To(Succeed())
+		_, err := crypto.LoadKeyFile(path)
+		Expect(err).To(BeNil())
+	})
+
+	It("rejects malformed and corrupt files", func() {
+		Expect(crypto.SaveKeyFile(path, crypto.NewKeyFile(&fixedKey, ""))).To(Succeed())
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).To(BeNil())
+
+		for _, bad := range []string{
+			"not JSON",
+			strings.Replace(string(contents), `"version": 1`, `"version": 2`, 1),
+			strings.Replace(string(contents), "AES-256", "AES-128", 1),
+			strings.Replace(string(contents), fixedKey.ID().String(), "0000000000000000", 1),
+			strings.Replace(string(contents), fixedKeyBase64, fixedKeyBase64[:40], 1),
+		} {
+			Expect(ioutil.WriteFile(path, []byte(bad), 0600)).To(Succeed())
+			kf, err := crypto.LoadKeyFile(path)
+			Expect(kf).To(BeNil())
+			Expect(err).NotTo(BeNil(), bad)
+		}
+
+		_, err = crypto.LoadKeyFile(filepath.Join(dir, "missing.json"))
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires a key", func() {
+		Expect(crypto.SaveKeyFile(path, nil)).NotTo(Succeed())
+		Expect(crypto.SaveKeyFile(path, &crypto.KeyFile{})).NotTo(Succeed())
+	})
+})
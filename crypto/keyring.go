@@ -0,0 +1,362 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// KeyStatus describes how a key in a Keyring may be used.
+type KeyStatus int
+
+const (
+	// KeyEnabled keys can decrypt, and can be made the primary (encrypting) key.
+	KeyEnabled KeyStatus = iota
+	// KeyDecryptOnly keys can decrypt existing ciphertexts, but cannot be the primary key.
+	KeyDecryptOnly
+	// KeyRetired keys are kept for reference only; ciphertexts they produced will no longer decrypt.
+	KeyRetired
+)
+
+// String returns the name of the status.
+func (s KeyStatus) String() string {
+	switch s {
+	case KeyEnabled:
+		return "enabled"
+	case KeyDecryptOnly:
+		return "decrypt-only"
+	case KeyRetired:
+		return "retired"
+	default:
+		return fmt.Sprintf("unknown status (%d)", int(s))
+	}
+}
+
+type keyringEntry struct {
+	key    *AES256Key
+	status KeyStatus
+}
+
+// Keyring holds multiple AES256Keys by ID to support key rotation: it encrypts with a designated primary key, and
+// decrypts with whichever key the ciphertext names in its header.
+// A Keyring is safe for concurrent use.
+type Keyring struct {
+	mu         sync.RWMutex
+	keys       map[KeyID]*keyringEntry
+	primary    KeyID
+	hasPrimary bool
+	counter    *UsageCounter
+}
+
+// NewKeyring returns a new, empty Keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[KeyID]*keyringEntry)}
+}
+
+// Add adds a copy of the key to the keyring as an enabled key, and returns its ID. If the keyring does not have a
+// primary key, the key becomes the primary key. Adding a key that is already in the keyring has no effect.
+func (kr *Keyring) Add(key *AES256Key) (KeyID, error) {
+
+	if key == nil {
+		return KeyID{}, errors.New("tried to add nil key")
+	}
+
+	id := key.ID()
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if _, ok := kr.keys[id]; ok {
+		return id, nil
+	}
+
+	keyCopy := *key
+	kr.keys[id] = &keyringEntry{key: &keyCopy, status: KeyEnabled}
+
+	if !kr.hasPrimary {
+		kr.primary = id
+		kr.hasPrimary = true
+	}
+
+	return id, nil
+}
+
+// Rotate adds a new random key to the keyring and makes it the primary key; the previous primary key remains
+// enabled for decryption. Rotate returns the ID of the new key.
+func (kr *Keyring) Rotate() (KeyID, error) {
+
+	id, err := kr.Add(NewRandomAESKey())
+	if err != nil {
+		return KeyID{}, err
+	}
+
+	return id, kr.SetPrimary(id)
+}
+
+// IDs returns the IDs of all keys in the keyring, in a stable order.
+func (kr *Keyring) IDs() []KeyID {
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	ids := make([]KeyID, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	return ids
+}
+
+// Primary returns the ID of the primary key; the boolean is false if the keyring has no primary key.
+func (kr *Keyring) Primary() (KeyID, bool) {
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	return kr.primary, kr.hasPrimary
+}
+
+// SetPrimary makes the enabled key with the provided ID the primary key.
+func (kr *Keyring) SetPrimary(id KeyID) error {
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	entry, ok := kr.keys[id]
+	if !ok {
+		return fmt.Errorf("key %v is not in the keyring", id)
+	}
+
+	if entry.status != KeyEnabled {
+		return fmt.Errorf("key %v is %v and cannot be the primary key", id, entry.status)
+	}
+
+	kr.primary = id
+	kr.hasPrimary = true
+	return nil
+}
+
+// Status returns the status of the key with the provided ID; the boolean is false if the key is not in the keyring.
+func (kr *Keyring) Status(id KeyID) (KeyStatus, bool) {
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	entry, ok := kr.keys[id]
+	if !ok {
+		return 0, false
+	}
+
+	return entry.status, true
+}
+
+// SetStatus sets the status of the key with the provided ID. The primary key must remain enabled; make another key
+// the primary key first.
+func (kr *Keyring) SetStatus(id KeyID, status KeyStatus) error {
+
+	if status != KeyEnabled && status != KeyDecryptOnly && status != KeyRetired {
+		return fmt.Errorf("invalid key status: %v", status)
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	entry, ok := kr.keys[id]
+	if !ok {
+		return fmt.Errorf("key %v is not in the keyring", id)
+	}
+
+	if kr.hasPrimary && kr.primary == id && status != KeyEnabled {
+		return fmt.Errorf("key %v is the primary key and must remain enabled", id)
+	}
+
+	entry.status = status
+	return nil
+}
+
+// SetUsageCounter sets the UsageCounter that counts the keyring's encryptions, in place of the registered counter
+// (see RegisterUsageCounter); nil removes it. The counter's OnWarning callback may rotate the keyring (see Rotate),
+// provided the new key reaches everything that decrypts.
+func (kr *Keyring) SetUsageCounter(uc *UsageCounter) {
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	kr.counter = uc
+}
+
+func (kr *Keyring) usageCounter() *UsageCounter {
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	return kr.counter
+}
+
+func (kr *Keyring) primaryKey() (*AES256Key, error) {
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	if !kr.hasPrimary {
+		return nil, errors.New("keyring has no primary key")
+	}
+
+	return kr.keys[kr.primary].key, nil
+}
+
+// decryptionKey returns the key with the provided ID, provided it has not been retired.
+func (kr *Keyring) decryptionKey(id KeyID) (*AES256Key, error) {
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	entry, ok := kr.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("key %v is not in the keyring", id)
+	}
+
+	if entry.status == KeyRetired {
+		return nil, fmt.Errorf("key %v is retired", id)
+	}
+
+	return entry.key, nil
+}
+
+// decryptionKeys returns every key that has not been retired.
+func (kr *Keyring) decryptionKeys() []*AES256Key {
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	keys := make([]*AES256Key, 0, len(kr.keys))
+	for _, entry := range kr.keys {
+		if entry.status != KeyRetired {
+			keys = append(keys, entry.key)
+		}
+	}
+
+	return keys
+}
+
+// Encrypt encrypts the plaintext with the primary key and returns the result.
+func (kr *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	return kr.EncryptWithAAD(plaintext, nil)
+}
+
+// Decrypt decrypts the ciphertext with the key named in its header and returns the result.
+// Legacy ciphertexts without a header are tried against every key that has not been retired.
+func (kr *Keyring) Decrypt(ciphertext []byte) ([]byte, error) {
+	return kr.DecryptWithAAD(ciphertext, nil)
+}
+
+// EncryptWithAAD encrypts the plaintext with the primary key, binding it to the additional data (see
+// EncryptWithAAD), and returns the result.
+func (kr *Keyring) EncryptWithAAD(plaintext []byte, additionalData []byte) ([]byte, error) {
+
+	return kr.EncryptWithOptions(plaintext, EncryptOptions{AdditionalData: additionalData})
+}
+
+// EncryptWithOptions encrypts the plaintext with the primary key and the provided options (see EncryptWithOptions).
+// The keyring's usage counter (see SetUsageCounter) is used if the options do not specify one.
+func (kr *Keyring) EncryptWithOptions(plaintext []byte, options EncryptOptions) ([]byte, error) {
+
+	key, err := kr.primaryKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if options.UsageCounter == nil {
+		options.UsageCounter = kr.usageCounter()
+	}
+
+	return EncryptWithOptions(plaintext, key, options)
+}
+
+// DecryptWithAAD decrypts the ciphertext with the key named in its header and the additional data, and returns the
+// result.
+func (kr *Keyring) DecryptWithAAD(ciphertext []byte, additionalData []byte) ([]byte, error) {
+
+	if !HasHeader(ciphertext) {
+		return kr.decryptLegacy(ciphertext, additionalData)
+	}
+
+	h, err := ParseHeader(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := kr.decryptionKey(h.KeyID)
+	if err != nil {
+		// a legacy ciphertext starts with a random nonce, which will (rarely) look like a header
+		if plaintext, legacyErr := kr.decryptLegacy(ciphertext, additionalData); legacyErr == nil {
+			return plaintext, nil
+		}
+		return nil, err
+	}
+
+	return DecryptWithAAD(ciphertext, additionalData, key)
+}
+
+func (kr *Keyring) decryptLegacy(ciphertext []byte, additionalData []byte) ([]byte, error) {
+
+	for _, key := range kr.decryptionKeys() {
+		if plaintext, err := decryptLegacy(ciphertext, additionalData, key); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	return nil, errors.New("no key in the keyring could decrypt the ciphertext")
+}
+
+// EncryptStringToBase64 encrypts the plaintext with the primary key and returns the base64-encoded result.
+func (kr *Keyring) EncryptStringToBase64(plaintext string) (string, error) {
+
+	ciphertext, err := kr.Encrypt([]byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptStringFromBase64 decodes the provided base64 string (e.g. from a previous call to EncryptStringToBase64),
+// decrypts the result with the key named in its header, and returns the resulting string.
+func (kr *Keyring) DecryptStringFromBase64(base64Ciphertext string) (string, error) {
+
+	ciphertext, err := base64.StdEncoding.DecodeString(base64Ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := kr.Decrypt(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// NewEncryptingWriter returns an io.WriteCloser that encrypts everything written to it with the primary key (see
+// the package-level NewEncryptingWriter).
+func (kr *Keyring) NewEncryptingWriter(w io.Writer) (io.WriteCloser, error) {
+
+	key, err := kr.primaryKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEncryptingWriter(w, key)
+}
+
+// NewDecryptingReader returns an io.Reader that decrypts the stream read from r with the key named in its header
+// (see the package-level NewDecryptingReader).
+func (kr *Keyring) NewDecryptingReader(r io.Reader) (io.Reader, error) {
+	return newDecryptingReader(r, nil, func(h *Header) (*AES256Key, error) {
+		return kr.decryptionKey(h.KeyID)
+	})
+}
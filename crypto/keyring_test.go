@@ -0,0 +1,230 @@
+package crypto_test
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	"github.com/gtank/cryptopasta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Keyring", func() {
+	var keyring *crypto.Keyring
+	var fixedKeyID crypto.KeyID
+
+	BeforeEach(func() {
+		keyring = crypto.NewKeyring()
+
+		var err error
+		fixedKeyID, err = keyring.Add(&fixedKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("makes the first key added the primary key", func() {
+		Expect(fixedKeyID).To(Equal(fixedKey.ID()))
+
+		primary, ok := keyring.Primary()
+		Expect(ok).To(Equal(true))
+		Expect(primary).To(Equal(fixedKeyID))
+
+		_, err := keyring.Add(crypto.NewRandomAESKey())
+		Expect(err).To(BeNil())
+
+		primary, _ = keyring.Primary()
+		Expect(primary).To(Equal(fixedKeyID))
+		Expect(keyring.IDs()).To(HaveLen(2))
+	})
+
+	It("requires a valid key", func() {
+		_, err := keyring.Add(nil)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires a primary key to encrypt", func() {
+		ciphertext, err := crypto.NewKeyring().Encrypt([]byte("test"))
+		Expect(ciphertext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("encrypts with the primary key", func() {
+		ciphertext, err := keyring.Encrypt([]byte("test"))
+		Expect(err).To(BeNil())
+
+		h, err := crypto.ParseHeader(ciphertext)
+		Expect(err).To(BeNil())
+		Expect(h.KeyID).To(Equal(fixedKeyID))
+
+		plaintext, err := crypto.Decrypt(ciphertext, &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+	})
+
+	It("decrypts with whichever key the ciphertext names", func() {
+		oldCiphertext, err := keyring.Encrypt([]byte("old"))
+		Expect(err).To(BeNil())
+
+		newKeyID, err := keyring.Rotate()
+		Expect(err).To(BeNil())
+
+		primary, _ := keyring.Primary()
+		Expect(primary).To(Equal(newKeyID))
+
+		newCiphertext, err := keyring.Encrypt([]byte("new"))
+		Expect(err).To(BeNil())
+
+		h, err := crypto.ParseHeader(newCiphertext)
+		Expect(err).To(BeNil())
+		Expect(h.KeyID).To(Equal(newKeyID))
+
+		plaintext, err := keyring.Decrypt(oldCiphertext)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("old")))
+
+		plaintext, err = keyring.Decrypt(newCiphertext)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("new")))
+	})
+
+	It("fails to decrypt ciphertexts from keys it does not hold", func() {
+		ciphertext, err := crypto.Encrypt([]byte("test"), crypto.NewRandomAESKey())
+		Expect(err).To(BeNil())
+
+		plaintext, err := keyring.Decrypt(ciphertext)
+		Expect(plaintext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("decrypts legacy ciphertexts that have no header", func() {
+		_, err := keyring.Rotate()
+		Expect(err).To(BeNil())
+
+		ciphertext, err := cryptopasta.Encrypt([]byte("test"), (*[32]byte)(&fixedKey))
+		Expect(err).To(BeNil())
+
+		plaintext, err := keyring.Decrypt(ciphertext)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+	})
+
+	Describe("key status", func() {
+		It("keeps the primary key enabled", func() {
+			Expect(keyring.SetStatus(fixedKeyID, crypto.KeyDecryptOnly)).NotTo(Succeed())
+			Expect(keyring.SetStatus(fixedKeyID, crypto.KeyRetired)).NotTo(Succeed())
+
+			status, ok := keyring.Status(fixedKeyID)
+			Expect(ok).To(Equal(true))
+			Expect(status).To(Equal(crypto.KeyEnabled))
+		})
+
+		It("prevents decrypt-only keys from becoming the primary key", func() {
+			newKeyID, err := keyring.Rotate()
+			Expect(err).To(BeNil())
+
+			Expect(keyring.SetStatus(fixedKeyID, crypto.KeyDecryptOnly)).To(Succeed())
+			Expect(keyring.SetPrimary(fixedKeyID)).NotTo(Succeed())
+
+			primary, _ := keyring.Primary()
+			Expect(primary).To(Equal(newKeyID))
+		})
+
+		It("decrypts with decrypt-only keys", func() {
+			ciphertext, err := keyring.Encrypt([]byte("test"))
+			Expect(err).To(BeNil())
+
+			_, err = keyring.Rotate()
+			Expect(err).To(BeNil())
+			Expect(keyring.SetStatus(fixedKeyID, crypto.KeyDecryptOnly)).To(Succeed())
+
+			plaintext, err := keyring.Decrypt(ciphertext)
+			Expect(err).To(BeNil())
+			Expect(plaintext).To(Equal([]byte("test")))
+		})
+
+		It("does not decrypt with retired keys", func() {
+			ciphertext, err := keyring.Encrypt([]byte("test"))
+			Expect(err).To(BeNil())
+
+			_, err = keyring.Rotate()
+			Expect(err).To(BeNil())
+			Expect(keyring.SetStatus(fixedKeyID, crypto.KeyRetired)).To(Succeed())
+
+			plaintext, err := keyring.Decrypt(ciphertext)
+			Expect(plaintext).To(BeNil())
+			Expect(err).NotTo(BeNil())
+
+			// re-enabling the key restores decryption
+			Expect(keyring.SetStatus(fixedKeyID, crypto.KeyEnabled)).To(Succeed())
+			_, err = keyring.Decrypt(ciphertext)
+			Expect(err).To(BeNil())
+		})
+
+		It("requires a known key", func() {
+			unknownID := crypto.NewRandomAESKey().ID()
+			Expect(keyring.SetStatus(unknownID, crypto.KeyRetired)).NotTo(Succeed())
+			Expect(keyring.SetPrimary(unknownID)).NotTo(Succeed())
+
+			_, ok := keyring.Status(unknownID)
+			Expect(ok).To(Equal(false))
+		})
+	})
+
+	Describe("string and stream variants", func() {
+		It("round-trips base64 strings", func() {
+			ciphertext, err := keyring.EncryptStringToBase64("test")
+			Expect(err).To(BeNil())
+
+			plaintext, err := crypto.DecryptStringFromBase64(ciphertext, &fixedKey)
+			Expect(err).To(BeNil())
+			Expect(plaintext).To(Equal("test"))
+
+			plaintext, err = keyring.DecryptStringFromBase64(ciphertext)
+			Expect(err).To(BeNil())
+			Expect(plaintext).To(Equal("test"))
+		})
+
+		It("round-trips with additional data", func() {
+			ciphertext, err := keyring.EncryptWithAAD([]byte("test"), []byte("row 1"))
+			Expect(err).To(BeNil())
+
+			plaintext, err := keyring.DecryptWithAAD(ciphertext, []byte("row 1"))
+			Expect(err).To(BeNil())
+			Expect(plaintext).To(Equal([]byte("test")))
+
+			_, err = keyring.DecryptWithAAD(ciphertext, []byte("row 2"))
+			Expect(err).NotTo(BeNil())
+		})
+
+		It("round-trips with options", func() {
+			options := crypto.EncryptOptions{Cipher: crypto.CipherXChaCha20Poly1305, AdditionalData: []byte("row 1")}
+			ciphertext, err := keyring.EncryptWithOptions([]byte("test"), options)
+			Expect(err).To(BeNil())
+
+			plaintext, err := keyring.DecryptWithAAD(ciphertext, []byte("row 1"))
+			Expect(err).To(BeNil())
+			Expect(plaintext).To(Equal([]byte("test")))
+		})
+
+		It("round-trips streams", func() {
+			plaintext := patternedBytes(crypto.StreamChunkSize + 1)
+
+			var buf bytes.Buffer
+			w, err := keyring.NewEncryptingWriter(&buf)
+			Expect(err).To(BeNil())
+			_, err = w.Write(plaintext)
+			Expect(err).To(BeNil())
+			Expect(w.Close()).To(Succeed())
+
+			_, err = keyring.Rotate()
+			Expect(err).To(BeNil())
+
+			r, err := keyring.NewDecryptingReader(&buf)
+			Expect(err).To(BeNil())
+
+			plaintext2, err := ioutil.ReadAll(r)
+			Expect(err).To(BeNil())
+			Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+		})
+	})
+})
@@ -0,0 +1,463 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// The chunks of an encrypted stream are sealed independently (each has its own nonce), so they can be sealed and
+// opened in parallel. The parallel writer and reader spread the chunks across a pool of workers, each with its own
+// AEAD, and reassemble the results in order; they produce and consume the same format as NewEncryptingWriter and
+// NewDecryptingReader, so either side can be parallel, sequential, or both.
+//
+// Parallelism pays off for large streams on machines with more cores than a single AES-GCM core can keep busy; with one
+// or two workers, or for small inputs, handing chunks between goroutines costs more than it saves, and the sequential
+// functions (or Encrypt) are faster. NewParallelEncryptingWriter falls back to the sequential writer when it has a
+// single worker. At most two chunks per worker are in flight, so memory use is bounded by the number of workers rather
+// than the size of the stream. Compression (see EncryptOptions) is not parallelized, and will usually be the bottleneck
+// when enabled.
+
+// chunkJob is a chunk of a stream that is sealed or opened by a worker.
+type chunkJob struct {
+	in      []byte
+	out     []byte
+	counter uint64
+	last    bool
+	err     error
+	done    chan struct{}
+}
+
+// chunkProcessor seals or opens the job's chunk, using nonce as scratch space.
+type chunkProcessor func(aead cipher.AEAD, nonce []byte, job *chunkJob)
+
+// chunkPipeline is a pool of workers processing chunk jobs, and a fixed set of jobs that are recycled through it.
+type chunkPipeline struct {
+	jobs    chan *chunkJob
+	pending chan *chunkJob // in stream order
+	free    chan *chunkJob
+}
+
+// newChunkPipeline starts the workers, each of which processes jobs with process and its own AEAD for the stream.
+func newChunkPipeline(c CipherID, streamKey *AES256Key, workers int, process chunkProcessor) (*chunkPipeline, error) {
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	aeads := make([]cipher.AEAD, workers)
+	for i := range aeads {
+		aead, err := newAEAD(c, streamKey)
+		if err != nil {
+			return nil, err
+		}
+		aeads[i] = aead
+	}
+
+	depth := 2 * workers
+	p := &chunkPipeline{
+		jobs:    make(chan *chunkJob, depth),
+		pending: make(chan *chunkJob, depth),
+		free:    make(chan *chunkJob, depth),
+	}
+
+	for i := 0; i < depth; i++ {
+		p.free <- &chunkJob{
+			in:  make([]byte, 0, StreamChunkSize+streamTagSize),
+			out: make([]byte, 0, StreamChunkSize+streamTagSize),
+		}
+	}
+
+	for _, aead := range aeads {
+		go func(aead cipher.AEAD) {
+			nonce := make([]byte, aead.NonceSize())
+			for job := range p.jobs {
+				process(aead, nonce, job)
+				close(job.done)
+			}
+		}(aead)
+	}
+
+	return p, nil
+}
+
+// submit queues the job for a worker, and for collection in stream order from pending.
+func (p *chunkPipeline) submit(job *chunkJob) {
+
+	job.err = nil
+	job.done = make(chan struct{})
+
+	// neither send blocks: there are only as many jobs as either channel holds
+	p.pending <- job
+	p.jobs <- job
+}
+
+func sealChunk(aead cipher.AEAD, nonce []byte, job *chunkJob) {
+	job.out = aead.Seal(job.out[:0], streamNonce(nonce, job.counter, job.last), job.in, nil)
+}
+
+func openChunk(aead cipher.AEAD, nonce []byte, job *chunkJob) {
+
+	out, err := aead.Open(job.out[:0], streamNonce(nonce, job.counter, job.last), job.in, nil)
+	if err != nil {
+		job.err = fmt.Errorf("failed to authenticate chunk %d of the encrypted stream: %v", job.counter, err)
+		return
+	}
+
+	job.out = out
+}
+
+type parallelEncryptingWriter struct {
+	w        io.Writer
+	pipeline *chunkPipeline
+	job      *chunkJob // being filled by Write
+	counter  uint64
+	finished chan struct{}
+	closed   bool
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewParallelEncryptingWriter is like NewEncryptingWriterWithOptions, but seals chunks on the provided number of
+// worker goroutines (GOMAXPROCS if workers is zero or less; with one worker, it returns the sequential writer). The
+// result can be decrypted with NewDecryptingReader or NewParallelDecryptingReader. The returned writer must be closed,
+// to write the final chunk and stop the workers; closing it does not close w.
+func NewParallelEncryptingWriter(w io.Writer, key *AES256Key, options EncryptOptions, workers int) (io.WriteCloser, error) {
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	if workers == 1 {
+		return NewEncryptingWriterWithOptions(w, key, options)
+	}
+
+	h, err := newStreamHeader(key, options)
+	if err != nil {
+		return nil, err
+	}
+
+	streamKey, err := beginStream(w, h, key, options.AdditionalData, options.random())
+	if err != nil {
+		return nil, err
+	}
+	defer streamKey.Destroy()
+
+	pipeline, err := newChunkPipeline(h.Cipher, streamKey, workers, sealChunk)
+	if err != nil {
+		return nil, err
+	}
+
+	pw := &parallelEncryptingWriter{w: w, pipeline: pipeline, finished: make(chan struct{})}
+	go pw.writeChunks()
+
+	if h.Flags&FlagCompressed != 0 {
+		cw, err := newCompressingEncryptingWriter(h.Compression, pw)
+		if err != nil {
+			// stop the workers without sealing a final chunk, which would make the stream look complete
+			pw.setError(err)
+			pw.Close()
+			return nil, err
+		}
+		return cw, nil
+	}
+
+	return pw, nil
+}
+
+// writeChunks writes sealed chunks to w in stream order, until the pipeline is closed.
+func (pw *parallelEncryptingWriter) writeChunks() {
+
+	defer close(pw.finished)
+
+	for job := range pw.pipeline.pending {
+		<-job.done
+
+		if pw.error() == nil {
+			if _, err := pw.w.Write(job.out); err != nil {
+				pw.setError(err)
+			}
+		}
+
+		pw.pipeline.free <- job
+	}
+}
+
+func (pw *parallelEncryptingWriter) error() error {
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	return pw.err
+}
+
+func (pw *parallelEncryptingWriter) setError(err error) {
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	pw.err = err
+}
+
+func (pw *parallelEncryptingWriter) Write(p []byte) (int, error) {
+
+	if pw.closed {
+		return 0, errors.New("write to closed encrypting writer")
+	}
+
+	written := 0
+
+	for len(p) > 0 {
+		if err := pw.error(); err != nil {
+			return written, err
+		}
+
+		pw.acquire()
+
+		// a full chunk is only submitted once more data arrives, so that Close can tell whether it is the last chunk
+		if len(pw.job.in) == StreamChunkSize {
+			pw.submit(false)
+			continue
+		}
+
+		n := copy(pw.job.in[len(pw.job.in):StreamChunkSize], p)
+		pw.job.in = pw.job.in[:len(pw.job.in)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// acquire takes a free job to fill, if none is being filled.
+func (pw *parallelEncryptingWriter) acquire() {
+
+	if pw.job == nil {
+		pw.job = <-pw.pipeline.free
+		pw.job.in = pw.job.in[:0]
+	}
+}
+
+func (pw *parallelEncryptingWriter) submit(last bool) {
+
+	pw.job.counter = pw.counter
+	pw.job.last = last
+	pw.counter++
+
+	pw.pipeline.submit(pw.job)
+	pw.job = nil
+}
+
+// Close writes the final chunk, and waits for all chunks to be written. It does not close the underlying writer.
+func (pw *parallelEncryptingWriter) Close() error {
+
+	if pw.closed {
+		return nil
+	}
+
+	pw.closed = true
+
+	if pw.error() == nil {
+		pw.acquire()
+
+		// the last chunk must be short, so a full chunk is written as a regular chunk followed by an empty last chunk
+		if len(pw.job.in) == StreamChunkSize {
+			pw.submit(false)
+			pw.acquire()
+		}
+
+		pw.submit(true)
+	}
+
+	close(pw.pipeline.jobs)
+	close(pw.pipeline.pending)
+	<-pw.finished
+
+	return pw.error()
+}
+
+type parallelDecryptingReader struct {
+	pipeline  *chunkPipeline
+	job       *chunkJob // holding the plaintext being read
+	plain     []byte
+	done      bool
+	err       error
+	quit      chan struct{}
+	finished  chan struct{}
+	closeOnce sync.Once
+}
+
+// NewParallelDecryptingReader is like NewDecryptingReaderWithAAD, but opens chunks on the provided number of worker
+// goroutines (GOMAXPROCS if workers is zero or less), reading ahead of the caller. It decrypts streams produced by
+// NewEncryptingWriter or NewParallelEncryptingWriter. As with NewDecryptingReader, callers should not act on the
+// plaintext until Read has returned io.EOF.
+// The returned reader should be closed if it is abandoned before Read returns an error (including io.EOF), to stop
+// the workers; closing it does not close r. Close waits for a read from r that is in progress, so a source that can
+// block indefinitely (e.g. a network connection) should be closed first.
+func NewParallelDecryptingReader(r io.Reader, additionalData []byte, key *AES256Key, workers int) (io.ReadCloser, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to decrypt with nil key")
+	}
+
+	h, streamKey, err := openStream(r, additionalData, resolveWithKey(key))
+	if err != nil {
+		return nil, err
+	}
+	defer streamKey.Destroy()
+
+	pipeline, err := newChunkPipeline(h.Cipher, streamKey, workers, openChunk)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &parallelDecryptingReader{pipeline: pipeline, quit: make(chan struct{}), finished: make(chan struct{})}
+	go pr.readChunks(r)
+
+	if h.Flags&FlagCompressed != 0 {
+		dr, err := newDecompressingReader(h.Compression, pr)
+		if err != nil {
+			pr.stop()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{dr, pr}, nil
+	}
+
+	return pr, nil
+}
+
+// readChunks reads sealed chunks from r and submits them to the pipeline, until the last chunk, an error, or Close.
+func (pr *parallelDecryptingReader) readChunks(r io.Reader) {
+
+	defer close(pr.finished)
+	defer close(pr.pipeline.jobs)
+	defer close(pr.pipeline.pending)
+
+	for counter := uint64(0); ; counter++ {
+		// a free job may also be ready after Close, so check for it first
+		select {
+		case <-pr.quit:
+			return
+		default:
+		}
+
+		var job *chunkJob
+		select {
+		case job = <-pr.pipeline.free:
+		case <-pr.quit:
+			return
+		}
+
+		job.counter = counter
+		job.last = false
+
+		n, err := io.ReadFull(r, job.in[:StreamChunkSize+streamTagSize])
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			job.last = true
+		default:
+			pr.fail(job, err)
+			return
+		}
+
+		if job.last && n < streamTagSize {
+			pr.fail(job, errors.New("encrypted stream is truncated"))
+			return
+		}
+
+		job.in = job.in[:n]
+		pr.pipeline.submit(job)
+
+		if job.last {
+			return
+		}
+	}
+}
+
+// fail queues a job that reports the error in stream order, without sending it to a worker.
+func (pr *parallelDecryptingReader) fail(job *chunkJob, err error) {
+
+	job.done = make(chan struct{})
+	job.err = err
+	close(job.done)
+
+	pr.pipeline.pending <- job
+}
+
+func (pr *parallelDecryptingReader) Read(p []byte) (int, error) {
+
+	for len(pr.plain) == 0 {
+		if pr.err != nil {
+			return 0, pr.err
+		}
+
+		if pr.done {
+			return 0, io.EOF
+		}
+
+		pr.err = pr.nextChunk()
+	}
+
+	n := copy(p, pr.plain)
+	pr.plain = pr.plain[n:]
+	return n, nil
+}
+
+// nextChunk waits for the next chunk in stream order, recycling the previous one.
+func (pr *parallelDecryptingReader) nextChunk() error {
+
+	if pr.job != nil {
+		pr.pipeline.free <- pr.job
+		pr.job = nil
+	}
+
+	select {
+	case <-pr.quit:
+		return errors.New("read from closed decrypting reader")
+	default:
+	}
+
+	job, ok := <-pr.pipeline.pending
+	if !ok {
+		return errors.New("read from closed decrypting reader")
+	}
+
+	<-job.done
+
+	pr.job = job
+	if job.err != nil {
+		// stop reading ahead of a stream that has already failed, without waiting for a read in progress
+		pr.stop()
+		return job.err
+	}
+
+	pr.plain = job.out
+	pr.done = job.last
+	return nil
+}
+
+// Close stops reading ahead, and the workers, and waits for a read from the underlying reader that is in progress. It
+// does not close the underlying reader.
+func (pr *parallelDecryptingReader) Close() error {
+
+	pr.stop()
+	<-pr.finished
+
+	return nil
+}
+
+// stop tells readChunks to stop reading ahead, without waiting for it.
+func (pr *parallelDecryptingReader) stop() {
+
+	pr.closeOnce.Do(func() {
+		close(pr.quit)
+	})
+}
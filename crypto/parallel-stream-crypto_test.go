@@ -0,0 +1,403 @@
+package crypto_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func encryptStreamInParallel(plaintext []byte, key *crypto.AES256Key, options crypto.EncryptOptions, workers int) []byte {
+	var buf bytes.Buffer
+
+	w, err := crypto.NewParallelEncryptingWriter(&buf, key, options, workers)
+	Expect(err).To(BeNil())
+
+	_, err = w.Write(plaintext)
+	Expect(err).To(BeNil())
+	Expect(w.Close()).To(Succeed())
+
+	return buf.Bytes()
+}
+
+func decryptStreamInParallel(ciphertext []byte, key *crypto.AES256Key, workers int) ([]byte, error) {
+	r, err := crypto.NewParallelDecryptingReader(bytes.NewReader(ciphertext), nil, key, workers)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// limitedWriter fails once more than limit bytes have been written to it.
+type limitedWriter struct {
+	limit int
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > lw.limit {
+		return 0, errors.New("disk full")
+	}
+	lw.limit -= len(p)
+	return len(p), nil
+}
+
+// gatedReader blocks reads until its gate is closed, and reports each read that is waiting on waiting.
+type gatedReader struct {
+	r       io.Reader
+	gate    chan struct{}
+	waiting chan struct{}
+}
+
+func (gr *gatedReader) Read(p []byte) (int, error) {
+	select {
+	case gr.waiting <- struct{}{}:
+	default:
+	}
+
+	<-gr.gate
+	return gr.r.Read(p)
+}
+
+var _ = Describe("NewParallelEncryptingWriter", func() {
+	sizes := []int{
+		0,
+		1,
+		crypto.StreamChunkSize - 1,
+		crypto.StreamChunkSize,
+		crypto.StreamChunkSize + 1,
+		10*crypto.StreamChunkSize + 17,
+	}
+
+	It("produces a stream that NewDecryptingReader decrypts", func() {
+		for _, workers := range []int{0, 1, 3} {
+			for _, size := range sizes {
+				plaintext := patternedBytes(size)
+				ciphertext := encryptStreamInParallel(plaintext, &fixedKey, crypto.EncryptOptions{}, workers)
+
+				plaintext2, err := decryptStream(ciphertext, &fixedKey)
+				Expect(err).To(BeNil())
+				Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true), "workers %d, size %d", workers, size)
+			}
+		}
+	})
+
+	It("produces a stream the same length as NewEncryptingWriter", func() {
+		plaintext := patternedBytes(3*crypto.StreamChunkSize + 5)
+		Expect(encryptStreamInParallel(plaintext, &fixedKey, crypto.EncryptOptions{}, 4)).To(HaveLen(len(encryptStream(plaintext, &fixedKey))))
+	})
+
+	It("handles many small writes", func() {
+		plaintext := patternedBytes(5*crypto.StreamChunkSize + 5)
+
+		var buf bytes.Buffer
+		w, err := crypto.NewParallelEncryptingWriter(&buf, &fixedKey, crypto.EncryptOptions{}, 4)
+		Expect(err).To(BeNil())
+
+		for i := 0; i < len(plaintext); i += 1000 {
+			end := i + 1000
+			if end > len(plaintext) {
+				end = len(plaintext)
+			}
+			_, err = w.Write(plaintext[i:end])
+			Expect(err).To(BeNil())
+		}
+		Expect(w.Close()).To(Succeed())
+
+		plaintext2, err := decryptStream(buf.Bytes(), &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+	})
+
+	It("encrypts with the provided options", func() {
+		plaintext := compressibleBytes(20000)
+		options := crypto.EncryptOptions{
+			Cipher:         crypto.CipherXChaCha20Poly1305,
+			AdditionalData: []byte("backup-42"),
+			Compression:    crypto.CompressionZstd,
+		}
+
+		ciphertext := encryptStreamInParallel(plaintext, &fixedKey, options, 4)
+		Expect(len(ciphertext)).To(BeNumerically("<", len(plaintext)/2))
+
+		r, err := crypto.NewDecryptingReaderWithAAD(bytes.NewReader(ciphertext), []byte("backup-42"), &fixedKey)
+		Expect(err).To(BeNil())
+		plaintext2, err := ioutil.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+
+		_, err = decryptStream(ciphertext, &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("returns errors from the underlying writer", func() {
+		_, err := crypto.NewParallelEncryptingWriter(&limitedWriter{}, &fixedKey, crypto.EncryptOptions{}, 2)
+		Expect(err).NotTo(BeNil())
+
+		w, err := crypto.NewParallelEncryptingWriter(&limitedWriter{limit: 3 * crypto.StreamChunkSize}, &fixedKey, crypto.EncryptOptions{}, 2)
+		Expect(err).To(BeNil())
+
+		// the failure is reported by a later Write or by Close, as chunks are written in the background
+		_, err = w.Write(patternedBytes(10 * crypto.StreamChunkSize))
+		if err == nil {
+			err = w.Close()
+		}
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires a valid key", func() {
+		w, err := crypto.NewParallelEncryptingWriter(&bytes.Buffer{}, nil, crypto.EncryptOptions{}, 2)
+		Expect(w).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("refuses writes after Close", func() {
+		w, err := crypto.NewParallelEncryptingWriter(&bytes.Buffer{}, &fixedKey, crypto.EncryptOptions{}, 2)
+		Expect(err).To(BeNil())
+		Expect(w.Close()).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		_, err = w.Write([]byte("test"))
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("NewParallelDecryptingReader", func() {
+	It("decrypts a stream produced by NewEncryptingWriter", func() {
+		for _, workers := range []int{0, 1, 3} {
+			for _, size := range []int{0, 1, crypto.StreamChunkSize, 10*crypto.StreamChunkSize + 17} {
+				plaintext := patternedBytes(size)
+
+				plaintext2, err := decryptStreamInParallel(encryptStream(plaintext, &fixedKey), &fixedKey, workers)
+				Expect(err).To(BeNil())
+				Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true), "workers %d, size %d", workers, size)
+			}
+		}
+	})
+
+	It("decrypts a compressed stream bound to additional data", func() {
+		plaintext := compressibleBytes(20000)
+		options := crypto.EncryptOptions{AdditionalData: []byte("backup-42"), Compression: crypto.CompressionGzip}
+		ciphertext := encryptStreamInParallel(plaintext, &fixedKey, options, 4)
+
+		r, err := crypto.NewParallelDecryptingReader(bytes.NewReader(ciphertext), []byte("backup-42"), &fixedKey, 4)
+		Expect(err).To(BeNil())
+		plaintext2, err := ioutil.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+		Expect(r.Close()).To(Succeed())
+
+		// gzip reads its header when the reader is created, so the first chunk fails authentication there
+		_, err = crypto.NewParallelDecryptingReader(bytes.NewReader(ciphertext), []byte("backup-43"), &fixedKey, 4)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("fails with the wrong key", func() {
+		_, err := decryptStreamInParallel(encryptStream(patternedBytes(100), &fixedKey), crypto.NewRandomAESKey(), 2)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("detects a modified chunk", func() {
+		ciphertext := encryptStream(patternedBytes(8*crypto.StreamChunkSize+10), &fixedKey)
+		ciphertext[len(ciphertext)/2] ^= 1
+
+		_, err := decryptStreamInParallel(ciphertext, &fixedKey, 4)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("detects truncation", func() {
+		ciphertext := encryptStream(patternedBytes(2*crypto.StreamChunkSize+10), &fixedKey)
+		chunkBoundary := len(ciphertext) - (10 + 16) - (crypto.StreamChunkSize + 16)
+
+		for _, length := range []int{chunkBoundary, len(ciphertext) - (10 + 16), len(ciphertext) - 1} {
+			_, err := decryptStreamInParallel(ciphertext[:length], &fixedKey, 4)
+			Expect(err).NotTo(BeNil(), "length %d", length)
+		}
+	})
+
+	It("detects reordered chunks", func() {
+		ciphertext := encryptStream(patternedBytes(3*crypto.StreamChunkSize), &fixedKey)
+		sealedChunkSize := crypto.StreamChunkSize + 16
+		start := len(ciphertext) - 16 - 3*sealedChunkSize
+
+		reordered := append([]byte{}, ciphertext[:start]...)
+		reordered = append(reordered, ciphertext[start+sealedChunkSize:start+2*sealedChunkSize]...)
+		reordered = append(reordered, ciphertext[start:start+sealedChunkSize]...)
+		reordered = append(reordered, ciphertext[start+2*sealedChunkSize:]...)
+
+		_, err := decryptStreamInParallel(reordered, &fixedKey, 4)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("returns the plaintext before a modified chunk, but not after it", func() {
+		plaintext := patternedBytes(6 * crypto.StreamChunkSize)
+		ciphertext := encryptStream(plaintext, &fixedKey)
+		ciphertext[len(ciphertext)-2*crypto.StreamChunkSize] ^= 1
+
+		r, err := crypto.NewParallelDecryptingReader(bytes.NewReader(ciphertext), nil, &fixedKey, 4)
+		Expect(err).To(BeNil())
+
+		plaintext2, err := ioutil.ReadAll(r)
+		Expect(err).NotTo(BeNil())
+		Expect(len(plaintext2) % crypto.StreamChunkSize).To(Equal(0))
+		Expect(len(plaintext2)).To(BeNumerically("<", len(plaintext)))
+		Expect(bytes.Equal(plaintext2, plaintext[:len(plaintext2)])).To(Equal(true))
+
+		_, err = r.Read(make([]byte, 100))
+		Expect(err).NotTo(BeNil())
+		Expect(err).NotTo(Equal(io.EOF))
+	})
+
+	It("can be closed before the stream has been read", func() {
+		ciphertext := encryptStream(patternedBytes(20*crypto.StreamChunkSize), &fixedKey)
+
+		r, err := crypto.NewParallelDecryptingReader(bytes.NewReader(ciphertext), nil, &fixedKey, 2)
+		Expect(err).To(BeNil())
+
+		_, err = io.ReadFull(r, make([]byte, crypto.StreamChunkSize+1))
+		Expect(err).To(BeNil())
+
+		Expect(r.Close()).To(Succeed())
+		Expect(r.Close()).To(Succeed())
+
+		_, err = ioutil.ReadAll(r)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("waits for a read from the underlying reader when closed", func() {
+		ciphertext := encryptStream(patternedBytes(20*crypto.StreamChunkSize), &fixedKey)
+		gated := &gatedReader{bytes.NewReader(ciphertext[crypto.StreamChunkSize:]), make(chan struct{}), make(chan struct{}, 1)}
+		source := io.MultiReader(bytes.NewReader(ciphertext[:crypto.StreamChunkSize]), gated)
+
+		r, err := crypto.NewParallelDecryptingReader(source, nil, &fixedKey, 2)
+		Expect(err).To(BeNil())
+		Eventually(gated.waiting).Should(Receive())
+
+		closed := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(r.Close()).To(Succeed())
+			close(closed)
+		}()
+
+		Consistently(closed, "50ms").ShouldNot(BeClosed())
+		close(gated.gate)
+		Eventually(closed).Should(BeClosed())
+	})
+
+	It("requires a valid key", func() {
+		r, err := crypto.NewParallelDecryptingReader(bytes.NewReader(encryptStream([]byte("test"), &fixedKey)), nil, nil, 2)
+		Expect(r).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+const benchmarkSize = 64 * 1024 * 1024
+
+func BenchmarkEncrypt(b *testing.B) {
+	plaintext := patternedBytes(benchmarkSize)
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := crypto.Encrypt(plaintext, &fixedKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncryptingWriter(b *testing.B) {
+	benchmarkEncryptingWriter(b, func(w io.Writer) (io.WriteCloser, error) {
+		return crypto.NewEncryptingWriter(w, &fixedKey)
+	})
+}
+
+func BenchmarkParallelEncryptingWriter(b *testing.B) {
+	benchmarkEncryptingWriter(b, func(w io.Writer) (io.WriteCloser, error) {
+		return crypto.NewParallelEncryptingWriter(w, &fixedKey, crypto.EncryptOptions{}, 0)
+	})
+}
+
+func benchmarkEncryptingWriter(b *testing.B, newWriter func(io.Writer) (io.WriteCloser, error)) {
+	plaintext := patternedBytes(benchmarkSize)
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		w, err := newWriter(ioutil.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := w.Write(plaintext); err != nil {
+			b.Fatal(err)
+		}
+
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecrypt(b *testing.B) {
+	ciphertext, err := crypto.Encrypt(patternedBytes(benchmarkSize), &fixedKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := crypto.Decrypt(ciphertext, &fixedKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecryptingReader(b *testing.B) {
+	benchmarkDecryptingReader(b, func(r io.Reader) (io.Reader, error) {
+		return crypto.NewDecryptingReader(r, &fixedKey)
+	})
+}
+
+func BenchmarkParallelDecryptingReader(b *testing.B) {
+	benchmarkDecryptingReader(b, func(r io.Reader) (io.Reader, error) {
+		return crypto.NewParallelDecryptingReader(r, nil, &fixedKey, 0)
+	})
+}
+
+func benchmarkDecryptingReader(b *testing.B, newReader func(io.Reader) (io.Reader, error)) {
+	var buf bytes.Buffer
+
+	w, err := crypto.NewEncryptingWriter(&buf, &fixedKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := w.Write(patternedBytes(benchmarkSize)); err != nil {
+		b.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r, err := newReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// EncryptWithPassphrase encrypts the plaintext with a key derived from the passphrase (see NewAESKeyFromPassphrase)
+// and returns the result; the KDF parameters are stored in the ciphertext's header. The additional data may be nil
+// (see EncryptWithAAD).
+func EncryptWithPassphrase(plaintext []byte, additionalData []byte, passphrase []byte) ([]byte, error) {
+
+	h, key, err := newPassphraseHeader(0, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Destroy()
+
+	return seal(h, key, plaintext, additionalData, rand.Reader)
+}
+
+// DecryptWithPassphrase decrypts the ciphertext (e.g. from a previous call to EncryptWithPassphrase) with a key
+// derived from the passphrase and the KDF parameters stored in the ciphertext, and returns the result.
+func DecryptWithPassphrase(ciphertext []byte, additionalData []byte, passphrase []byte) ([]byte, error) {
+	return open(ciphertext, additionalData, resolveWithPassphrase(passphrase))
+}
+
+// NewPassphraseEncryptingWriter is like NewEncryptingWriterWithAAD, but encrypts with a key derived from the
+// passphrase; the KDF parameters are stored in the stream's header. Use NewPassphraseDecryptingReader to decrypt the
+// result.
+func NewPassphraseEncryptingWriter(w io.Writer, additionalData []byte, passphrase []byte) (io.WriteCloser, error) {
+
+	h, key, err := newPassphraseHeader(FlagStream, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Destroy()
+
+	return newEncryptingWriter(w, h, key, additionalData, rand.Reader)
+}
+
+// NewPassphraseDecryptingReader is like NewDecryptingReaderWithAAD, but decrypts with a key derived from the
+// passphrase and the KDF parameters stored in the stream's header.
+func NewPassphraseDecryptingReader(r io.Reader, additionalData []byte, passphrase []byte) (io.Reader, error) {
+	return newDecryptingReader(r, additionalData, resolveWithPassphrase(passphrase))
+}
+
+// newPassphraseHeader derives a key from the passphrase with new KDF parameters, and returns it along with a header
+// that records the parameters.
+func newPassphraseHeader(flags byte, passphrase []byte) (*Header, *AES256Key, error) {
+
+	params, err := NewKDFParams()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := NewAESKeyFromPassphrase(passphrase, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := newHeader(CipherAES256GCM, flags|FlagPassphrase, key)
+	h.KDFParams = params.String()
+	return h, key, nil
+}
+
+func resolveWithPassphrase(passphrase []byte) keyResolver {
+	return func(h *Header) (*AES256Key, error) {
+
+		if h.Flags&FlagPassphrase == 0 {
+			return nil, errors.New("ciphertext is not passphrase-encrypted")
+		}
+
+		params, err := ParseKDFParams(h.KDFParams)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := NewAESKeyFromPassphrase(passphrase, params)
+		if err != nil {
+			return nil, err
+		}
+
+		if h.KeyID != key.ID() {
+			return nil, errors.New("incorrect passphrase")
+		}
+
+		return key, nil
+	}
+}
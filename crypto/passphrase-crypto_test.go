@@ -0,0 +1,86 @@
+package crypto_test
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EncryptWithPassphrase / DecryptWithPassphrase", func() {
+	passphrase := []byte("correct horse battery staple")
+
+	It("round-trips with the same passphrase", func() {
+		ciphertext, err := crypto.EncryptWithPassphrase([]byte("test"), nil, passphrase)
+		Expect(err).To(BeNil())
+
+		h, err := crypto.ParseHeader(ciphertext)
+		Expect(err).To(BeNil())
+		Expect(h.Flags & crypto.FlagPassphrase).To(Equal(crypto.FlagPassphrase))
+
+		params, err := crypto.ParseKDFParams(h.KDFParams)
+		Expect(err).To(BeNil())
+		Expect(params.Memory).To(Equal(uint32(crypto.DefaultKDFMemory)))
+
+		plaintext, err := crypto.DecryptWithPassphrase(ciphertext, nil, passphrase)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+
+		plaintext, err = crypto.DecryptWithPassphrase(ciphertext, nil, []byte("wrong"))
+		Expect(plaintext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("binds the ciphertext to the additional data", func() {
+		ciphertext, err := crypto.EncryptWithPassphrase([]byte("test"), []byte("row 1"), passphrase)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.DecryptWithPassphrase(ciphertext, []byte("row 2"), passphrase)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("is not interchangeable with Decrypt", func() {
+		ciphertext, err := crypto.EncryptWithPassphrase([]byte("test"), nil, passphrase)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.Decrypt(ciphertext, &fixedKey)
+		Expect(err).NotTo(BeNil())
+
+		ciphertext, err = crypto.Encrypt([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.DecryptWithPassphrase(ciphertext, nil, passphrase)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires a passphrase", func() {
+		ciphertext, err := crypto.EncryptWithPassphrase([]byte("test"), nil, nil)
+		Expect(ciphertext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("NewPassphraseEncryptingWriter / NewPassphraseDecryptingReader", func() {
+	It("round-trips a stream with the same passphrase", func() {
+		plaintext := patternedBytes(crypto.StreamChunkSize + 1)
+		passphrase := []byte("correct horse battery staple")
+
+		var buf bytes.Buffer
+		w, err := crypto.NewPassphraseEncryptingWriter(&buf, nil, passphrase)
+		Expect(err).To(BeNil())
+		_, err = w.Write(plaintext)
+		Expect(err).To(BeNil())
+		Expect(w.Close()).To(Succeed())
+
+		r, err := crypto.NewPassphraseDecryptingReader(bytes.NewReader(buf.Bytes()), nil, passphrase)
+		Expect(err).To(BeNil())
+		plaintext2, err := ioutil.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+
+		_, err = crypto.NewPassphraseDecryptingReader(bytes.NewReader(buf.Bytes()), nil, []byte("wrong"))
+		Expect(err).NotTo(BeNil())
+	})
+})
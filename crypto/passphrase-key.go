@@ -0,0 +1,181 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const kdfID = "argon2id"
+
+const (
+	// DefaultKDFMemory is the default argon2id memory cost, in KiB (64 MiB, per RFC 9106).
+	DefaultKDFMemory = 64 * 1024
+	// DefaultKDFIterations is the default argon2id time cost.
+	DefaultKDFIterations = 3
+	// DefaultKDFParallelism is the default argon2id parallelism.
+	DefaultKDFParallelism = 4
+)
+
+const kdfSaltLength = 16
+
+// Parsed parameters may come from untrusted input (e.g. a ciphertext header or a stored password hash), so their costs
+// are bounded near the defaults: to 256 MiB of memory (in KiB), 10 iterations and 16 threads. A crafted header can
+// still make a single decryption use that much memory and time, so callers that decrypt untrusted input concurrently
+// should limit how many decryptions run at once.
+const (
+	minKDFSaltLength  = 8
+	maxKDFMemory      = 256 * 1024
+	maxKDFIterations  = 10
+	maxKDFParallelism = 16
+)
+
+// KDFParams are the argon2id parameters used to derive a key from a passphrase. They are not secret, and must be
+// kept (e.g. as the portable string returned by String) to derive the same key again.
+type KDFParams struct {
+	// Memory is the memory cost, in KiB.
+	Memory uint32
+	// Iterations is the time cost.
+	Iterations uint32
+	// Parallelism is the number of threads.
+	Parallelism uint8
+	Salt        []byte
+}
+
+// NewKDFParams returns KDFParams with the default costs and a new, random salt.
+func NewKDFParams() (*KDFParams, error) {
+
+	salt := make([]byte, kdfSaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	return &KDFParams{
+		Memory:      DefaultKDFMemory,
+		Iterations:  DefaultKDFIterations,
+		Parallelism: DefaultKDFParallelism,
+		Salt:        salt,
+	}, nil
+}
+
+// ParseKDFParams parses the string representation of KDFParams (see KDFParams.String).
+func ParseKDFParams(s string) (*KDFParams, error) {
+
+	phc, err := parsePHCString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if phc.hash != nil {
+		return nil, errors.New("KDF parameters must not include a hash")
+	}
+
+	return kdfParamsFromPHC(phc)
+}
+
+// kdfParamsFromPHC returns the argon2id parameters of a PHC string, ignoring any hash.
+func kdfParamsFromPHC(phc *phcString) (*KDFParams, error) {
+
+	if phc.id != kdfID {
+		return nil, fmt.Errorf("unsupported KDF %q", phc.id)
+	}
+
+	if phc.version != strconv.Itoa(argon2.Version) {
+		return nil, fmt.Errorf("unsupported %s version %q", kdfID, phc.version)
+	}
+
+	memory, err := phc.uintParam("m", 1, maxKDFMemory)
+	if err != nil {
+		return nil, err
+	}
+
+	iterations, err := phc.uintParam("t", 1, maxKDFIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	parallelism, err := phc.uintParam("p", 1, maxKDFParallelism)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &KDFParams{
+		Memory:      uint32(memory),
+		Iterations:  uint32(iterations),
+		Parallelism: uint8(parallelism),
+		Salt:        phc.salt,
+	}
+
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+// String returns the parameters as a portable PHC-format string, e.g. "$argon2id$v=19$m=65536,t=3,p=4$<salt>".
+func (p *KDFParams) String() string {
+	return p.phc(nil).String()
+}
+
+func (p *KDFParams) phc(hash []byte) *phcString {
+	return &phcString{
+		id:      kdfID,
+		version: strconv.Itoa(argon2.Version),
+		params: [][2]string{
+			{"m", strconv.FormatUint(uint64(p.Memory), 10)},
+			{"t", strconv.FormatUint(uint64(p.Iterations), 10)},
+			{"p", strconv.FormatUint(uint64(p.Parallelism), 10)},
+		},
+		salt: p.Salt,
+		hash: hash,
+	}
+}
+
+func (p *KDFParams) validate() error {
+
+	if len(p.Salt) < minKDFSaltLength {
+		return fmt.Errorf("KDF salt must be at least %d bytes", minKDFSaltLength)
+	}
+
+	if p.Iterations < 1 || p.Iterations > maxKDFIterations {
+		return fmt.Errorf("KDF iterations %d is out of range [1, %d]", p.Iterations, maxKDFIterations)
+	}
+
+	if p.Parallelism < 1 || p.Parallelism > maxKDFParallelism {
+		return fmt.Errorf("KDF parallelism %d is out of range [1, %d]", p.Parallelism, maxKDFParallelism)
+	}
+
+	// argon2 requires at least 8 KiB per thread
+	if p.Memory < 8*uint32(p.Parallelism) || p.Memory > maxKDFMemory {
+		return fmt.Errorf("KDF memory %d KiB is out of range [%d, %d]", p.Memory, 8*uint32(p.Parallelism), maxKDFMemory)
+	}
+
+	return nil
+}
+
+// NewAESKeyFromPassphrase derives a 256-bit AES key from the passphrase with argon2id, a memory-hard KDF.
+// The same passphrase and params always derive the same key; use NewKDFParams to create params for a new key.
+func NewAESKeyFromPassphrase(passphrase []byte, params *KDFParams) (*AES256Key, error) {
+
+	if len(passphrase) == 0 {
+		return nil, errors.New("zero-value passphrase")
+	}
+
+	if params == nil {
+		return nil, errors.New("tried to derive a key with nil KDF parameters")
+	}
+
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+
+	keyBytes := argon2.IDKey(passphrase, params.Salt, params.Iterations, params.Memory, params.Parallelism, AES256KeyLengthInBytes)
+	defer zeroBytes(keyBytes)
+
+	return newAESKeyFromBytes(keyBytes)
+}
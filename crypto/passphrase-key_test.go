@@ -0,0 +1,106 @@
+package crypto_test
+
+import (
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// cheap parameters, to keep the tests fast
+func testKDFParams() *crypto.KDFParams {
+	return &crypto.KDFParams{
+		Memory:      64,
+		Iterations:  1,
+		Parallelism: 1,
+		Salt:        []byte("0123456789abcdef"),
+	}
+}
+
+var _ = Describe("KDFParams", func() {
+	It("has a factory function that uses the default costs and a random salt", func() {
+		params1, err := crypto.NewKDFParams()
+		Expect(err).To(BeNil())
+		params2, err := crypto.NewKDFParams()
+		Expect(err).To(BeNil())
+
+		Expect(params1.Memory).To(Equal(uint32(crypto.DefaultKDFMemory)))
+		Expect(params1.Iterations).To(Equal(uint32(crypto.DefaultKDFIterations)))
+		Expect(params1.Parallelism).To(Equal(uint8(crypto.DefaultKDFParallelism)))
+		Expect(params1.Salt).NotTo(Equal(params2.Salt))
+	})
+
+	It("is encoded as a portable PHC-format string", func() {
+		s := testKDFParams().String()
+		Expect(s).To(Equal("$argon2id$v=19$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg"))
+
+		params, err := crypto.ParseKDFParams(s)
+		Expect(err).To(BeNil())
+		Expect(params).To(Equal(testKDFParams()))
+	})
+
+	It("rejects malformed or unsupported strings", func() {
+		for _, s := range []string{
+			"",
+			"argon2id",
+			"$scrypt$ln=15,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$argon2id$v=16$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$argon2id$v=19$m=64,t=1$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$argon2id$v=19$m=64,t=1,p=1$MDEy",
+			"$argon2id$v=19$m=64,t=1,p=1$not base64!",
+			"$argon2id$v=19$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$aGFzaA",
+			// costs from untrusted input are bounded
+			"$argon2id$v=19$m=4294967295,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$argon2id$v=19$m=64,t=100000,p=1$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$argon2id$v=19$m=262145,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$argon2id$v=19$m=64,t=11,p=1$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$argon2id$v=19$m=64,t=1,p=0$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$argon2id$v=19$m=256,t=1,p=17$MDEyMzQ1Njc4OWFiY2RlZg",
+		} {
+			_, err := crypto.ParseKDFParams(s)
+			Expect(err).NotTo(BeNil(), s)
+		}
+	})
+})
+
+var _ = Describe("NewAESKeyFromPassphrase", func() {
+	It("derives the same key from the same passphrase and parameters", func() {
+		key1, err := crypto.NewAESKeyFromPassphrase([]byte("correct horse battery staple"), testKDFParams())
+		Expect(err).To(BeNil())
+		key2, err := crypto.NewAESKeyFromPassphrase([]byte("correct horse battery staple"), testKDFParams())
+		Expect(err).To(BeNil())
+
+		Expect(crypto.Equal(key1, key2)).To(Equal(true))
+		Expect(crypto.Equal(key1, &crypto.AES256Key{})).To(Equal(false))
+	})
+
+	It("derives different keys from different passphrases or salts", func() {
+		key1, err := crypto.NewAESKeyFromPassphrase([]byte("correct horse battery staple"), testKDFParams())
+		Expect(err).To(BeNil())
+
+		key2, err := crypto.NewAESKeyFromPassphrase([]byte("correct horse battery stapler"), testKDFParams())
+		Expect(err).To(BeNil())
+		Expect(crypto.Equal(key1, key2)).To(Equal(false))
+
+		params := testKDFParams()
+		params.Salt = []byte("fedcba9876543210")
+		key3, err := crypto.NewAESKeyFromPassphrase([]byte("correct horse battery staple"), params)
+		Expect(err).To(BeNil())
+		Expect(crypto.Equal(key1, key3)).To(Equal(false))
+	})
+
+	It("requires a passphrase and valid parameters", func() {
+		key, err := crypto.NewAESKeyFromPassphrase(nil, testKDFParams())
+		Expect(key).To(BeNil())
+		Expect(err).NotTo(BeNil())
+
+		key, err = crypto.NewAESKeyFromPassphrase([]byte("passphrase"), nil)
+		Expect(key).To(BeNil())
+		Expect(err).NotTo(BeNil())
+
+		params := testKDFParams()
+		params.Salt = params.Salt[:4]
+		key, err = crypto.NewAESKeyFromPassphrase([]byte("passphrase"), params)
+		Expect(key).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
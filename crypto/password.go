@@ -0,0 +1,208 @@
+package crypto
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordMismatch is returned by VerifyPassword when the password does not match the hash.
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordAlgorithm identifies a password hashing algorithm.
+type PasswordAlgorithm int
+
+const (
+	// PasswordArgon2id is argon2id (RFC 9106), a memory-hard function; it is the recommended algorithm.
+	PasswordArgon2id PasswordAlgorithm = iota + 1
+	// PasswordBcrypt is bcrypt, supported for compatibility with existing hashes. bcrypt only uses the first 72 bytes
+	// of a password.
+	PasswordBcrypt
+)
+
+// String returns the name of the algorithm.
+func (a PasswordAlgorithm) String() string {
+	switch a {
+	case PasswordArgon2id:
+		return kdfID
+	case PasswordBcrypt:
+		return "bcrypt"
+	default:
+		return fmt.Sprintf("unknown password algorithm (%d)", int(a))
+	}
+}
+
+const passwordHashLength = 32
+
+// minPasswordHashLength bounds the hashes accepted from (untrusted) encoded hashes.
+const minPasswordHashLength = 16
+
+// PasswordHasher hashes passwords with an algorithm and costs. Hashes are self-describing: VerifyPassword accepts a
+// hash produced with any supported algorithm and costs, and NeedsRehash reports whether a hash was produced with
+// different ones, so that costs can be raised over time by rehashing as users log in.
+//
+// argon2id hashes are PHC-format strings (e.g. "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>"); bcrypt hashes are
+// in bcrypt's own modular crypt format (e.g. "$2a$10$<salt and hash>"), as existing bcrypt hashes are.
+type PasswordHasher struct {
+	// Algorithm is the algorithm new hashes are produced with.
+	Algorithm PasswordAlgorithm
+
+	// Memory (in KiB), Iterations and Parallelism are the argon2id costs. They are bounded like parsed KDFParams
+	// (at most 256 MiB, 10 iterations and 16 threads), as Verify must parse the hashes they produce; Hash returns an
+	// error for costs outside the bounds.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+
+	// BcryptCost is the bcrypt cost.
+	BcryptCost int
+}
+
+// NewPasswordHasher returns a PasswordHasher that uses argon2id with the default costs (see DefaultKDFMemory), and
+// bcrypt's default cost if its Algorithm is changed to PasswordBcrypt.
+func NewPasswordHasher() *PasswordHasher {
+	return &PasswordHasher{
+		Algorithm:   PasswordArgon2id,
+		Memory:      DefaultKDFMemory,
+		Iterations:  DefaultKDFIterations,
+		Parallelism: DefaultKDFParallelism,
+		BcryptCost:  bcrypt.DefaultCost,
+	}
+}
+
+// HashPassword hashes the password with argon2id and the default costs (see PasswordHasher.Hash).
+func HashPassword(password []byte) (string, error) {
+	return NewPasswordHasher().Hash(password)
+}
+
+// VerifyPassword checks the password against the encoded hash (see PasswordHasher.Verify).
+func VerifyPassword(password []byte, encodedHash string) error {
+	return NewPasswordHasher().Verify(password, encodedHash)
+}
+
+// NeedsRehash reports whether the encoded hash was produced with an algorithm or costs other than argon2id and the
+// default costs (see PasswordHasher.NeedsRehash).
+func NeedsRehash(encodedHash string) bool {
+	return NewPasswordHasher().NeedsRehash(encodedHash)
+}
+
+// Hash hashes the password with a new, random salt, and returns the encoded hash.
+func (ph *PasswordHasher) Hash(password []byte) (string, error) {
+
+	if len(password) == 0 {
+		return "", errors.New("zero-value password")
+	}
+
+	switch ph.Algorithm {
+	case PasswordArgon2id:
+		params, err := NewKDFParams()
+		if err != nil {
+			return "", err
+		}
+
+		params.Memory = ph.Memory
+		params.Iterations = ph.Iterations
+		params.Parallelism = ph.Parallelism
+
+		if err := params.validate(); err != nil {
+			return "", err
+		}
+
+		hash := argon2.IDKey(password, params.Salt, params.Iterations, params.Memory, params.Parallelism, passwordHashLength)
+		return params.phc(hash).String(), nil
+
+	case PasswordBcrypt:
+		hash, err := bcrypt.GenerateFromPassword(password, ph.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+
+	default:
+		return "", fmt.Errorf("unsupported password algorithm: %v", ph.Algorithm)
+	}
+}
+
+// Verify checks the password against the encoded hash (e.g. from a previous call to Hash), in constant time. It
+// returns ErrPasswordMismatch if the password does not match, or another error if the hash is malformed. The hash
+// may have been produced with any supported algorithm and costs.
+func (ph *PasswordHasher) Verify(password []byte, encodedHash string) error {
+
+	if isBcryptHash(encodedHash) {
+		err := bcrypt.CompareHashAndPassword([]byte(encodedHash), password)
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return ErrPasswordMismatch
+		}
+		return err
+	}
+
+	params, hash, err := parseArgon2idHash(encodedHash)
+	if err != nil {
+		return err
+	}
+
+	computed := argon2.IDKey(password, params.Salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(hash)))
+	if subtle.ConstantTimeCompare(computed, hash) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
+
+// NeedsRehash reports whether the encoded hash was produced with an algorithm or costs other than the hasher's (or
+// is malformed), in which case the password should be hashed again once it has been verified.
+func (ph *PasswordHasher) NeedsRehash(encodedHash string) bool {
+
+	if isBcryptHash(encodedHash) {
+		if ph.Algorithm != PasswordBcrypt {
+			return true
+		}
+
+		cost, err := bcrypt.Cost([]byte(encodedHash))
+		return err != nil || cost != ph.BcryptCost
+	}
+
+	if ph.Algorithm != PasswordArgon2id {
+		return true
+	}
+
+	params, hash, err := parseArgon2idHash(encodedHash)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != ph.Memory ||
+		params.Iterations != ph.Iterations ||
+		params.Parallelism != ph.Parallelism ||
+		len(params.Salt) < kdfSaltLength ||
+		len(hash) < passwordHashLength
+}
+
+func isBcryptHash(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$2a$") ||
+		strings.HasPrefix(encodedHash, "$2b$") ||
+		strings.HasPrefix(encodedHash, "$2y$")
+}
+
+func parseArgon2idHash(encodedHash string) (*KDFParams, []byte, error) {
+
+	phc, err := parsePHCString(encodedHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params, err := kdfParamsFromPHC(phc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(phc.hash) < minPasswordHashLength {
+		return nil, nil, errors.New("malformed password hash")
+	}
+
+	return params, phc.hash, nil
+}
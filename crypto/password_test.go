@@ -0,0 +1,150 @@
+package crypto_test
+
+import (
+	"strings"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testPasswordHasher returns a hasher with low costs, to keep the tests fast.
+func testPasswordHasher(algorithm crypto.PasswordAlgorithm) *crypto.PasswordHasher {
+	return &crypto.PasswordHasher{
+		Algorithm:   algorithm,
+		Memory:      64,
+		Iterations:  1,
+		Parallelism: 1,
+		BcryptCost:  4,
+	}
+}
+
+var _ = Describe("HashPassword", func() {
+	It("hashes with argon2id and the default costs", func() {
+		hash, err := crypto.HashPassword([]byte("correct horse battery staple"))
+		Expect(err).To(BeNil())
+		Expect(hash).To(HavePrefix("$argon2id$v=19$m=65536,t=3,p=4$"))
+
+		Expect(crypto.VerifyPassword([]byte("correct horse battery staple"), hash)).To(Succeed())
+		Expect(crypto.VerifyPassword([]byte("correct horse battery stapler"), hash)).To(Equal(crypto.ErrPasswordMismatch))
+		Expect(crypto.NeedsRehash(hash)).To(Equal(false))
+	})
+
+	It("requires a password", func() {
+		hash, err := crypto.HashPassword(nil)
+		Expect(hash).To(Equal(""))
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("PasswordHasher", func() {
+	algorithms := []crypto.PasswordAlgorithm{crypto.PasswordArgon2id, crypto.PasswordBcrypt}
+
+	It("produces salted hashes that verify", func() {
+		for _, algorithm := range algorithms {
+			ph := testPasswordHasher(algorithm)
+
+			hash1, err := ph.Hash([]byte("hunter2"))
+			Expect(err).To(BeNil())
+			hash2, err := ph.Hash([]byte("hunter2"))
+			Expect(err).To(BeNil())
+			Expect(hash1).NotTo(Equal(hash2))
+
+			Expect(ph.Verify([]byte("hunter2"), hash1)).To(Succeed())
+			Expect(ph.Verify([]byte("hunter3"), hash1)).To(Equal(crypto.ErrPasswordMismatch), algorithm.String())
+			Expect(ph.NeedsRehash(hash1)).To(Equal(false))
+		}
+	})
+
+	It("produces PHC-format argon2id hashes and bcrypt hashes", func() {
+		hash, err := testPasswordHasher(crypto.PasswordArgon2id).Hash([]byte("hunter2"))
+		Expect(err).To(BeNil())
+		Expect(hash).To(HavePrefix("$argon2id$v=19$m=64,t=1,p=1$"))
+		Expect(strings.Split(hash, "$")).To(HaveLen(6))
+
+		hash, err = testPasswordHasher(crypto.PasswordBcrypt).Hash([]byte("hunter2"))
+		Expect(err).To(BeNil())
+		Expect(hash).To(HavePrefix("$2a$04$"))
+	})
+
+	It("verifies hashes produced elsewhere", func() {
+		// the argon2 reference implementation's test vector for "password" with the salt "somesalt"
+		Expect(crypto.VerifyPassword([]byte("password"),
+			"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc")).To(Succeed())
+
+		// OpenBSD's bcrypt test vector for "U*U"
+		Expect(crypto.VerifyPassword([]byte("U*U"), "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW")).To(Succeed())
+	})
+
+	It("verifies hashes produced with any supported algorithm and costs", func() {
+		bcryptHash, err := testPasswordHasher(crypto.PasswordBcrypt).Hash([]byte("hunter2"))
+		Expect(err).To(BeNil())
+
+		Expect(crypto.VerifyPassword([]byte("hunter2"), bcryptHash)).To(Succeed())
+		Expect(crypto.VerifyPassword([]byte("hunter3"), bcryptHash)).To(Equal(crypto.ErrPasswordMismatch))
+	})
+
+	It("reports hashes that need to be rehashed", func() {
+		ph := testPasswordHasher(crypto.PasswordArgon2id)
+		hash, err := ph.Hash([]byte("hunter2"))
+		Expect(err).To(BeNil())
+
+		bcryptHash, err := testPasswordHasher(crypto.PasswordBcrypt).Hash([]byte("hunter2"))
+		Expect(err).To(BeNil())
+
+		Expect(ph.NeedsRehash(hash)).To(Equal(false))
+		Expect(ph.NeedsRehash(bcryptHash)).To(Equal(true))
+		Expect(ph.NeedsRehash("not a hash")).To(Equal(true))
+		Expect(crypto.NeedsRehash(hash)).To(Equal(true))
+
+		stronger := testPasswordHasher(crypto.PasswordArgon2id)
+		stronger.Iterations = 2
+		Expect(stronger.NeedsRehash(hash)).To(Equal(true))
+
+		stronger = testPasswordHasher(crypto.PasswordBcrypt)
+		stronger.BcryptCost = 5
+		Expect(stronger.NeedsRehash(bcryptHash)).To(Equal(true))
+		Expect(stronger.NeedsRehash(hash)).To(Equal(true))
+	})
+
+	It("rejects malformed hashes", func() {
+		ph := testPasswordHasher(crypto.PasswordArgon2id)
+
+		for _, hash := range []string{
+			"",
+			"hunter2",
+			"$argon2i$v=19$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$argon2id$v=16$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$argon2id$v=19$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$argon2id$v=19$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$MDEy",
+			"$argon2id$v=19$m=64,t=100000,p=1$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZg",
+			"$2a$04$tooshort",
+		} {
+			err := ph.Verify([]byte("hunter2"), hash)
+			Expect(err).NotTo(BeNil(), hash)
+			Expect(err).NotTo(Equal(crypto.ErrPasswordMismatch), hash)
+		}
+	})
+
+	It("rejects invalid costs and algorithms", func() {
+		ph := testPasswordHasher(crypto.PasswordArgon2id)
+		ph.Parallelism = 0
+		_, err := ph.Hash([]byte("hunter2"))
+		Expect(err).NotTo(BeNil())
+
+		// costs that Verify would reject
+		ph = testPasswordHasher(crypto.PasswordArgon2id)
+		ph.Memory = 256*1024 + 1
+		_, err = ph.Hash([]byte("hunter2"))
+		Expect(err).NotTo(BeNil())
+
+		ph = testPasswordHasher(crypto.PasswordArgon2id)
+		ph.Parallelism = 17
+		_, err = ph.Hash([]byte("hunter2"))
+		Expect(err).NotTo(BeNil())
+
+		ph = testPasswordHasher(crypto.PasswordAlgorithm(99))
+		_, err = ph.Hash([]byte("hunter2"))
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,130 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// phcString is a hash, or a set of KDF parameters, in the PHC string format
+// (https://github.com/P-H-C/phc-string-format):
+//
+//	$<id>[$v=<version>][$<param>=<value>(,<param>=<value>)*][$<salt>[$<hash>]]
+//
+// The salt and hash are base64-encoded without padding.
+type phcString struct {
+	id      string
+	version string
+	params  [][2]string
+	salt    []byte
+	hash    []byte
+}
+
+func (p *phcString) String() string {
+
+	var b strings.Builder
+
+	b.WriteString("$")
+	b.WriteString(p.id)
+
+	if p.version != "" {
+		b.WriteString("$v=")
+		b.WriteString(p.version)
+	}
+
+	if len(p.params) > 0 {
+		b.WriteString("$")
+		for i, param := range p.params {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(param[0])
+			b.WriteString("=")
+			b.WriteString(param[1])
+		}
+	}
+
+	if p.salt != nil {
+		b.WriteString("$")
+		b.WriteString(base64.RawStdEncoding.EncodeToString(p.salt))
+
+		if p.hash != nil {
+			b.WriteString("$")
+			b.WriteString(base64.RawStdEncoding.EncodeToString(p.hash))
+		}
+	}
+
+	return b.String()
+}
+
+func parsePHCString(s string) (*phcString, error) {
+
+	fields := strings.Split(s, "$")
+	if len(fields) < 2 || fields[0] != "" || fields[1] == "" {
+		return nil, errors.New("malformed PHC string")
+	}
+
+	p := &phcString{id: fields[1]}
+	fields = fields[2:]
+
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "v=") {
+		p.version = strings.TrimPrefix(fields[0], "v=")
+		fields = fields[1:]
+	}
+
+	if len(fields) > 0 && strings.Contains(fields[0], "=") {
+		for _, param := range strings.Split(fields[0], ",") {
+			nameAndValue := strings.SplitN(param, "=", 2)
+			if len(nameAndValue) != 2 || nameAndValue[0] == "" {
+				return nil, fmt.Errorf("malformed PHC parameter %q", param)
+			}
+			p.params = append(p.params, [2]string{nameAndValue[0], nameAndValue[1]})
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) > 2 {
+		return nil, errors.New("malformed PHC string")
+	}
+
+	var err error
+
+	if len(fields) > 0 {
+		if p.salt, err = base64.RawStdEncoding.DecodeString(fields[0]); err != nil {
+			return nil, fmt.Errorf("malformed PHC salt: %v", err)
+		}
+	}
+
+	if len(fields) > 1 {
+		if p.hash, err = base64.RawStdEncoding.DecodeString(fields[1]); err != nil {
+			return nil, fmt.Errorf("malformed PHC hash: %v", err)
+		}
+	}
+
+	return p, nil
+}
+
+// uintParam returns the named parameter, which must be present and within [min, max].
+func (p *phcString) uintParam(name string, min, max uint64) (uint64, error) {
+
+	for _, param := range p.params {
+		if param[0] != name {
+			continue
+		}
+
+		value, err := strconv.ParseUint(param[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("malformed %s parameter: %v", name, err)
+		}
+
+		if value < min || value > max {
+			return 0, fmt.Errorf("%s parameter %d is out of range [%d, %d]", name, value, min, max)
+		}
+
+		return value, nil
+	}
+
+	return 0, fmt.Errorf("missing %s parameter", name)
+}
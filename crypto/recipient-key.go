@@ -0,0 +1,226 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// RecipientKey is an X25519 private key that decrypts data encrypted to its RecipientPublicKey (see
+// EncryptToRecipients). Unlike an AES256Key, the public key can be shared freely: anyone can encrypt to it, but only
+// the holder of the RecipientKey can decrypt.
+//
+// RecipientKeys are serialized as PEM-encoded PKCS #8; RecipientPublicKeys are serialized as the base64-encoded raw
+// 32-byte public key, which is short enough to pass on a command line.
+type RecipientKey struct {
+	private *ecdh.PrivateKey
+}
+
+// RecipientPublicKey is the public key that data is encrypted to (see RecipientKey).
+type RecipientPublicKey struct {
+	public *ecdh.PublicKey
+}
+
+// NewRecipientKey returns a new, randomly generated RecipientKey.
+func NewRecipientKey() (*RecipientKey, error) {
+
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecipientKey{private: private}, nil
+}
+
+// Public returns the key's RecipientPublicKey.
+func (key *RecipientKey) Public() *RecipientPublicKey {
+	return &RecipientPublicKey{public: key.private.PublicKey()}
+}
+
+// MarshalPEM returns the key as a PEM-encoded PKCS #8 private key.
+func (key *RecipientKey) MarshalPEM() ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to marshal nil key")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(der)
+
+	return pem.EncodeToMemory(&pem.Block{Type: signingKeyPEMType, Bytes: der}), nil
+}
+
+// ParseRecipientKeyPEM parses a PEM-encoded PKCS #8 X25519 private key (e.g. from RecipientKey.MarshalPEM).
+func ParseRecipientKeyPEM(pemBytes []byte) (*RecipientKey, error) {
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != signingKeyPEMType {
+		return nil, fmt.Errorf("expected a PEM-encoded %q block", signingKeyPEMType)
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	x25519Key, ok := private.(*ecdh.PrivateKey)
+	if !ok || x25519Key.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("expected an X25519 private key, got %T", private)
+	}
+
+	return &RecipientKey{private: x25519Key}, nil
+}
+
+// WritePEMFile writes the key to the file as PEM, readable only by the owner.
+func (key *RecipientKey) WritePEMFile(path string) error {
+
+	pemBytes, err := key.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(pemBytes)
+
+	return writePrivateFile(path, pemBytes)
+}
+
+// ReadRecipientKeyPEMFile reads a PEM-encoded recipient key from the file (e.g. from RecipientKey.WritePEMFile).
+func ReadRecipientKeyPEMFile(path string) (*RecipientKey, error) {
+
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(pemBytes)
+
+	return ParseRecipientKeyPEM(pemBytes)
+}
+
+// NewRecipientPublicKeyFromBase64 loads the base64-encoded public key (e.g. from RecipientPublicKey.ToBase64).
+func NewRecipientPublicKeyFromBase64(base64Key string) (*RecipientPublicKey, error) {
+
+	if base64Key == "" {
+		return nil, errors.New("zero-value base64 string")
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(base64Key)
+	if err != nil {
+		return nil, err
+	}
+
+	public, err := ecdh.X25519().NewPublicKey(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecipientPublicKey{public: public}, nil
+}
+
+// ToBase64 converts the public key to a base64-encoded string.
+func (key *RecipientPublicKey) ToBase64() string {
+
+	if key == nil {
+		return ""
+	}
+
+	return base64.StdEncoding.EncodeToString(key.public.Bytes())
+}
+
+// A data key is wrapped for each recipient as a stanza: an ephemeral X25519 public key, followed by the data key
+// sealed with AES-256-GCM under a key derived (with HKDF-SHA256) from the shared secret of the ephemeral and
+// recipient keys. Each wrapping key is used once, so the nonce is fixed. Stanzas do not identify their recipient; a
+// RecipientKey tries each in turn.
+
+const recipientHKDFInfo = "go-util-helpers x25519 recipient"
+
+const recipientStanzaLength = 32 + AES256KeyLengthInBytes + streamTagSize
+
+// maxRecipients is the number of stanzas that fit in a header section.
+const maxRecipients = maxSectionLength / recipientStanzaLength
+
+func recipientWrappingKey(shared, ephemeralPublic, recipientPublic []byte) (*AES256Key, error) {
+
+	salt := append(append([]byte{}, ephemeralPublic...), recipientPublic...)
+
+	key := &AES256Key{}
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(recipientHKDFInfo)), key[:]); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// wrapForRecipient returns the stanza that wraps the data key for the recipient.
+func wrapForRecipient(dataKey *AES256Key, recipient *RecipientPublicKey) ([]byte, error) {
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := ephemeral.ECDH(recipient.public)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(shared)
+
+	ephemeralPublic := ephemeral.PublicKey().Bytes()
+
+	wrappingKey, err := recipientWrappingKey(shared, ephemeralPublic, recipient.public.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer wrappingKey.Destroy()
+
+	aead, err := newGCM(wrappingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(ephemeralPublic, make([]byte, aead.NonceSize()), dataKey[:], nil), nil
+}
+
+// unwrapStanza returns the data key wrapped in the stanza, if it was wrapped for this key.
+func (key *RecipientKey) unwrapStanza(stanza []byte) (*AES256Key, error) {
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(stanza[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := key.private.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(shared)
+
+	wrappingKey, err := recipientWrappingKey(shared, stanza[:32], key.private.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer wrappingKey.Destroy()
+
+	aead, err := newGCM(wrappingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyBytes, err := aead.Open(nil, make([]byte, aead.NonceSize()), stanza[32:], nil)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(keyBytes)
+
+	return newAESKeyFromBytes(keyBytes)
+}
@@ -0,0 +1,122 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// EncryptToRecipients encrypts the plaintext with a new, random data key that is wrapped for each of the recipients,
+// and returns the result; any one of the matching RecipientKeys can decrypt it (see DecryptWithRecipientKey). The
+// additional data may be nil (see EncryptWithAAD).
+func EncryptToRecipients(plaintext []byte, additionalData []byte, recipients ...*RecipientPublicKey) ([]byte, error) {
+
+	kek, err := newRecipientsKEK(recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	return EnvelopeEncryptWithAAD(plaintext, additionalData, kek)
+}
+
+// DecryptWithRecipientKey decrypts the ciphertext (e.g. from a previous call to EncryptToRecipients) with the
+// recipient key, and returns the result.
+func DecryptWithRecipientKey(ciphertext []byte, additionalData []byte, key *RecipientKey) ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to decrypt with nil key")
+	}
+
+	return EnvelopeDecryptWithAAD(ciphertext, additionalData, key)
+}
+
+// NewRecipientsEncryptingWriter is like NewEncryptingWriterWithAAD, but encrypts to the recipients (see
+// EncryptToRecipients). Use NewRecipientDecryptingReader to decrypt the result.
+func NewRecipientsEncryptingWriter(w io.Writer, additionalData []byte, recipients ...*RecipientPublicKey) (io.WriteCloser, error) {
+
+	kek, err := newRecipientsKEK(recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEnvelopeEncryptingWriter(w, additionalData, kek)
+}
+
+// NewRecipientDecryptingReader is like NewDecryptingReaderWithAAD, but decrypts a stream encrypted to the recipient
+// key (see NewRecipientsEncryptingWriter).
+func NewRecipientDecryptingReader(r io.Reader, additionalData []byte, key *RecipientKey) (io.Reader, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to decrypt with nil key")
+	}
+
+	return NewEnvelopeDecryptingReader(r, additionalData, key)
+}
+
+// recipientsKEK is a KeyEncryptionKeyProvider that wraps data keys for a set of recipients; it cannot unwrap them.
+type recipientsKEK []*RecipientPublicKey
+
+func newRecipientsKEK(recipients []*RecipientPublicKey) (recipientsKEK, error) {
+
+	if len(recipients) == 0 {
+		return nil, errors.New("at least one recipient is required")
+	}
+
+	if len(recipients) > maxRecipients {
+		return nil, fmt.Errorf("too many recipients (%d); the maximum is %d", len(recipients), maxRecipients)
+	}
+
+	for _, recipient := range recipients {
+		if recipient == nil {
+			return nil, errors.New("tried to encrypt to nil recipient")
+		}
+	}
+
+	return recipientsKEK(recipients), nil
+}
+
+func (recipients recipientsKEK) WrapKey(dataKey *AES256Key) ([]byte, error) {
+
+	wrappedKey := make([]byte, 0, len(recipients)*recipientStanzaLength)
+
+	for _, recipient := range recipients {
+		stanza, err := wrapForRecipient(dataKey, recipient)
+		if err != nil {
+			return nil, err
+		}
+		wrappedKey = append(wrappedKey, stanza...)
+	}
+
+	return wrappedKey, nil
+}
+
+func (recipients recipientsKEK) UnwrapKey(wrappedKey []byte) (*AES256Key, error) {
+	return nil, errors.New("a recipient key is required to unwrap the data key")
+}
+
+// WrapKey wraps the data key for the key's public key, so that a RecipientKey can also be used as a
+// KeyEncryptionKeyProvider (see EnvelopeEncrypt).
+func (key *RecipientKey) WrapKey(dataKey *AES256Key) ([]byte, error) {
+
+	if dataKey == nil {
+		return nil, errors.New("tried to wrap nil key")
+	}
+
+	return wrapForRecipient(dataKey, key.Public())
+}
+
+// UnwrapKey unwraps a data key that was wrapped for the key, among others (e.g. by EncryptToRecipients).
+func (key *RecipientKey) UnwrapKey(wrappedKey []byte) (*AES256Key, error) {
+
+	if len(wrappedKey) == 0 || len(wrappedKey)%recipientStanzaLength != 0 {
+		return nil, errors.New("malformed recipient stanzas")
+	}
+
+	for i := 0; i < len(wrappedKey); i += recipientStanzaLength {
+		if dataKey, err := key.unwrapStanza(wrappedKey[i : i+recipientStanzaLength]); err == nil {
+			return dataKey, nil
+		}
+	}
+
+	return nil, errors.New("ciphertext was not encrypted to this recipient key")
+}
@@ -0,0 +1,132 @@
+package crypto_test
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EncryptToRecipients", func() {
+	var alice, bob, eve *crypto.RecipientKey
+
+	BeforeEach(func() {
+		var err error
+		alice, err = crypto.NewRecipientKey()
+		Expect(err).To(BeNil())
+		bob, err = crypto.NewRecipientKey()
+		Expect(err).To(BeNil())
+		eve, err = crypto.NewRecipientKey()
+		Expect(err).To(BeNil())
+	})
+
+	It("can be decrypted by any recipient, and only by recipients", func() {
+		ciphertext, err := crypto.EncryptToRecipients([]byte("test"), nil, alice.Public(), bob.Public())
+		Expect(err).To(BeNil())
+
+		for _, key := range []*crypto.RecipientKey{alice, bob} {
+			plaintext, err := crypto.DecryptWithRecipientKey(ciphertext, nil, key)
+			Expect(err).To(BeNil())
+			Expect(plaintext).To(Equal([]byte("test")))
+		}
+
+		plaintext, err := crypto.DecryptWithRecipientKey(ciphertext, nil, eve)
+		Expect(plaintext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("binds the ciphertext to the additional data", func() {
+		ciphertext, err := crypto.EncryptToRecipients([]byte("test"), []byte("release-1.2.3"), alice.Public())
+		Expect(err).To(BeNil())
+
+		plaintext, err := crypto.DecryptWithRecipientKey(ciphertext, []byte("release-1.2.3"), alice)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+
+		_, err = crypto.DecryptWithRecipientKey(ciphertext, []byte("release-1.2.4"), alice)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("encrypts streams to recipients", func() {
+		plaintext := patternedBytes(2*crypto.StreamChunkSize + 3)
+
+		var buf bytes.Buffer
+		w, err := crypto.NewRecipientsEncryptingWriter(&buf, nil, alice.Public(), bob.Public())
+		Expect(err).To(BeNil())
+		_, err = w.Write(plaintext)
+		Expect(err).To(BeNil())
+		Expect(w.Close()).To(Succeed())
+
+		r, err := crypto.NewRecipientDecryptingReader(bytes.NewReader(buf.Bytes()), nil, bob)
+		Expect(err).To(BeNil())
+		plaintext2, err := ioutil.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+
+		r, err = crypto.NewRecipientDecryptingReader(bytes.NewReader(buf.Bytes()), nil, eve)
+		Expect(r).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("detects a modified recipient stanza", func() {
+		ciphertext, err := crypto.EncryptToRecipients([]byte("test"), nil, alice.Public())
+		Expect(err).To(BeNil())
+
+		// whitebox: the stanza follows the 15-byte fixed header and its 2-byte length
+		ciphertext[17+40] ^= 1
+
+		_, err = crypto.DecryptWithRecipientKey(ciphertext, nil, alice)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("is not interchangeable with other envelope providers", func() {
+		kek, err := crypto.NewLocalKEKProvider(&fixedKey)
+		Expect(err).To(BeNil())
+
+		ciphertext, err := crypto.EnvelopeEncrypt([]byte("test"), kek)
+		Expect(err).To(BeNil())
+
+		_, err = crypto.DecryptWithRecipientKey(ciphertext, nil, alice)
+		Expect(err).NotTo(BeNil())
+
+		ciphertext, err = crypto.EncryptToRecipients([]byte("test"), nil, alice.Public())
+		Expect(err).To(BeNil())
+
+		_, err = crypto.EnvelopeDecrypt(ciphertext, kek)
+		Expect(err).NotTo(BeNil())
+
+		// a RecipientKey is itself a KeyEncryptionKeyProvider
+		plaintext, err := crypto.EnvelopeDecrypt(ciphertext, alice)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal([]byte("test")))
+	})
+
+	It("requires valid recipients and keys", func() {
+		_, err := crypto.EncryptToRecipients([]byte("test"), nil)
+		Expect(err).NotTo(BeNil())
+
+		_, err = crypto.EncryptToRecipients([]byte("test"), nil, alice.Public(), nil)
+		Expect(err).NotTo(BeNil())
+
+		_, err = crypto.NewRecipientsEncryptingWriter(&bytes.Buffer{}, nil)
+		Expect(err).NotTo(BeNil())
+
+		tooMany := make([]*crypto.RecipientPublicKey, 1000)
+		for i := range tooMany {
+			tooMany[i] = alice.Public()
+		}
+		_, err = crypto.EncryptToRecipients([]byte("test"), nil, tooMany...)
+		Expect(err).NotTo(BeNil())
+
+		ciphertext, err := crypto.EncryptToRecipients([]byte("test"), nil, alice.Public())
+		Expect(err).To(BeNil())
+
+		_, err = crypto.DecryptWithRecipientKey(ciphertext, nil, nil)
+		Expect(err).NotTo(BeNil())
+
+		_, err = crypto.NewRecipientDecryptingReader(bytes.NewReader(ciphertext), nil, nil)
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,218 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DecryptingReaderAt decrypts byte ranges of an encrypted stream (e.g. produced by NewEncryptingWriter) that is stored
+// somewhere with random access, such as a file. As every chunk of a stream except the last holds exactly
+// StreamChunkSize bytes of plaintext, the chunks holding any range of the plaintext can be located without reading
+// the rest of the stream; a read only reads and decrypts the chunks it touches.
+//
+// Each chunk is authenticated before any of its plaintext is returned, along with its position in the stream, so a
+// modified or moved chunk results in an error from the read that touches it. The last chunk is authenticated when
+// the DecryptingReaderAt is created, so a truncated or extended stream is detected up front and Size can be trusted.
+// Compressed streams (see EncryptOptions) cannot be read at random, as the plaintext offsets are unknown.
+//
+// ReadAt may be called concurrently; Read and Seek share an offset, and may not.
+type DecryptingReaderAt struct {
+	r          io.ReaderAt
+	aead       cipher.AEAD
+	bodyOffset int64 // the offset of the first chunk
+	lastChunk  int64 // the index of the last chunk
+	size       int64 // the size of the plaintext
+
+	offset     int64 // for Read and Seek
+	buf        []byte
+	chunk      []byte // the plaintext of the chunk at chunkIndex, for Read
+	chunkIndex int64
+}
+
+// NewDecryptingReaderAt returns a DecryptingReaderAt that decrypts the encrypted stream of the provided size (in
+// bytes) read from r, with the provided key.
+func NewDecryptingReaderAt(r io.ReaderAt, size int64, key *AES256Key) (*DecryptingReaderAt, error) {
+	return NewDecryptingReaderAtWithAAD(r, size, nil, key)
+}
+
+// NewDecryptingReaderAtWithAAD is like NewDecryptingReaderAt, but the additional data must match the additional data
+// provided to NewEncryptingWriterWithAAD.
+func NewDecryptingReaderAtWithAAD(r io.ReaderAt, size int64, additionalData []byte, key *AES256Key) (*DecryptingReaderAt, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to decrypt with nil key")
+	}
+
+	return newDecryptingReaderAt(r, size, additionalData, resolveWithKey(key))
+}
+
+// newDecryptingReaderAt reads the stream header, and decrypts the stream with the key returned by resolveKey.
+func newDecryptingReaderAt(r io.ReaderAt, size int64, additionalData []byte, resolveKey keyResolver) (*DecryptingReaderAt, error) {
+
+	sr := io.NewSectionReader(r, 0, size)
+
+	h, streamKey, err := openStream(sr, additionalData, resolveKey)
+	if err != nil {
+		return nil, err
+	}
+	defer streamKey.Destroy()
+
+	if h.Flags&FlagCompressed != 0 {
+		return nil, errors.New("compressed streams cannot be read at random; use NewDecryptingReader")
+	}
+
+	aead, err := newAEAD(h.Cipher, streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyOffset, err := sr.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	// the last chunk is always short, so the remainder after the full chunks is the sealed last chunk
+	const sealedChunkSize = StreamChunkSize + streamTagSize
+	body := size - bodyOffset
+	fullChunks := body / sealedChunkSize
+	lastSealedSize := body % sealedChunkSize
+
+	if lastSealedSize < streamTagSize {
+		return nil, errors.New("encrypted stream is truncated")
+	}
+
+	dr := &DecryptingReaderAt{
+		r:          r,
+		aead:       aead,
+		bodyOffset: bodyOffset,
+		lastChunk:  fullChunks,
+		size:       fullChunks*StreamChunkSize + lastSealedSize - streamTagSize,
+		buf:        make([]byte, sealedChunkSize),
+		chunkIndex: -1,
+	}
+
+	if _, err := dr.openChunk(make([]byte, sealedChunkSize), dr.lastChunk); err != nil {
+		return nil, err
+	}
+
+	return dr, nil
+}
+
+// Size returns the size of the plaintext, in bytes.
+func (dr *DecryptingReaderAt) Size() int64 {
+	return dr.size
+}
+
+// openChunk reads the chunk with the provided index into buf, and returns its plaintext (which reuses buf).
+func (dr *DecryptingReaderAt) openChunk(buf []byte, index int64) ([]byte, error) {
+
+	const sealedChunkSize = StreamChunkSize + streamTagSize
+
+	last := index == dr.lastChunk
+	sealed := buf[:sealedChunkSize]
+	if last {
+		sealed = buf[:dr.size-index*StreamChunkSize+streamTagSize]
+	}
+
+	// ReadAt may return io.EOF along with the final bytes of its input
+	if n, err := dr.r.ReadAt(sealed, dr.bodyOffset+index*sealedChunkSize); n < len(sealed) {
+		if err == io.EOF {
+			return nil, errors.New("encrypted stream is truncated")
+		}
+		return nil, err
+	}
+
+	nonce := make([]byte, dr.aead.NonceSize())
+	plain, err := dr.aead.Open(sealed[:0], streamNonce(nonce, uint64(index), last), sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate chunk %d of the encrypted stream: %v", index, err)
+	}
+
+	return plain, nil
+}
+
+// ReadAt implements io.ReaderAt, decrypting len(p) bytes of plaintext starting at the offset.
+func (dr *DecryptingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	var buf []byte
+	read := 0
+
+	for read < len(p) {
+		if off >= dr.size {
+			return read, io.EOF
+		}
+
+		if buf == nil {
+			buf = make([]byte, StreamChunkSize+streamTagSize)
+		}
+
+		plain, err := dr.openChunk(buf, off/StreamChunkSize)
+		if err != nil {
+			return read, err
+		}
+
+		n := copy(p[read:], plain[off%StreamChunkSize:])
+		read += n
+		off += int64(n)
+	}
+
+	return read, nil
+}
+
+// Read implements io.Reader, decrypting from the current offset (see Seek). The most recently read chunk is kept, so
+// small sequential reads do not decrypt a chunk more than once.
+func (dr *DecryptingReaderAt) Read(p []byte) (int, error) {
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if dr.offset >= dr.size {
+		return 0, io.EOF
+	}
+
+	index := dr.offset / StreamChunkSize
+	if index != dr.chunkIndex {
+		dr.chunkIndex = -1
+
+		plain, err := dr.openChunk(dr.buf, index)
+		if err != nil {
+			return 0, err
+		}
+
+		dr.chunk = plain
+		dr.chunkIndex = index
+	}
+
+	n := copy(p, dr.chunk[dr.offset%StreamChunkSize:])
+	dr.offset += int64(n)
+	return n, nil
+}
+
+// Seek implements io.Seeker, setting the offset in the plaintext for the next Read. Seeking past the end is allowed;
+// Read then returns io.EOF.
+func (dr *DecryptingReaderAt) Seek(offset int64, whence int) (int64, error) {
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += dr.offset
+	case io.SeekEnd:
+		offset += dr.size
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	dr.offset = offset
+	return offset, nil
+}
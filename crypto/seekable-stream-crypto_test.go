@@ -0,0 +1,241 @@
+package crypto_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// countingReaderAt counts the bytes read from it.
+type countingReaderAt struct {
+	r    io.ReaderAt
+	mu   sync.Mutex
+	read int
+}
+
+func (cr *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := cr.r.ReadAt(p, off)
+
+	cr.mu.Lock()
+	cr.read += n
+	cr.mu.Unlock()
+
+	return n, err
+}
+
+func newDecryptingReaderAt(ciphertext []byte, key *crypto.AES256Key) (*crypto.DecryptingReaderAt, error) {
+	return crypto.NewDecryptingReaderAt(bytes.NewReader(ciphertext), int64(len(ciphertext)), key)
+}
+
+var _ = Describe("DecryptingReaderAt", func() {
+	plaintext := patternedBytes(5*crypto.StreamChunkSize + 1234)
+	var ciphertext []byte
+
+	BeforeEach(func() {
+		ciphertext = encryptStream(plaintext, &fixedKey)
+	})
+
+	It("reports the size of the plaintext", func() {
+		for _, size := range []int{0, 1, crypto.StreamChunkSize - 1, crypto.StreamChunkSize, crypto.StreamChunkSize + 1} {
+			dr, err := newDecryptingReaderAt(encryptStream(patternedBytes(size), &fixedKey), &fixedKey)
+			Expect(err).To(BeNil())
+			Expect(dr.Size()).To(Equal(int64(size)))
+		}
+	})
+
+	It("reads byte ranges of the plaintext", func() {
+		dr, err := newDecryptingReaderAt(ciphertext, &fixedKey)
+		Expect(err).To(BeNil())
+
+		ranges := [][2]int{
+			{0, 1},
+			{0, crypto.StreamChunkSize},
+			{crypto.StreamChunkSize - 1, 2},
+			{crypto.StreamChunkSize, crypto.StreamChunkSize},
+			{3*crypto.StreamChunkSize + 100, 2*crypto.StreamChunkSize + 1000},
+			{len(plaintext) - 1, 1},
+			{0, len(plaintext)},
+		}
+
+		for _, rng := range ranges {
+			p := make([]byte, rng[1])
+			n, err := dr.ReadAt(p, int64(rng[0]))
+			Expect(err).To(BeNil(), "range %v", rng)
+			Expect(n).To(Equal(rng[1]))
+			Expect(bytes.Equal(p, plaintext[rng[0]:rng[0]+rng[1]])).To(Equal(true), "range %v", rng)
+		}
+	})
+
+	It("returns io.EOF for reads past the end", func() {
+		dr, err := newDecryptingReaderAt(ciphertext, &fixedKey)
+		Expect(err).To(BeNil())
+
+		p := make([]byte, 100)
+		n, err := dr.ReadAt(p, int64(len(plaintext)-10))
+		Expect(err).To(Equal(io.EOF))
+		Expect(n).To(Equal(10))
+		Expect(bytes.Equal(p[:n], plaintext[len(plaintext)-10:])).To(Equal(true))
+
+		n, err = dr.ReadAt(p, int64(len(plaintext)+10))
+		Expect(err).To(Equal(io.EOF))
+		Expect(n).To(Equal(0))
+
+		_, err = dr.ReadAt(p, -1)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("only reads the chunks that a read touches", func() {
+		cr := &countingReaderAt{r: bytes.NewReader(ciphertext)}
+		dr, err := crypto.NewDecryptingReaderAt(cr, int64(len(ciphertext)), &fixedKey)
+		Expect(err).To(BeNil())
+
+		cr.read = 0
+		_, err = dr.ReadAt(make([]byte, 10), 2*crypto.StreamChunkSize+5)
+		Expect(err).To(BeNil())
+		Expect(cr.read).To(Equal(crypto.StreamChunkSize + 16))
+
+		cr.read = 0
+		_, err = dr.ReadAt(make([]byte, 10), crypto.StreamChunkSize-5)
+		Expect(err).To(BeNil())
+		Expect(cr.read).To(Equal(2 * (crypto.StreamChunkSize + 16)))
+	})
+
+	It("reads and seeks", func() {
+		dr, err := newDecryptingReaderAt(ciphertext, &fixedKey)
+		Expect(err).To(BeNil())
+
+		plaintext2, err := ioutil.ReadAll(dr)
+		Expect(err).To(BeNil())
+		Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+
+		offset, err := dr.Seek(-100, io.SeekEnd)
+		Expect(err).To(BeNil())
+		Expect(offset).To(Equal(int64(len(plaintext) - 100)))
+
+		plaintext2, err = ioutil.ReadAll(dr)
+		Expect(err).To(BeNil())
+		Expect(bytes.Equal(plaintext2, plaintext[len(plaintext)-100:])).To(Equal(true))
+
+		_, err = dr.Seek(crypto.StreamChunkSize-3, io.SeekStart)
+		Expect(err).To(BeNil())
+		offset, err = dr.Seek(1, io.SeekCurrent)
+		Expect(err).To(BeNil())
+		Expect(offset).To(Equal(int64(crypto.StreamChunkSize - 2)))
+
+		p := make([]byte, 4)
+		_, err = io.ReadFull(dr, p)
+		Expect(err).To(BeNil())
+		Expect(p).To(Equal(plaintext[crypto.StreamChunkSize-2 : crypto.StreamChunkSize+2]))
+
+		_, err = dr.Seek(-1, io.SeekStart)
+		Expect(err).NotTo(BeNil())
+
+		_, err = dr.Seek(int64(len(plaintext)+1), io.SeekStart)
+		Expect(err).To(BeNil())
+		_, err = dr.Read(p)
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("supports concurrent reads", func() {
+		dr, err := newDecryptingReaderAt(ciphertext, &fixedKey)
+		Expect(err).To(BeNil())
+
+		var wg sync.WaitGroup
+		errs := make([]error, 8)
+
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				off := i * len(plaintext) / len(errs)
+				p := make([]byte, 1000)
+				if _, err := dr.ReadAt(p, int64(off)); err != nil {
+					errs[i] = err
+				} else if !bytes.Equal(p, plaintext[off:off+len(p)]) {
+					errs[i] = io.ErrUnexpectedEOF
+				}
+			}(i)
+		}
+
+		wg.Wait()
+		for _, err := range errs {
+			Expect(err).To(BeNil())
+		}
+	})
+
+	It("detects a modified chunk when it is read", func() {
+		modified := append([]byte{}, ciphertext...)
+		modified[len(modified)-2*crypto.StreamChunkSize] ^= 1
+
+		dr, err := newDecryptingReaderAt(modified, &fixedKey)
+		Expect(err).To(BeNil())
+
+		_, err = dr.ReadAt(make([]byte, 100), 0)
+		Expect(err).To(BeNil())
+
+		_, err = dr.ReadAt(make([]byte, len(plaintext)), 0)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("detects truncation and extension when created", func() {
+		sealedChunkSize := crypto.StreamChunkSize + 16
+		lengths := []int{
+			len(ciphertext) - (1234 + 16),
+			len(ciphertext) - (1234 + 16) - sealedChunkSize,
+			len(ciphertext) - 1,
+		}
+
+		for _, length := range lengths {
+			_, err := newDecryptingReaderAt(ciphertext[:length], &fixedKey)
+			Expect(err).NotTo(BeNil(), "length %d", length)
+		}
+
+		_, err := newDecryptingReaderAt(append(append([]byte{}, ciphertext...), 0), &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("binds the stream to the additional data", func() {
+		var buf bytes.Buffer
+		w, err := crypto.NewEncryptingWriterWithAAD(&buf, []byte("index-7"), &fixedKey)
+		Expect(err).To(BeNil())
+		_, err = w.Write(plaintext)
+		Expect(err).To(BeNil())
+		Expect(w.Close()).To(Succeed())
+
+		r := bytes.NewReader(buf.Bytes())
+
+		dr, err := crypto.NewDecryptingReaderAtWithAAD(r, r.Size(), []byte("index-7"), &fixedKey)
+		Expect(err).To(BeNil())
+		p := make([]byte, 10)
+		_, err = dr.ReadAt(p, 12345)
+		Expect(err).To(BeNil())
+		Expect(p).To(Equal(plaintext[12345:12355]))
+
+		_, err = crypto.NewDecryptingReaderAtWithAAD(r, r.Size(), []byte("index-8"), &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("rejects compressed streams", func() {
+		ciphertext := encryptStreamInParallel(plaintext, &fixedKey, crypto.EncryptOptions{Compression: crypto.CompressionGzip}, 2)
+
+		_, err := newDecryptingReaderAt(ciphertext, &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("fails with the wrong key", func() {
+		_, err := newDecryptingReaderAt(ciphertext, crypto.NewRandomAESKey())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires a valid key", func() {
+		dr, err := newDecryptingReaderAt(ciphertext, nil)
+		Expect(dr).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,238 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeyShare is one share of an AES256Key split with Shamir's secret sharing (see Split). Any threshold-many shares of
+// a key recombine into the key (see Combine); fewer reveal nothing about it.
+//
+// Shares are serialized (see ToBase64) with their index, the threshold, the key's ID, and a checksum, so that a
+// mistyped share, or a share of a different key, is detected rather than producing the wrong key.
+type KeyShare struct {
+	index     byte
+	threshold byte
+	keyID     KeyID
+	value     AES256Key
+}
+
+const keyShareVersion = 1
+
+// keyShareLength is the length of an encoded share: version, threshold, index, key ID, value and checksum.
+const keyShareLength = 3 + KeyIDLengthInBytes + AES256KeyLengthInBytes + keyShareChecksumLength
+
+const keyShareChecksumLength = 4
+
+// MaxKeyShares is the largest number of shares a key can be split into.
+const MaxKeyShares = 255
+
+// Split splits the key into n shares, any k of which recombine into the key (see Combine). k must be at least 2, and
+// n at least k and at most MaxKeyShares.
+//
+// Each byte of the key is the constant term of a random polynomial of degree k-1 over GF(256); share i holds the
+// value of each polynomial at x = i.
+func Split(key *AES256Key, n, k int) ([]*KeyShare, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to split nil key")
+	}
+
+	if k < 2 || k > n || n > MaxKeyShares {
+		return nil, fmt.Errorf("invalid threshold %d of %d shares: need 2 <= k <= n <= %d", k, n, MaxKeyShares)
+	}
+
+	// coefficients[i] holds the coefficient of x^(i+1) for each byte of the key
+	coefficients := make([]AES256Key, k-1)
+	for i := range coefficients {
+		if _, err := rand.Read(coefficients[i][:]); err != nil {
+			return nil, err
+		}
+	}
+	defer func() {
+		for i := range coefficients {
+			coefficients[i].Destroy()
+		}
+	}()
+
+	id := key.ID()
+	shares := make([]*KeyShare, n)
+
+	for i := range shares {
+		x := byte(i + 1)
+		share := &KeyShare{index: x, threshold: byte(k), keyID: id}
+
+		for b := range key {
+			// Horner's method, from the highest coefficient down to the key byte
+			y := byte(0)
+			for c := len(coefficients) - 1; c >= 0; c-- {
+				y = gfMul(y, x) ^ coefficients[c][b]
+			}
+			share.value[b] = gfMul(y, x) ^ key[b]
+		}
+
+		shares[i] = share
+	}
+
+	return shares, nil
+}
+
+// Combine recombines shares produced by Split into the key. It requires at least the threshold number of shares of
+// the same key, and verifies the result against the key's ID.
+func Combine(shares []*KeyShare) (*AES256Key, error) {
+
+	if len(shares) == 0 || shares[0] == nil {
+		return nil, errors.New("no shares")
+	}
+
+	threshold := int(shares[0].threshold)
+	id := shares[0].keyID
+	seen := make(map[byte]bool)
+
+	for _, share := range shares {
+		if share == nil {
+			return nil, errors.New("nil share")
+		}
+		if share.keyID != id || int(share.threshold) != threshold {
+			return nil, errors.New("shares are from different keys or splits")
+		}
+		if seen[share.index] {
+			return nil, fmt.Errorf("duplicate share %d", share.index)
+		}
+		seen[share.index] = true
+	}
+
+	if len(shares) < threshold {
+		return nil, fmt.Errorf("need %d shares, have %d", threshold, len(shares))
+	}
+
+	shares = shares[:threshold]
+	key := &AES256Key{}
+
+	// Lagrange interpolation at x = 0
+	for i, share := range shares {
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				// (0 - x_j) / (x_i - x_j), where subtraction is XOR
+				basis = gfMul(basis, gfMul(other.index, gfInverse(share.index^other.index)))
+			}
+		}
+
+		for b := range key {
+			key[b] ^= gfMul(share.value[b], basis)
+		}
+	}
+
+	if key.ID() != id {
+		key.Destroy()
+		return nil, errors.New("shares do not recombine into the key")
+	}
+
+	return key, nil
+}
+
+// Index returns the share's index (1 to MaxKeyShares).
+func (share *KeyShare) Index() int {
+	return int(share.index)
+}
+
+// Threshold returns the number of shares needed to recombine the key.
+func (share *KeyShare) Threshold() int {
+	return int(share.threshold)
+}
+
+// KeyID returns the ID of the key that the share is a share of.
+func (share *KeyShare) KeyID() KeyID {
+	return share.keyID
+}
+
+// ToBase64 converts the share to a base64-encoded string, including its index, threshold, key ID and a checksum.
+func (share *KeyShare) ToBase64() string {
+
+	if share == nil {
+		return ""
+	}
+
+	encoded := make([]byte, 0, keyShareLength)
+	encoded = append(encoded, keyShareVersion, share.threshold, share.index)
+	encoded = append(encoded, share.keyID[:]...)
+	encoded = append(encoded, share.value[:]...)
+
+	checksum := sha256.Sum256(encoded)
+	encoded = append(encoded, checksum[:keyShareChecksumLength]...)
+	defer zeroBytes(encoded)
+
+	return base64.StdEncoding.EncodeToString(encoded)
+}
+
+// NewKeyShareFromBase64 loads a base64-encoded share (e.g. from KeyShare.ToBase64), verifying its checksum.
+// Surrounding whitespace is ignored.
+func NewKeyShareFromBase64(base64Share string) (*KeyShare, error) {
+
+	base64Share = strings.TrimSpace(base64Share)
+	if base64Share == "" {
+		return nil, errors.New("zero-value base64 string")
+	}
+
+	encoded, err := base64.StdEncoding.DecodeString(base64Share)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(encoded)
+
+	if len(encoded) != keyShareLength {
+		return nil, fmt.Errorf("expected share length to be %d, was %d", keyShareLength, len(encoded))
+	}
+
+	body := encoded[:keyShareLength-keyShareChecksumLength]
+	checksum := sha256.Sum256(body)
+	if subtle.ConstantTimeCompare(checksum[:keyShareChecksumLength], encoded[len(body):]) != 1 {
+		return nil, errors.New("share checksum mismatch; the share is corrupt")
+	}
+
+	if body[0] != keyShareVersion {
+		return nil, fmt.Errorf("unsupported share version: %d", body[0])
+	}
+
+	share := &KeyShare{threshold: body[1], index: body[2]}
+	if share.threshold < 2 || share.index == 0 {
+		return nil, errors.New("malformed share")
+	}
+
+	copy(share.keyID[:], body[3:])
+	copy(share.value[:], body[3+KeyIDLengthInBytes:])
+
+	return share, nil
+}
+
+// gfMul multiplies in GF(2^8) with the AES polynomial x^8 + x^4 + x^3 + x + 1, in constant time (a table of
+// logarithms would leak the key through cache timing).
+func gfMul(a, b byte) byte {
+
+	var product byte
+	for i := 0; i < 8; i++ {
+		product ^= -(b & 1) & a
+		b >>= 1
+		a = (a << 1) ^ (-(a >> 7) & 0x1b)
+	}
+
+	return product
+}
+
+// gfInverse returns the multiplicative inverse of a (which must not be zero) in GF(2^8), as a^254.
+func gfInverse(a byte) byte {
+
+	result := byte(1)
+	for i := 0; i < 7; i++ {
+		a = gfMul(a, a)
+		result = gfMul(result, a)
+	}
+
+	return result
+}
@@ -0,0 +1,134 @@
+package crypto_test
+
+import (
+	"encoding/base64"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Shamir secret sharing", func() {
+	It("recombines the key from any threshold-many shares", func() {
+		shares, err := crypto.Split(&fixedKey, 5, 3)
+		Expect(err).To(BeNil())
+		Expect(shares).To(HaveLen(5))
+
+		for i, share := range shares {
+			Expect(share.Index()).To(Equal(i + 1))
+			Expect(share.Threshold()).To(Equal(3))
+			Expect(share.KeyID()).To(Equal(fixedKey.ID()))
+		}
+
+		for a := 0; a < 5; a++ {
+			for b := a + 1; b < 5; b++ {
+				for c := b + 1; c < 5; c++ {
+					key, err := crypto.Combine([]*crypto.KeyShare{shares[c], shares[a], shares[b]})
+					Expect(err).To(BeNil())
+					Expect(*key).To(Equal(fixedKey))
+				}
+			}
+		}
+
+		key, err := crypto.Combine(shares)
+		Expect(err).To(BeNil())
+		Expect(*key).To(Equal(fixedKey))
+	})
+
+	It("produces different shares for each split", func() {
+		shares1, err := crypto.Split(&fixedKey, 2, 2)
+		Expect(err).To(BeNil())
+		shares2, err := crypto.Split(&fixedKey, 2, 2)
+		Expect(err).To(BeNil())
+
+		Expect(shares1[0].ToBase64()).NotTo(Equal(shares2[0].ToBase64()))
+
+		// shares of different splits of the same key do not recombine
+		_, err = crypto.Combine([]*crypto.KeyShare{shares1[0], shares2[1]})
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("supports the largest number of shares", func() {
+		key := crypto.NewRandomAESKey()
+		shares, err := crypto.Split(key, crypto.MaxKeyShares, crypto.MaxKeyShares)
+		Expect(err).To(BeNil())
+
+		combined, err := crypto.Combine(shares)
+		Expect(err).To(BeNil())
+		Expect(crypto.Equal(combined, key)).To(Equal(true))
+	})
+
+	It("requires the threshold number of distinct shares of the same key", func() {
+		shares, err := crypto.Split(&fixedKey, 5, 3)
+		Expect(err).To(BeNil())
+
+		otherShares, err := crypto.Split(crypto.NewRandomAESKey(), 5, 3)
+		Expect(err).To(BeNil())
+
+		for _, s := range [][]*crypto.KeyShare{
+			nil,
+			shares[:2],
+			{shares[0], shares[1], shares[1]},
+			{shares[0], shares[1], otherShares[2]},
+			{shares[0], shares[1], nil},
+		} {
+			key, err := crypto.Combine(s)
+			Expect(key).To(BeNil())
+			Expect(err).NotTo(BeNil())
+		}
+	})
+
+	It("rejects invalid thresholds", func() {
+		for _, nk := range [][2]int{{5, 1}, {5, 0}, {2, 3}, {256, 3}} {
+			shares, err := crypto.Split(&fixedKey, nk[0], nk[1])
+			Expect(shares).To(BeNil())
+			Expect(err).NotTo(BeNil())
+		}
+
+		_, err := crypto.Split(nil, 5, 3)
+		Expect(err).NotTo(BeNil())
+	})
+
+	Describe("KeyShare", func() {
+		It("round-trips through base64", func() {
+			shares, err := crypto.Split(&fixedKey, 3, 2)
+			Expect(err).To(BeNil())
+
+			var parsed []*crypto.KeyShare
+			for _, share := range shares[1:] {
+				p, err := crypto.NewKeyShareFromBase64(share.ToBase64() + "\n")
+				Expect(err).To(BeNil())
+				Expect(p.Index()).To(Equal(share.Index()))
+				Expect(p.Threshold()).To(Equal(2))
+				Expect(p.KeyID()).To(Equal(fixedKey.ID()))
+				parsed = append(parsed, p)
+			}
+
+			key, err := crypto.Combine(parsed)
+			Expect(err).To(BeNil())
+			Expect(*key).To(Equal(fixedKey))
+		})
+
+		It("detects corrupt shares", func() {
+			shares, err := crypto.Split(&fixedKey, 3, 2)
+			Expect(err).To(BeNil())
+
+			encoded, err := base64.StdEncoding.DecodeString(shares[0].ToBase64())
+			Expect(err).To(BeNil())
+
+			for i := range encoded {
+				corrupt := append([]byte{}, encoded...)
+				corrupt[i] ^= 0x01
+
+				share, err := crypto.NewKeyShareFromBase64(base64.StdEncoding.EncodeToString(corrupt))
+				Expect(share).To(BeNil())
+				Expect(err).NotTo(BeNil())
+			}
+
+			for _, s := range []string{"", "not base64", base64.StdEncoding.EncodeToString(encoded[:40])} {
+				_, err := crypto.NewKeyShareFromBase64(s)
+				Expect(err).NotTo(BeNil())
+			}
+		})
+	})
+})
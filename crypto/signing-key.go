@@ -0,0 +1,450 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// SigningAlgorithm identifies a public-key signature algorithm.
+type SigningAlgorithm int
+
+const (
+	// Ed25519 is EdDSA over Curve25519 (RFC 8032); it is the recommended algorithm.
+	Ed25519 SigningAlgorithm = iota + 1
+	// ECDSAP256 is ECDSA over NIST P-256 with SHA-256, for interoperability where Ed25519 is not supported.
+	// Signatures are ASN.1 DER-encoded.
+	ECDSAP256
+)
+
+// String returns the name of the algorithm.
+func (a SigningAlgorithm) String() string {
+	switch a {
+	case Ed25519:
+		return "Ed25519"
+	case ECDSAP256:
+		return "ECDSA-P256"
+	default:
+		return fmt.Sprintf("unknown signing algorithm (%d)", int(a))
+	}
+}
+
+// ParseSigningAlgorithm returns the SigningAlgorithm named by s (e.g. "ed25519"), case-insensitively.
+func ParseSigningAlgorithm(s string) (SigningAlgorithm, error) {
+
+	for _, a := range []SigningAlgorithm{Ed25519, ECDSAP256} {
+		if strings.EqualFold(s, a.String()) {
+			return a, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown signing algorithm %q", s)
+}
+
+const (
+	signingKeyPEMType   = "PRIVATE KEY"
+	verifyingKeyPEMType = "PUBLIC KEY"
+)
+
+// SigningKey is a private key that signs messages; anyone with the matching VerifyingKey (see Public) can verify the
+// signatures without being able to produce them. SigningKeys are serialized as PKCS #8, and VerifyingKeys as PKIX, so
+// that they interoperate with e.g. openssl.
+type SigningKey struct {
+	ed25519 ed25519.PrivateKey
+	ecdsa   *ecdsa.PrivateKey
+}
+
+// VerifyingKey is the public key that verifies a SigningKey's signatures.
+type VerifyingKey struct {
+	ed25519 ed25519.PublicKey
+	ecdsa   *ecdsa.PublicKey
+}
+
+// NewSigningKey returns a new, randomly generated signing key for the algorithm.
+func NewSigningKey(algorithm SigningAlgorithm) (*SigningKey, error) {
+
+	switch algorithm {
+	case Ed25519:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &SigningKey{ed25519: private}, nil
+
+	case ECDSAP256:
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &SigningKey{ecdsa: private}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %v", algorithm)
+	}
+}
+
+// Algorithm returns the key's algorithm.
+func (key *SigningKey) Algorithm() SigningAlgorithm {
+	if key.ecdsa != nil {
+		return ECDSAP256
+	}
+	return Ed25519
+}
+
+// Public returns the key's VerifyingKey.
+func (key *SigningKey) Public() *VerifyingKey {
+	if key.ecdsa != nil {
+		return &VerifyingKey{ecdsa: &key.ecdsa.PublicKey}
+	}
+	return &VerifyingKey{ed25519: key.ed25519.Public().(ed25519.PublicKey)}
+}
+
+// Sign signs the message and returns the signature.
+func (key *SigningKey) Sign(message []byte) ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to sign with nil key")
+	}
+
+	if key.ed25519 == nil && key.ecdsa == nil {
+		return nil, errors.New("tried to sign with empty key")
+	}
+
+	if key.ecdsa != nil {
+		digest := sha256.Sum256(message)
+		return ecdsa.SignASN1(rand.Reader, key.ecdsa, digest[:])
+	}
+
+	return ed25519.Sign(key.ed25519, message), nil
+}
+
+// Algorithm returns the key's algorithm.
+func (key *VerifyingKey) Algorithm() SigningAlgorithm {
+	if key.ecdsa != nil {
+		return ECDSAP256
+	}
+	return Ed25519
+}
+
+// Verify checks that the signature (e.g. from a previous call to SigningKey.Sign) is a valid signature of the
+// message by the matching SigningKey, and returns an error if it is not.
+func (key *VerifyingKey) Verify(message []byte, signature []byte) error {
+
+	if key == nil {
+		return errors.New("tried to verify with nil key")
+	}
+
+	if key.ed25519 == nil && key.ecdsa == nil {
+		return errors.New("tried to verify with empty key")
+	}
+
+	var valid bool
+
+	if key.ecdsa != nil {
+		digest := sha256.Sum256(message)
+		valid = ecdsa.VerifyASN1(key.ecdsa, digest[:], signature)
+	} else {
+		valid = ed25519.Verify(key.ed25519, message, signature)
+	}
+
+	if !valid {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+// SignReader signs the message read from r, which is hashed as it is read rather than held in memory, and returns
+// the signature. Verify it with VerifyingKey.VerifyReader. ECDSA signatures are the same as those made by Sign;
+// Ed25519 signatures use the pre-hashed variant, Ed25519ph (RFC 8032), and are not interchangeable with Sign's.
+func (key *SigningKey) SignReader(r io.Reader) ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to sign with nil key")
+	}
+
+	if key.ed25519 == nil && key.ecdsa == nil {
+		return nil, errors.New("tried to sign with empty key")
+	}
+
+	digest, err := key.Public().digest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.ecdsa != nil {
+		return ecdsa.SignASN1(rand.Reader, key.ecdsa, digest)
+	}
+
+	return key.ed25519.Sign(nil, digest, &ed25519.Options{Hash: stdcrypto.SHA512})
+}
+
+// VerifyReader checks that the signature (e.g. from a previous call to SigningKey.SignReader) is a valid signature
+// of the message read from r by the matching SigningKey, and returns an error if it is not.
+func (key *VerifyingKey) VerifyReader(r io.Reader, signature []byte) error {
+
+	if key == nil {
+		return errors.New("tried to verify with nil key")
+	}
+
+	if key.ed25519 == nil && key.ecdsa == nil {
+		return errors.New("tried to verify with empty key")
+	}
+
+	digest, err := key.digest(r)
+	if err != nil {
+		return err
+	}
+
+	if key.ecdsa != nil {
+		if !ecdsa.VerifyASN1(key.ecdsa, digest, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	if err := ed25519.VerifyWithOptions(key.ed25519, digest, signature, &ed25519.Options{Hash: stdcrypto.SHA512}); err != nil {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+// digest hashes the message read from r with the hash that the key's algorithm signs: SHA-256 for ECDSA, and
+// SHA-512 for Ed25519ph.
+func (key *VerifyingKey) digest(r io.Reader) ([]byte, error) {
+
+	h := sha512.New()
+	if key.ecdsa != nil {
+		h = sha256.New()
+	}
+
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// MarshalPEM returns the key as a PEM-encoded PKCS #8 private key.
+func (key *SigningKey) MarshalPEM() ([]byte, error) {
+
+	der, err := key.marshalPKCS8()
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(der)
+
+	return pem.EncodeToMemory(&pem.Block{Type: signingKeyPEMType, Bytes: der}), nil
+}
+
+// ToBase64 converts the key to a base64-encoded PKCS #8 private key.
+func (key *SigningKey) ToBase64() (string, error) {
+
+	der, err := key.marshalPKCS8()
+	if err != nil {
+		return "", err
+	}
+	defer zeroBytes(der)
+
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+func (key *SigningKey) marshalPKCS8() ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to marshal nil key")
+	}
+
+	if key.ecdsa != nil {
+		return x509.MarshalPKCS8PrivateKey(key.ecdsa)
+	}
+
+	return x509.MarshalPKCS8PrivateKey(key.ed25519)
+}
+
+// ParseSigningKeyPEM parses a PEM-encoded PKCS #8 private key (e.g. from SigningKey.MarshalPEM).
+func ParseSigningKeyPEM(pemBytes []byte) (*SigningKey, error) {
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != signingKeyPEMType {
+		return nil, fmt.Errorf("expected a PEM-encoded %q block", signingKeyPEMType)
+	}
+
+	return parsePKCS8SigningKey(block.Bytes)
+}
+
+// NewSigningKeyFromBase64 parses a base64-encoded PKCS #8 private key (e.g. from SigningKey.ToBase64).
+func NewSigningKeyFromBase64(base64Key string) (*SigningKey, error) {
+
+	if base64Key == "" {
+		return nil, errors.New("zero-value base64 string")
+	}
+
+	der, err := base64.StdEncoding.DecodeString(base64Key)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(der)
+
+	return parsePKCS8SigningKey(der)
+}
+
+func parsePKCS8SigningKey(der []byte) (*SigningKey, error) {
+
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	switch private := private.(type) {
+	case ed25519.PrivateKey:
+		return &SigningKey{ed25519: private}, nil
+	case *ecdsa.PrivateKey:
+		if private.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %s", private.Curve.Params().Name)
+		}
+		return &SigningKey{ecdsa: private}, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+	}
+}
+
+// MarshalPEM returns the key as a PEM-encoded PKIX public key.
+func (key *VerifyingKey) MarshalPEM() ([]byte, error) {
+
+	der, err := key.marshalPKIX()
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: verifyingKeyPEMType, Bytes: der}), nil
+}
+
+// ToBase64 converts the key to a base64-encoded PKIX public key.
+func (key *VerifyingKey) ToBase64() (string, error) {
+
+	der, err := key.marshalPKIX()
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+func (key *VerifyingKey) marshalPKIX() ([]byte, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to marshal nil key")
+	}
+
+	if key.ecdsa != nil {
+		return x509.MarshalPKIXPublicKey(key.ecdsa)
+	}
+
+	return x509.MarshalPKIXPublicKey(key.ed25519)
+}
+
+// ParseVerifyingKeyPEM parses a PEM-encoded PKIX public key (e.g. from VerifyingKey.MarshalPEM).
+func ParseVerifyingKeyPEM(pemBytes []byte) (*VerifyingKey, error) {
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != verifyingKeyPEMType {
+		return nil, fmt.Errorf("expected a PEM-encoded %q block", verifyingKeyPEMType)
+	}
+
+	return parsePKIXVerifyingKey(block.Bytes)
+}
+
+// NewVerifyingKeyFromBase64 parses a base64-encoded PKIX public key (e.g. from VerifyingKey.ToBase64).
+func NewVerifyingKeyFromBase64(base64Key string) (*VerifyingKey, error) {
+
+	if base64Key == "" {
+		return nil, errors.New("zero-value base64 string")
+	}
+
+	der, err := base64.StdEncoding.DecodeString(base64Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePKIXVerifyingKey(der)
+}
+
+func parsePKIXVerifyingKey(der []byte) (*VerifyingKey, error) {
+
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	switch public := public.(type) {
+	case ed25519.PublicKey:
+		return &VerifyingKey{ed25519: public}, nil
+	case *ecdsa.PublicKey:
+		if public.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %s", public.Curve.Params().Name)
+		}
+		return &VerifyingKey{ecdsa: public}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+}
+
+// WritePEMFile writes the key to the file as PEM, readable only by the owner.
+func (key *SigningKey) WritePEMFile(path string) error {
+
+	pemBytes, err := key.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(pemBytes)
+
+	return writePrivateFile(path, pemBytes)
+}
+
+// ReadSigningKeyPEMFile reads a PEM-encoded signing key from the file (e.g. from SigningKey.WritePEMFile).
+func ReadSigningKeyPEMFile(path string) (*SigningKey, error) {
+
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(pemBytes)
+
+	return ParseSigningKeyPEM(pemBytes)
+}
+
+// WritePEMFile writes the key to the file as PEM.
+func (key *VerifyingKey) WritePEMFile(path string) error {
+
+	pemBytes, err := key.MarshalPEM()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, pemBytes, 0644)
+}
+
+// ReadVerifyingKeyPEMFile reads a PEM-encoded verifying key from the file (e.g. from VerifyingKey.WritePEMFile).
+func ReadVerifyingKeyPEMFile(path string) (*VerifyingKey, error) {
+
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseVerifyingKeyPEM(pemBytes)
+}
@@ -0,0 +1,161 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+// siv implements AES-SIV (RFC 5297): a deterministic, nonce-misuse resistant AEAD. The synthetic IV is a CMAC-based
+// PRF (S2V) of the additional data and the plaintext; it doubles as the authentication tag and as the CTR-mode IV.
+type siv struct {
+	mac cipher.Block
+	ctr cipher.Block
+	k1  [aes.BlockSize]byte
+	k2  [aes.BlockSize]byte
+}
+
+// newSIV returns an AES-SIV cipher for the provided CMAC and CTR keys (16, 24 or 32 bytes each).
+func newSIV(macKey, ctrKey []byte) (*siv, error) {
+
+	mac, err := aes.NewCipher(macKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ctr, err := aes.NewCipher(ctrKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &siv{mac: mac, ctr: ctr}
+
+	// CMAC subkeys (RFC 4493)
+	var l [aes.BlockSize]byte
+	mac.Encrypt(l[:], l[:])
+	s.k1 = dbl(l)
+	s.k2 = dbl(s.k1)
+
+	return s, nil
+}
+
+// dbl multiplies by x in GF(2^128), with the polynomial x^128 + x^7 + x^2 + x + 1.
+func dbl(in [aes.BlockSize]byte) [aes.BlockSize]byte {
+
+	var out [aes.BlockSize]byte
+	carry := in[0] >> 7
+
+	for i := 0; i < aes.BlockSize-1; i++ {
+		out[i] = in[i]<<1 | in[i+1]>>7
+	}
+
+	out[aes.BlockSize-1] = in[aes.BlockSize-1]<<1 ^ byte(subtle.ConstantTimeSelect(int(carry), 0x87, 0))
+	return out
+}
+
+func xorBlock(dst *[aes.BlockSize]byte, src []byte) {
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+}
+
+// cmac computes AES-CMAC (RFC 4493) of the message.
+func (s *siv) cmac(message []byte) [aes.BlockSize]byte {
+
+	var x [aes.BlockSize]byte
+
+	for len(message) > aes.BlockSize {
+		xorBlock(&x, message[:aes.BlockSize])
+		s.mac.Encrypt(x[:], x[:])
+		message = message[aes.BlockSize:]
+	}
+
+	if len(message) == aes.BlockSize {
+		xorBlock(&x, message)
+		xorBlock(&x, s.k1[:])
+	} else {
+		var last [aes.BlockSize]byte
+		copy(last[:], message)
+		last[len(message)] = 0x80
+		xorBlock(&x, last[:])
+		xorBlock(&x, s.k2[:])
+	}
+
+	s.mac.Encrypt(x[:], x[:])
+	return x
+}
+
+// s2v computes the synthetic IV of the additional data vector and the plaintext.
+func (s *siv) s2v(additionalData [][]byte, plaintext []byte) [aes.BlockSize]byte {
+
+	var zero [aes.BlockSize]byte
+	d := s.cmac(zero[:])
+
+	for _, ad := range additionalData {
+		mac := s.cmac(ad)
+		d = dbl(d)
+		xorBlock(&d, mac[:])
+	}
+
+	var t []byte
+
+	if len(plaintext) >= aes.BlockSize {
+		t = append([]byte{}, plaintext...)
+		for i := range d {
+			t[len(t)-aes.BlockSize+i] ^= d[i]
+		}
+	} else {
+		padded := dbl(d)
+		var last [aes.BlockSize]byte
+		copy(last[:], plaintext)
+		last[len(plaintext)] = 0x80
+		xorBlock(&padded, last[:])
+		t = padded[:]
+	}
+
+	return s.cmac(t)
+}
+
+func (s *siv) xorKeyStream(dst, src []byte, v [aes.BlockSize]byte) {
+
+	// the counter is the IV with the 31st and 63rd bits (from the right) cleared
+	q := v
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+
+	cipher.NewCTR(s.ctr, q[:]).XORKeyStream(dst, src)
+}
+
+// seal returns the synthetic IV followed by the ciphertext.
+func (s *siv) seal(plaintext []byte, additionalData ...[]byte) []byte {
+
+	v := s.s2v(additionalData, plaintext)
+
+	out := make([]byte, aes.BlockSize+len(plaintext))
+	copy(out, v[:])
+	s.xorKeyStream(out[aes.BlockSize:], plaintext, v)
+	return out
+}
+
+// open authenticates and decrypts the output of seal.
+func (s *siv) open(ciphertext []byte, additionalData ...[]byte) ([]byte, error) {
+
+	if len(ciphertext) < aes.BlockSize {
+		return nil, errors.New("malformed ciphertext")
+	}
+
+	var v [aes.BlockSize]byte
+	copy(v[:], ciphertext)
+
+	plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
+	s.xorKeyStream(plaintext, ciphertext[aes.BlockSize:], v)
+
+	expected := s.s2v(additionalData, plaintext)
+	if subtle.ConstantTimeCompare(expected[:], v[:]) != 1 {
+		zeroBytes(plaintext)
+		return nil, errors.New("message authentication failed")
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,142 @@
+package crypto_test
+
+import (
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("siv", func() {
+	// RFC 5297, Appendix A (AES-SIV with 128-bit CMAC and CTR keys)
+	It("matches the deterministic authenticated encryption example (A.1)", func() {
+		key := decodeHex("fffefdfc fbfaf9f8 f7f6f5f4 f3f2f1f0 f0f1f2f3 f4f5f6f7 f8f9fafb fcfdfeff")
+		ad := decodeHex("10111213 14151617 18191a1b 1c1d1e1f 20212223 24252627")
+		plaintext := decodeHex("11223344 55667788 99aabbcc ddee")
+		expected := decodeHex("85632d07 c6e8f37f 950acd32 0a2ecc93 40c02b96 90c4dc04 daef7f6a fe5c")
+
+		s, err := crypto.NewSIV(key[:16], key[16:])
+		Expect(err).To(BeNil())
+
+		ciphertext := s.Seal(plaintext, ad)
+		Expect(ciphertext).To(Equal(expected))
+
+		plaintext2, err := s.Open(ciphertext, ad)
+		Expect(err).To(BeNil())
+		Expect(plaintext2).To(Equal(plaintext))
+	})
+
+	It("matches the nonce-based authenticated encryption example (A.2)", func() {
+		key := decodeHex("7f7e7d7c 7b7a7978 77767574 73727170 40414243 44454647 48494a4b 4c4d4e4f")
+		ad1 := decodeHex("00112233 44556677 8899aabb ccddeeff deaddada deaddada ffeeddcc bbaa9988 77665544 33221100")
+		ad2 := decodeHex("10203040 50607080 90a0")
+		nonce := decodeHex("09f91102 9d74e35b d84156c5 635688c0")
+		plaintext := decodeHex("74686973 20697320 736f6d65 20706c61 696e7465 78742074 6f20656e 63727970 74207573 696e6720 5349562d 414553")
+		expected := decodeHex("7bdb6e3b 432667eb 06f4d14b ff2fbd0f cb900f2f ddbe4043 26601965 c889bf17 dba77ceb 094fa663 b7a3f748 ba8af829 ea64ad54 4a272e9c 485b62a3 fd5c0d")
+
+		s, err := crypto.NewSIV(key[:16], key[16:])
+		Expect(err).To(BeNil())
+
+		ciphertext := s.Seal(plaintext, ad1, ad2, nonce)
+		Expect(ciphertext).To(Equal(expected))
+
+		plaintext2, err := s.Open(ciphertext, ad1, ad2, nonce)
+		Expect(err).To(BeNil())
+		Expect(plaintext2).To(Equal(plaintext))
+
+		_, err = s.Open(ciphertext, ad1, ad2)
+		Expect(err).NotTo(BeNil())
+	})
+
+	// AES-SIV with 256-bit CMAC and CTR keys, as the package uses it; RFC 5297 has no examples of this key size, so
+	// the expected values were computed with OpenSSL's AES-256-SIV
+	It("matches AES-SIV with 256-bit keys", func() {
+		key := decodeHex("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f" +
+			"202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f")
+
+		s, err := crypto.NewSIV(key[:32], key[32:])
+		Expect(err).To(BeNil())
+
+		plaintext100 := make([]byte, 100)
+		for i := range plaintext100 {
+			plaintext100[i] = byte(i)
+		}
+
+		vectors := []struct {
+			plaintext      []byte
+			additionalData [][]byte
+			expected       string
+		}{
+			{[]byte("plaintext"), [][]byte{[]byte("associated data")}, "31ef3c7917d34ea5ea9b42c0482b0c22 f537740aa4cd6b7e0c"},
+			{[]byte("x"), nil, "315fc8b42454cb95e5a7eb7a7da0cb02 de"},
+			{plaintext100[:16], [][]byte{[]byte("first"), []byte("second")},
+				"ce07c33ec4a96aed804843f9b1362e27 0ff0890dec9ac2981e9e274e708c4844"},
+			{plaintext100, [][]byte{[]byte("ad")},
+				"d5dadb6bbfe04498fb126eb11ae7417e 1d5bfa26c058b5ec879e9967cadc8193 78ec828ebf3c484976b0315a357a15bc b3a4e112778469fbcdd28d4219dbcab9" +
+					"d9103127d0fee4abace60620b86ae8bc 8833f8186e315505f224ec48ccfb22c9 40d3cccf8361ef5e3e9260d15188040d 3462252d"},
+		}
+
+		for _, v := range vectors {
+			ciphertext := s.Seal(v.plaintext, v.additionalData...)
+			Expect(ciphertext).To(Equal(decodeHex(v.expected)), string(v.plaintext))
+
+			plaintext, err := s.Open(ciphertext, v.additionalData...)
+			Expect(err).To(BeNil())
+			Expect(plaintext).To(Equal(v.plaintext))
+		}
+	})
+
+	It("rejects a tampered synthetic IV or ciphertext", func() {
+		s, err := crypto.NewSIV(make([]byte, 32), make([]byte, 32))
+		Expect(err).To(BeNil())
+
+		ad := []byte("ad")
+		ciphertext := s.Seal([]byte("a plaintext that spans several AES blocks"), ad)
+
+		for i := range ciphertext {
+			for bit := uint(0); bit < 8; bit++ {
+				ciphertext[i] ^= 1 << bit
+				plaintext, err := s.Open(ciphertext, ad)
+				ciphertext[i] ^= 1 << bit
+
+				Expect(plaintext).To(BeNil())
+				Expect(err).NotTo(BeNil(), "byte %d, bit %d", i, bit)
+			}
+		}
+
+		_, err = s.Open(ciphertext[:15], ad)
+		Expect(err).NotTo(BeNil())
+
+		_, err = s.Open(ciphertext, ad)
+		Expect(err).To(BeNil())
+	})
+
+	// RFC 4493, section 4 (AES-128), and NIST SP 800-38B, appendix D.3 (AES-256)
+	It("computes CMAC", func() {
+		message := decodeHex("6bc1bee22e409f96e93d7e117393172a ae2d8a571e03ac9c9eb76fac45af8e51" +
+			"30c81c46a35ce411e5fbc1191a0a52ef f69f2445df4f9b17ad2b417be66c3710")
+
+		vectors := []struct {
+			key      string
+			length   int
+			expected string
+		}{
+			{"2b7e151628aed2a6abf7158809cf4f3c", 0, "bb1d6929e95937287fa37d129b756746"},
+			{"2b7e151628aed2a6abf7158809cf4f3c", 16, "070a16b46b4d4144f79bdd9dd04a287c"},
+			{"2b7e151628aed2a6abf7158809cf4f3c", 40, "dfa66747de9ae63030ca32611497c827"},
+			{"2b7e151628aed2a6abf7158809cf4f3c", 64, "51f0bebf7e3b9d92fc49741779363cfe"},
+			{"603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4", 0, "028962f61b7bf89efc6b551f4667d983"},
+			{"603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4", 16, "28a7023f452e8f82bd4bf28d8c37c35c"},
+			{"603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4", 40, "aaf3d8f1de5640c232f5b169b9c911e6"},
+			{"603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4", 64, "e1992190549f6ed5696a2c056c315410"},
+		}
+
+		for _, v := range vectors {
+			key := decodeHex(v.key)
+			s, err := crypto.NewSIV(key, key)
+			Expect(err).To(BeNil())
+
+			mac := s.CMAC(message[:v.length])
+			Expect(mac[:]).To(Equal(decodeHex(v.expected)), "%s, %d bytes", v.key, v.length)
+		}
+	})
+})
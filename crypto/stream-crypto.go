@@ -0,0 +1,365 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StreamChunkSize is the size, in bytes, of the plaintext chunks an encrypted stream is split into.
+const StreamChunkSize = 64 * 1024
+
+const streamSaltSize = 32
+const streamTagSize = 16
+const streamHKDFInfo = "go-util-helpers stream key"
+
+// Encrypted streams follow the STREAM construction (Hoang, Reyhanitabar, Rogaway, Vizár): after the header, a
+// random salt is written and used to derive a per-stream key from the caller's key, for the cipher named in the
+// header. The plaintext is then sealed in StreamChunkSize chunks whose nonce is the chunk counter plus a final-chunk
+// flag, so chunks cannot be reordered, dropped or truncated without failing authentication. The header and any
+// additional data are part of the key derivation, so the header cannot be altered and the stream is bound to the
+// additional data. Every chunk except the last is exactly StreamChunkSize bytes of plaintext; the last chunk is
+// always shorter (possibly empty), which is how a reader recognizes it.
+
+// deriveStreamKey returns the per-stream key, which the stream's chunks are sealed with.
+func deriveStreamKey(key *AES256Key, rawHeader []byte, additionalData []byte, salt []byte) (*AES256Key, error) {
+	info := append(append([]byte(streamHKDFInfo), rawHeader...), additionalData...)
+	return key.Derive(info, salt)
+}
+
+// beginStream writes the stream header and a new salt, read from random, to w, and returns the per-stream key.
+func beginStream(w io.Writer, h *Header, key *AES256Key, additionalData []byte, random io.Reader) (*AES256Key, error) {
+
+	salt := make([]byte, streamSaltSize)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return nil, err
+	}
+
+	rawHeader := h.marshal()
+
+	streamKey, err := deriveStreamKey(key, rawHeader, additionalData, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(append(rawHeader, salt...)); err != nil {
+		streamKey.Destroy()
+		return nil, err
+	}
+
+	return streamKey, nil
+}
+
+// openStream reads the stream header and salt from r, and returns the header and the per-stream key.
+func openStream(r io.Reader, additionalData []byte, resolveKey keyResolver) (*Header, *AES256Key, error) {
+
+	h, rawHeader, err := readHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if h.Flags&FlagStream == 0 || h.Cipher == CipherAES256SIV {
+		return nil, nil, errors.New("ciphertext is not an encrypted stream; use Decrypt")
+	}
+
+	key, err := resolveKey(h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	salt := make([]byte, streamSaltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, nil, fmt.Errorf("failed to read the stream salt: %v", err)
+	}
+
+	streamKey, err := deriveStreamKey(key, rawHeader, additionalData, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return h, streamKey, nil
+}
+
+func streamNonce(nonce []byte, counter uint64, last bool) []byte {
+
+	for i := range nonce {
+		nonce[i] = 0
+	}
+
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], counter)
+
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+
+	return nonce
+}
+
+type encryptingWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	nonce   []byte
+	buf     []byte
+	out     []byte
+	counter uint64
+	closed  bool
+	err     error
+}
+
+// NewEncryptingWriter returns an io.WriteCloser that encrypts everything written to it with the provided key, and
+// writes the result to w in authenticated chunks. The returned writer must be closed to write the final chunk;
+// closing it does not close w.
+// Use NewDecryptingReader to decrypt the result.
+func NewEncryptingWriter(w io.Writer, key *AES256Key) (io.WriteCloser, error) {
+	return NewEncryptingWriterWithAAD(w, nil, key)
+}
+
+// NewEncryptingWriterWithAAD is like NewEncryptingWriter, but binds the stream to the additional data (see
+// EncryptWithAAD). Use NewDecryptingReaderWithAAD to decrypt the result.
+func NewEncryptingWriterWithAAD(w io.Writer, additionalData []byte, key *AES256Key) (io.WriteCloser, error) {
+	return NewEncryptingWriterWithOptions(w, key, EncryptOptions{AdditionalData: additionalData})
+}
+
+// NewEncryptingWriterWithOptions is like NewEncryptingWriter, but encrypts with the provided options (see
+// EncryptWithOptions). Use NewDecryptingReaderWithAAD to decrypt the result.
+func NewEncryptingWriterWithOptions(w io.Writer, key *AES256Key, options EncryptOptions) (io.WriteCloser, error) {
+
+	h, err := newStreamHeader(key, options)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptor, err := newEncryptingWriter(w, h, key, options.AdditionalData, options.random())
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Flags&FlagCompressed != 0 {
+		return newCompressingEncryptingWriter(h.Compression, encryptor)
+	}
+
+	return encryptor, nil
+}
+
+// newStreamHeader returns the header for a stream encrypted with the provided key and options.
+func newStreamHeader(key *AES256Key, options EncryptOptions) (*Header, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to encrypt with nil key")
+	}
+
+	c, err := selectCipher(options.Cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	h := newHeader(c, FlagStream, key)
+
+	if options.Compression != CompressionNone {
+		if err := validateCompression(options.Compression); err != nil {
+			return nil, err
+		}
+
+		h.Flags |= FlagCompressed
+		h.Compression = options.Compression
+	}
+
+	return h, nil
+}
+
+// newEncryptingWriter writes the stream header and salt, and returns a writer that encrypts with the provided key.
+func newEncryptingWriter(w io.Writer, h *Header, key *AES256Key, additionalData []byte, random io.Reader) (io.WriteCloser, error) {
+
+	streamKey, err := beginStream(w, h, key, additionalData, random)
+	if err != nil {
+		return nil, err
+	}
+	defer streamKey.Destroy()
+
+	aead, err := newAEAD(h.Cipher, streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptingWriter{
+		w:     w,
+		aead:  aead,
+		nonce: make([]byte, aead.NonceSize()),
+		buf:   make([]byte, 0, StreamChunkSize),
+		out:   make([]byte, 0, StreamChunkSize+streamTagSize),
+	}, nil
+}
+
+func (ew *encryptingWriter) Write(p []byte) (int, error) {
+
+	if ew.closed {
+		return 0, errors.New("write to closed encrypting writer")
+	}
+
+	if ew.err != nil {
+		return 0, ew.err
+	}
+
+	written := 0
+
+	for len(p) > 0 {
+		// a full buffer is only flushed once more data arrives, so that Close can tell whether it is the last chunk
+		if len(ew.buf) == StreamChunkSize {
+			if err := ew.flush(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(ew.buf[len(ew.buf):cap(ew.buf)], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close writes the final chunk. It does not close the underlying writer.
+func (ew *encryptingWriter) Close() error {
+
+	if ew.closed {
+		return nil
+	}
+
+	ew.closed = true
+
+	if ew.err != nil {
+		return ew.err
+	}
+
+	// the last chunk must be short, so a full buffer is written as a regular chunk followed by an empty last chunk
+	if len(ew.buf) == StreamChunkSize {
+		if err := ew.flush(false); err != nil {
+			return err
+		}
+	}
+
+	return ew.flush(true)
+}
+
+func (ew *encryptingWriter) flush(last bool) error {
+
+	ew.out = ew.aead.Seal(ew.out[:0], streamNonce(ew.nonce, ew.counter, last), ew.buf, nil)
+	ew.buf = ew.buf[:0]
+	ew.counter++
+
+	if _, err := ew.w.Write(ew.out); err != nil {
+		ew.err = err
+		return err
+	}
+
+	return nil
+}
+
+type decryptingReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	nonce   []byte
+	in      []byte
+	plain   []byte
+	counter uint64
+	done    bool
+	err     error
+}
+
+// NewDecryptingReader returns an io.Reader that decrypts the stream read from r (e.g. produced by
+// NewEncryptingWriter) with the provided key.
+// Each chunk is authenticated before any of its plaintext is returned; a stream that has been modified, reordered or
+// truncated results in an error from Read. As a stream may be truncated at any point, callers should not act on
+// the plaintext until Read has returned io.EOF.
+func NewDecryptingReader(r io.Reader, key *AES256Key) (io.Reader, error) {
+	return NewDecryptingReaderWithAAD(r, nil, key)
+}
+
+// NewDecryptingReaderWithAAD is like NewDecryptingReader, but the additional data must match the additional data
+// provided to NewEncryptingWriterWithAAD.
+func NewDecryptingReaderWithAAD(r io.Reader, additionalData []byte, key *AES256Key) (io.Reader, error) {
+
+	if key == nil {
+		return nil, errors.New("tried to decrypt with nil key")
+	}
+
+	return newDecryptingReader(r, additionalData, resolveWithKey(key))
+}
+
+// newDecryptingReader reads the stream header, and decrypts the stream with the key returned by resolveKey.
+func newDecryptingReader(r io.Reader, additionalData []byte, resolveKey keyResolver) (io.Reader, error) {
+
+	h, streamKey, err := openStream(r, additionalData, resolveKey)
+	if err != nil {
+		return nil, err
+	}
+	defer streamKey.Destroy()
+
+	aead, err := newAEAD(h.Cipher, streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dr := &decryptingReader{
+		r:     r,
+		aead:  aead,
+		nonce: make([]byte, aead.NonceSize()),
+		in:    make([]byte, StreamChunkSize+streamTagSize),
+	}
+
+	if h.Flags&FlagCompressed != 0 {
+		return newDecompressingReader(h.Compression, dr)
+	}
+
+	return dr, nil
+}
+
+func (dr *decryptingReader) Read(p []byte) (int, error) {
+
+	for len(dr.plain) == 0 {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+
+		if dr.done {
+			return 0, io.EOF
+		}
+
+		dr.err = dr.readChunk()
+	}
+
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+func (dr *decryptingReader) readChunk() error {
+
+	last := false
+
+	n, err := io.ReadFull(dr.r, dr.in)
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+
+	if last && n < streamTagSize {
+		return errors.New("encrypted stream is truncated")
+	}
+
+	plain, err := dr.aead.Open(dr.in[:0], streamNonce(dr.nonce, dr.counter, last), dr.in[:n], nil)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate chunk %d of the encrypted stream: %v", dr.counter, err)
+	}
+
+	dr.plain = plain
+	dr.counter++
+	dr.done = last
+	return nil
+}
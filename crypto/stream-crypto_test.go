@@ -0,0 +1,203 @@
+package crypto_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func encryptStream(plaintext []byte, key *crypto.AES256Key) []byte {
+	var buf bytes.Buffer
+
+	w, err := crypto.NewEncryptingWriter(&buf, key)
+	Expect(err).To(BeNil())
+
+	_, err = w.Write(plaintext)
+	Expect(err).To(BeNil())
+	Expect(w.Close()).To(Succeed())
+
+	return buf.Bytes()
+}
+
+func decryptStream(ciphertext []byte, key *crypto.AES256Key) ([]byte, error) {
+	r, err := crypto.NewDecryptingReader(bytes.NewReader(ciphertext), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(r)
+}
+
+func patternedBytes(length int) []byte {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+var _ = Describe("NewEncryptingWriter", func() {
+	It("encrypts a stream", func() {
+		plaintext := patternedBytes(1000)
+		ciphertext := encryptStream(plaintext, &fixedKey)
+
+		Expect(len(ciphertext)).To(BeNumerically(">", len(plaintext)))
+		Expect(bytes.Contains(ciphertext, plaintext[:100])).To(Equal(false))
+	})
+
+	It("produces different output for the same input", func() {
+		plaintext := []byte("test")
+		Expect(encryptStream(plaintext, &fixedKey)).NotTo(Equal(encryptStream(plaintext, &fixedKey)))
+	})
+
+	It("requires a valid key", func() {
+		w, err := crypto.NewEncryptingWriter(&bytes.Buffer{}, nil)
+		Expect(w).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("refuses writes after Close", func() {
+		w, err := crypto.NewEncryptingWriter(&bytes.Buffer{}, &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(w.Close()).To(Succeed())
+
+		_, err = w.Write([]byte("test"))
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("NewDecryptingReader", func() {
+	sizes := []int{
+		0,
+		1,
+		crypto.StreamChunkSize - 1,
+		crypto.StreamChunkSize,
+		crypto.StreamChunkSize + 1,
+		3*crypto.StreamChunkSize + 17,
+	}
+
+	It("returns plaintext originally encrypted by NewEncryptingWriter with the same key", func() {
+		for _, size := range sizes {
+			plaintext := patternedBytes(size)
+
+			plaintext2, err := decryptStream(encryptStream(plaintext, &fixedKey), &fixedKey)
+			Expect(err).To(BeNil())
+			Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true), "size %d", size)
+		}
+	})
+
+	It("handles many small writes", func() {
+		plaintext := patternedBytes(2*crypto.StreamChunkSize + 5)
+
+		var buf bytes.Buffer
+		w, err := crypto.NewEncryptingWriter(&buf, &fixedKey)
+		Expect(err).To(BeNil())
+
+		for i := 0; i < len(plaintext); i += 1000 {
+			end := i + 1000
+			if end > len(plaintext) {
+				end = len(plaintext)
+			}
+			_, err = w.Write(plaintext[i:end])
+			Expect(err).To(BeNil())
+		}
+		Expect(w.Close()).To(Succeed())
+
+		plaintext2, err := decryptStream(buf.Bytes(), &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+	})
+
+	It("fails with the wrong key", func() {
+		_, err := decryptStream(encryptStream([]byte("test"), &fixedKey), crypto.NewRandomAESKey())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("detects a modified chunk", func() {
+		ciphertext := encryptStream(patternedBytes(crypto.StreamChunkSize+10), &fixedKey)
+		ciphertext[100] ^= 1
+
+		_, err := decryptStream(ciphertext, &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("detects truncation", func() {
+		// the first chunk boundary, just past the salt and the first sealed chunk
+		ciphertext := encryptStream(patternedBytes(2*crypto.StreamChunkSize+10), &fixedKey)
+		chunkBoundary := len(ciphertext) - (10 + 16) - (crypto.StreamChunkSize + 16)
+
+		for _, length := range []int{chunkBoundary, len(ciphertext) - (10 + 16), len(ciphertext) - 1} {
+			_, err := decryptStream(ciphertext[:length], &fixedKey)
+			Expect(err).NotTo(BeNil(), "length %d", length)
+		}
+
+		// an empty stream still carries an (empty) authenticated final chunk
+		ciphertext = encryptStream(nil, &fixedKey)
+		_, err := decryptStream(ciphertext[:len(ciphertext)-16], &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("detects reordered chunks", func() {
+		ciphertext := encryptStream(patternedBytes(3*crypto.StreamChunkSize), &fixedKey)
+		sealedChunkSize := crypto.StreamChunkSize + 16
+		start := len(ciphertext) - 16 - 3*sealedChunkSize
+
+		reordered := append([]byte{}, ciphertext[:start]...)
+		reordered = append(reordered, ciphertext[start+sealedChunkSize:start+2*sealedChunkSize]...)
+		reordered = append(reordered, ciphertext[start:start+sealedChunkSize]...)
+		reordered = append(reordered, ciphertext[start+2*sealedChunkSize:]...)
+		Expect(len(reordered)).To(Equal(len(ciphertext)))
+
+		_, err := decryptStream(reordered, &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("does not return the plaintext of a chunk that fails authentication", func() {
+		ciphertext := encryptStream(patternedBytes(10), &fixedKey)
+		ciphertext[len(ciphertext)-1] ^= 1
+
+		r, err := crypto.NewDecryptingReader(bytes.NewReader(ciphertext), &fixedKey)
+		Expect(err).To(BeNil())
+
+		buf := make([]byte, 100)
+		n, err := r.Read(buf)
+		Expect(n).To(Equal(0))
+		Expect(err).NotTo(BeNil())
+		Expect(err).NotTo(Equal(io.EOF))
+	})
+
+	It("binds the stream to the additional data", func() {
+		plaintext := patternedBytes(crypto.StreamChunkSize + 1)
+
+		var buf bytes.Buffer
+		w, err := crypto.NewEncryptingWriterWithAAD(&buf, []byte("backup-42"), &fixedKey)
+		Expect(err).To(BeNil())
+		_, err = w.Write(plaintext)
+		Expect(err).To(BeNil())
+		Expect(w.Close()).To(Succeed())
+
+		r, err := crypto.NewDecryptingReaderWithAAD(bytes.NewReader(buf.Bytes()), []byte("backup-42"), &fixedKey)
+		Expect(err).To(BeNil())
+		plaintext2, err := ioutil.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(bytes.Equal(plaintext2, plaintext)).To(Equal(true))
+
+		r, err = crypto.NewDecryptingReaderWithAAD(bytes.NewReader(buf.Bytes()), []byte("backup-43"), &fixedKey)
+		Expect(err).To(BeNil())
+		_, err = ioutil.ReadAll(r)
+		Expect(err).NotTo(BeNil())
+
+		_, err = decryptStream(buf.Bytes(), &fixedKey)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires a valid key", func() {
+		r, err := crypto.NewDecryptingReader(bytes.NewReader(encryptStream([]byte("test"), &fixedKey)), nil)
+		Expect(r).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+})
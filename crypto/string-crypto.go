@@ -3,19 +3,35 @@ package crypto
 import (
 	"encoding/base64"
 	"errors"
-
-	"github.com/gtank/cryptopasta"
 )
 
 // EncryptStringToBase64 encrypts the plaintext with the provided key and returns the base64-encoded result.
 func EncryptStringToBase64(plaintext string, key *AES256Key) (base64Ciphertext string, err error) {
+	return EncryptStringToBase64WithAAD(plaintext, "", key)
+}
+
+// DecryptStringFromBase64 decodes the provided base64 string (e.g. from a previous call to EncryptStringToBase64),
+// decrypts the result with the provided key, and returns the resulting string.
+func DecryptStringFromBase64(base64Ciphertext string, key *AES256Key) (plaintext string, err error) {
+	return DecryptStringFromBase64WithAAD(base64Ciphertext, "", key)
+}
+
+// EncryptStringToBase64WithAAD encrypts the plaintext with the provided key, binding it to the additional data (see
+// EncryptWithAAD), and returns the base64-encoded result.
+func EncryptStringToBase64WithAAD(plaintext string, additionalData string, key *AES256Key) (base64Ciphertext string, err error) {
+	return EncryptStringToBase64WithOptions(plaintext, key, EncryptOptions{AdditionalData: []byte(additionalData)})
+}
+
+// EncryptStringToBase64WithOptions encrypts the plaintext with the provided key and options (see EncryptWithOptions),
+// and returns the base64-encoded result.
+func EncryptStringToBase64WithOptions(plaintext string, key *AES256Key, options EncryptOptions) (base64Ciphertext string, err error) {
 
 	if key == nil {
 		err = errors.New("tried to encrypt with nil key")
 		return
 	}
 
-	ciphertext, err := cryptopasta.Encrypt([]byte(plaintext), (*[AES256KeyLengthInBytes]byte)(key))
+	ciphertext, err := EncryptWithOptions([]byte(plaintext), key, options)
 	if err != nil {
 		return
 	}
@@ -24,9 +40,10 @@ func EncryptStringToBase64(plaintext string, key *AES256Key) (base64Ciphertext s
 	return
 }
 
-// DecryptStringFromBase64 decodes the provided base64 string (e.g. from a previous call to EncryptStringToBase64),
-// decrypts the result with the provided key, and returns the resulting string.
-func DecryptStringFromBase64(base64Ciphertext string, key *AES256Key) (plaintext string, err error) {
+// DecryptStringFromBase64WithAAD decodes the provided base64 string (e.g. from a previous call to
+// EncryptStringToBase64WithAAD), decrypts the result with the provided key and additional data, and returns the
+// resulting string.
+func DecryptStringFromBase64WithAAD(base64Ciphertext string, additionalData string, key *AES256Key) (plaintext string, err error) {
 
 	if key == nil {
 		err = errors.New("tried to decrypt with nil key")
@@ -38,7 +55,7 @@ func DecryptStringFromBase64(base64Ciphertext string, key *AES256Key) (plaintext
 		return
 	}
 
-	plainBytes, err := cryptopasta.Decrypt(ciphertext, (*[AES256KeyLengthInBytes]byte)(key))
+	plainBytes, err := DecryptWithAAD(ciphertext, []byte(additionalData), key)
 	if err != nil {
 		return
 	}
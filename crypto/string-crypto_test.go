@@ -57,3 +57,28 @@ var _ = Describe("DecryptStringFromBase64", func() {
 		Expect(err).NotTo(BeNil())
 	})
 })
+
+var _ = Describe("EncryptStringToBase64WithAAD / DecryptStringFromBase64WithAAD", func() {
+	It("binds the ciphertext to the additional data", func() {
+		ciphertext, err := crypto.EncryptStringToBase64WithAAD("test", "tenant-a", &fixedKey)
+		Expect(err).To(BeNil())
+
+		plaintext, err := crypto.DecryptStringFromBase64WithAAD(ciphertext, "tenant-a", &fixedKey)
+		Expect(err).To(BeNil())
+		Expect(plaintext).To(Equal("test"))
+
+		plaintext, err = crypto.DecryptStringFromBase64WithAAD(ciphertext, "tenant-b", &fixedKey)
+		Expect(plaintext).To(Equal(""))
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires a valid key", func() {
+		ciphertext, err := crypto.EncryptStringToBase64WithAAD("test", "tenant-a", nil)
+		Expect(ciphertext).To(Equal(""))
+		Expect(err).NotTo(BeNil())
+
+		plaintext, err := crypto.DecryptStringFromBase64WithAAD(fixedKeyBase64, "tenant-a", nil)
+		Expect(plaintext).To(Equal(""))
+		Expect(err).NotTo(BeNil())
+	})
+})
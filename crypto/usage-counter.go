@@ -0,0 +1,199 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// AES-GCM with random 96-bit nonces is only safe for about 2^32 messages per key (NIST SP 800-38D, section 8.3):
+// beyond that, the chance of two messages sharing a nonce, which reveals the authentication key and the XOR of the
+// plaintexts, is no longer negligible. A UsageCounter counts the messages each key has encrypted, warns when a key
+// approaches the limit, and refuses to encrypt past it, so that keys are rotated in time (see Keyring.Rotate).
+//
+// Only messages sealed directly with the key using AES-256-GCM (e.g. by Encrypt, EncryptStringToBase64 and the
+// Keyring equivalents) are counted. Suites with per-message derived keys do not use up the key: encrypted streams
+// seal their chunks with a per-stream key derived from a random salt, envelope encryption uses a new data key for each
+// message, and AES-256-GCM-SIV derives its subkeys from each message's nonce. Neither does XChaCha20-Poly1305, whose
+// nonces are large enough to be random, or deterministic encryption, which has no nonce.
+
+// DefaultUsageLimit is the count past which a UsageCounter refuses to encrypt, unless UsageCounterOptions specifies
+// otherwise.
+const DefaultUsageLimit = 1 << 32
+
+// ErrKeyUsageLimit is returned when encrypting with a key that has reached its usage limit (see UsageCounter).
+var ErrKeyUsageLimit = errors.New("key has reached its usage limit and must be rotated")
+
+// UsageStore stores the usage count of each key for a UsageCounter. Implementations backed by a database or a file
+// make the counts survive restarts, and can be shared by processes encrypting with the same keys. A store that
+// persists each call may want to reserve counts in blocks, at the cost of losing the unused part of a block on
+// restart (which errs on the side of safety).
+type UsageStore interface {
+	// Add adds n to the key's count, and returns the new count.
+	Add(id KeyID, n uint64) (uint64, error)
+	// Count returns the key's count (zero for an unknown key).
+	Count(id KeyID) (uint64, error)
+}
+
+// MemoryUsageStore is a UsageStore that keeps the counts in memory; they are lost when the process exits.
+// A MemoryUsageStore is safe for concurrent use.
+type MemoryUsageStore struct {
+	mu     sync.Mutex
+	counts map[KeyID]uint64
+}
+
+// NewMemoryUsageStore returns a new, empty MemoryUsageStore.
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{counts: make(map[KeyID]uint64)}
+}
+
+// Add adds n to the key's count, and returns the new count.
+func (s *MemoryUsageStore) Add(id KeyID, n uint64) (uint64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counts[id] += n
+	return s.counts[id], nil
+}
+
+// Count returns the key's count.
+func (s *MemoryUsageStore) Count(id KeyID) (uint64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counts[id], nil
+}
+
+// UsageCounterOptions are the options for NewUsageCounter; the zero value selects the defaults.
+type UsageCounterOptions struct {
+	// Warning is the count at which OnWarning is called (half the limit if zero).
+	Warning uint64
+	// Limit is the count past which encryption is refused with ErrKeyUsageLimit (DefaultUsageLimit if zero).
+	Limit uint64
+	// OnWarning, if set, is called when a key's count first reaches or passes Warning, e.g. to alert an operator or
+	// rotate the key. It is called from the encrypting goroutine, once per key for each UsageCounter: a store that
+	// is shared, reserves counts in blocks or persists across restarts may skip the warning count itself.
+	OnWarning func(id KeyID, count uint64)
+}
+
+// UsageCounter counts the messages encrypted with each key (see UsageStore), warning when a key approaches its
+// limit and refusing to encrypt past it. Set it in EncryptOptions, on a Keyring (see Keyring.SetUsageCounter), or for
+// every encryption (see RegisterUsageCounter).
+// A UsageCounter is safe for concurrent use, provided its store is.
+type UsageCounter struct {
+	store   UsageStore
+	options UsageCounterOptions
+	mu      sync.Mutex
+	warned  map[KeyID]bool
+}
+
+// NewUsageCounter returns a UsageCounter that keeps its counts in the provided store (a new MemoryUsageStore if nil).
+func NewUsageCounter(store UsageStore, options UsageCounterOptions) (*UsageCounter, error) {
+
+	if store == nil {
+		store = NewMemoryUsageStore()
+	}
+
+	if options.Limit == 0 {
+		options.Limit = DefaultUsageLimit
+	}
+
+	if options.Warning == 0 {
+		options.Warning = options.Limit / 2
+		if options.Warning == 0 {
+			options.Warning = 1
+		}
+	}
+
+	if options.Warning > options.Limit {
+		return nil, fmt.Errorf("usage warning (%d) is above the limit (%d)", options.Warning, options.Limit)
+	}
+
+	return &UsageCounter{store: store, options: options, warned: make(map[KeyID]bool)}, nil
+}
+
+// Count returns the number of messages the key has encrypted.
+func (uc *UsageCounter) Count(id KeyID) (uint64, error) {
+	return uc.store.Count(id)
+}
+
+// Remaining returns the number of messages the key can still encrypt before reaching the limit.
+func (uc *UsageCounter) Remaining(id KeyID) (uint64, error) {
+
+	count, err := uc.store.Count(id)
+	if err != nil {
+		return 0, err
+	}
+
+	if count >= uc.options.Limit {
+		return 0, nil
+	}
+
+	return uc.options.Limit - count, nil
+}
+
+// use counts a message encrypted with the key, before it is encrypted; it returns ErrKeyUsageLimit if the key has
+// reached its limit.
+func (uc *UsageCounter) use(key *AES256Key) error {
+
+	id := key.ID()
+
+	count, err := uc.store.Add(id, 1)
+	if err != nil {
+		return fmt.Errorf("failed to count key usage: %v", err)
+	}
+
+	if count > uc.options.Limit {
+		return ErrKeyUsageLimit
+	}
+
+	if count >= uc.options.Warning && uc.options.OnWarning != nil && uc.firstWarning(id) {
+		uc.options.OnWarning(id, count)
+	}
+
+	return nil
+}
+
+// firstWarning records that the key has passed the warning count, and returns true if it had not before.
+func (uc *UsageCounter) firstWarning(id KeyID) bool {
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if uc.warned[id] {
+		return false
+	}
+
+	uc.warned[id] = true
+	return true
+}
+
+var registeredUsageCounter struct {
+	sync.RWMutex
+	counter *UsageCounter
+}
+
+// RegisterUsageCounter sets the UsageCounter that counts every encryption that has no other counter (in its
+// EncryptOptions or Keyring), including Encrypt and EncryptStringToBase64; nil unregisters it.
+func RegisterUsageCounter(uc *UsageCounter) {
+
+	registeredUsageCounter.Lock()
+	defer registeredUsageCounter.Unlock()
+
+	registeredUsageCounter.counter = uc
+}
+
+// usageCounterFor returns the counter for an encryption with the provided options, or nil if there is none.
+func usageCounterFor(options EncryptOptions) *UsageCounter {
+
+	if options.UsageCounter != nil {
+		return options.UsageCounter
+	}
+
+	registeredUsageCounter.RLock()
+	defer registeredUsageCounter.RUnlock()
+
+	return registeredUsageCounter.counter
+}
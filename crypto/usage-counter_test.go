@@ -0,0 +1,226 @@
+package crypto_test
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/bit-mancer/go-util-helpers/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type failingUsageStore struct{}
+
+func (failingUsageStore) Add(id crypto.KeyID, n uint64) (uint64, error) {
+	return 0, errors.New("store unavailable")
+}
+
+func (failingUsageStore) Count(id crypto.KeyID) (uint64, error) {
+	return 0, errors.New("store unavailable")
+}
+
+// skippingUsageStore adds 2 for each use, as a store shared with another process might.
+type skippingUsageStore struct {
+	*crypto.MemoryUsageStore
+}
+
+func (s skippingUsageStore) Add(id crypto.KeyID, n uint64) (uint64, error) {
+	return s.MemoryUsageStore.Add(id, 2*n)
+}
+
+var _ = Describe("UsageCounter", func() {
+	var warnings []uint64
+	var counter *crypto.UsageCounter
+
+	BeforeEach(func() {
+		warnings = nil
+
+		var err error
+		counter, err = crypto.NewUsageCounter(nil, crypto.UsageCounterOptions{
+			Warning: 3,
+			Limit:   5,
+			OnWarning: func(id crypto.KeyID, count uint64) {
+				Expect(id).To(Equal(fixedKey.ID()))
+				warnings = append(warnings, count)
+			},
+		})
+		Expect(err).To(BeNil())
+	})
+
+	encrypt := func(key *crypto.AES256Key) error {
+		_, err := crypto.EncryptWithOptions([]byte("test"), key, crypto.EncryptOptions{UsageCounter: counter})
+		return err
+	}
+
+	It("counts encryptions per key", func() {
+		Expect(encrypt(&fixedKey)).To(Succeed())
+		Expect(encrypt(&fixedKey)).To(Succeed())
+
+		count, err := counter.Count(fixedKey.ID())
+		Expect(err).To(BeNil())
+		Expect(count).To(Equal(uint64(2)))
+
+		remaining, err := counter.Remaining(fixedKey.ID())
+		Expect(err).To(BeNil())
+		Expect(remaining).To(Equal(uint64(3)))
+
+		count, err = counter.Count(crypto.NewRandomAESKey().ID())
+		Expect(err).To(BeNil())
+		Expect(count).To(Equal(uint64(0)))
+	})
+
+	It("warns once when a key reaches the warning count", func() {
+		for i := 0; i < 5; i++ {
+			Expect(encrypt(&fixedKey)).To(Succeed())
+		}
+
+		Expect(warnings).To(Equal([]uint64{3}))
+	})
+
+	It("warns once when a key's count skips past the warning count", func() {
+		counter, err := crypto.NewUsageCounter(skippingUsageStore{crypto.NewMemoryUsageStore()}, crypto.UsageCounterOptions{
+			Warning: 3,
+			Limit:   10,
+			OnWarning: func(id crypto.KeyID, count uint64) {
+				warnings = append(warnings, count)
+			},
+		})
+		Expect(err).To(BeNil())
+
+		for i := 0; i < 5; i++ {
+			_, err := crypto.EncryptWithOptions([]byte("test"), &fixedKey, crypto.EncryptOptions{UsageCounter: counter})
+			Expect(err).To(BeNil())
+		}
+
+		Expect(warnings).To(Equal([]uint64{4}))
+	})
+
+	It("refuses to encrypt past the limit", func() {
+		for i := 0; i < 5; i++ {
+			Expect(encrypt(&fixedKey)).To(Succeed())
+		}
+
+		Expect(encrypt(&fixedKey)).To(Equal(crypto.ErrKeyUsageLimit))
+		Expect(encrypt(&fixedKey)).To(Equal(crypto.ErrKeyUsageLimit))
+
+		remaining, err := counter.Remaining(fixedKey.ID())
+		Expect(err).To(BeNil())
+		Expect(remaining).To(Equal(uint64(0)))
+
+		// other keys are unaffected
+		Expect(encrypt(crypto.NewRandomAESKey())).To(Succeed())
+	})
+
+	It("keeps its counts in the store", func() {
+		store := crypto.NewMemoryUsageStore()
+
+		counter, err := crypto.NewUsageCounter(store, crypto.UsageCounterOptions{Limit: 1})
+		Expect(err).To(BeNil())
+		_, err = crypto.EncryptWithOptions([]byte("test"), &fixedKey, crypto.EncryptOptions{UsageCounter: counter})
+		Expect(err).To(BeNil())
+
+		// e.g. after a restart
+		counter, err = crypto.NewUsageCounter(store, crypto.UsageCounterOptions{Limit: 1})
+		Expect(err).To(BeNil())
+		_, err = crypto.EncryptWithOptions([]byte("test"), &fixedKey, crypto.EncryptOptions{UsageCounter: counter})
+		Expect(err).To(Equal(crypto.ErrKeyUsageLimit))
+	})
+
+	It("only counts messages that use up the key", func() {
+		_, err := crypto.EncryptWithOptions([]byte("test"), &fixedKey, crypto.EncryptOptions{
+			Cipher:       crypto.CipherXChaCha20Poly1305,
+			UsageCounter: counter,
+		})
+		Expect(err).To(BeNil())
+
+		_, err = crypto.EncryptDeterministic([]byte("test"), &fixedKey)
+		Expect(err).To(BeNil())
+
+		count, err := counter.Count(fixedKey.ID())
+		Expect(err).To(BeNil())
+		Expect(count).To(Equal(uint64(0)))
+	})
+
+	It("does not encrypt when the store fails", func() {
+		counter, err := crypto.NewUsageCounter(failingUsageStore{}, crypto.UsageCounterOptions{})
+		Expect(err).To(BeNil())
+
+		ciphertext, err := crypto.EncryptWithOptions([]byte("test"), &fixedKey, crypto.EncryptOptions{UsageCounter: counter})
+		Expect(ciphertext).To(BeNil())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires the warning to be within the limit", func() {
+		_, err := crypto.NewUsageCounter(nil, crypto.UsageCounterOptions{Warning: 10, Limit: 5})
+		Expect(err).NotTo(BeNil())
+
+		_, err = crypto.NewUsageCounter(nil, crypto.UsageCounterOptions{Warning: crypto.DefaultUsageLimit + 1})
+		Expect(err).NotTo(BeNil())
+	})
+
+	Describe("RegisterUsageCounter", func() {
+		AfterEach(func() {
+			crypto.RegisterUsageCounter(nil)
+		})
+
+		It("counts encryptions without a counter of their own", func() {
+			crypto.RegisterUsageCounter(counter)
+
+			_, err := crypto.Encrypt([]byte("test"), &fixedKey)
+			Expect(err).To(BeNil())
+			_, err = crypto.EncryptStringToBase64("test", &fixedKey)
+			Expect(err).To(BeNil())
+
+			count, err := counter.Count(fixedKey.ID())
+			Expect(err).To(BeNil())
+			Expect(count).To(Equal(uint64(2)))
+
+			crypto.RegisterUsageCounter(nil)
+			_, err = crypto.Encrypt([]byte("test"), &fixedKey)
+			Expect(err).To(BeNil())
+
+			count, err = counter.Count(fixedKey.ID())
+			Expect(err).To(BeNil())
+			Expect(count).To(Equal(uint64(2)))
+		})
+	})
+
+	Describe("Keyring.SetUsageCounter", func() {
+		It("counts the keyring's encryptions, and allows rotating on warning", func() {
+			kr := crypto.NewKeyring()
+			_, err := kr.Add(&fixedKey)
+			Expect(err).To(BeNil())
+
+			counter, err := crypto.NewUsageCounter(nil, crypto.UsageCounterOptions{
+				Warning: 2,
+				Limit:   3,
+				OnWarning: func(id crypto.KeyID, count uint64) {
+					_, err := kr.Rotate()
+					Expect(err).To(BeNil())
+				},
+			})
+			Expect(err).To(BeNil())
+			kr.SetUsageCounter(counter)
+
+			var ciphertexts [][]byte
+			for i := 0; i < 5; i++ {
+				ciphertext, err := kr.Encrypt([]byte("test"))
+				Expect(err).To(BeNil())
+				ciphertexts = append(ciphertexts, ciphertext)
+			}
+
+			primary, _ := kr.Primary()
+			Expect(primary).NotTo(Equal(fixedKey.ID()))
+
+			count, err := counter.Count(fixedKey.ID())
+			Expect(err).To(BeNil())
+			Expect(count).To(Equal(uint64(2)))
+
+			for _, ciphertext := range ciphertexts {
+				plaintext, err := kr.Decrypt(ciphertext)
+				Expect(err).To(BeNil())
+				Expect(bytes.Equal(plaintext, []byte("test"))).To(Equal(true))
+			}
+		})
+	})
+})